@@ -3,9 +3,13 @@ module apc-p15-tool
 go 1.26.3
 
 require (
+	github.com/pelletier/go-toml/v2 v2.0.9
 	github.com/peterbourgon/ff/v4 v4.0.0-beta.1
 	github.com/sigurn/crc16 v0.0.0-20240131213347-83fcde1e29d1
 	golang.org/x/crypto v0.51.0
+	golang.org/x/net v0.53.0
+	gopkg.in/yaml.v2 v2.4.0
+	software.sslmate.com/src/go-pkcs12 v0.7.3
 )
 
 require golang.org/x/sys v0.44.0 // indirect
@@ -0,0 +1,103 @@
+package apcssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+var errNoAuthMethod = errors.New("apcssh: no auth method (password, private key, or agent socket) specified")
+
+// authMethods returns the ssh auth methods of cfg in the order they are tried:
+// private key, agent, password, and then keyboard-interactive (which answers
+// every prompt with the password). If an agent is used, its connection is
+// also returned and must be closed when the client is done.
+func authMethods(cfg *Config) ([]ssh.AuthMethod, net.Conn, error) {
+	methods := []ssh.AuthMethod{}
+
+	// private key
+	privateKey := cfg.PrivateKey
+	if cfg.PrivateKeyFile != "" {
+		if len(privateKey) > 0 {
+			return nil, nil, errors.New("apcssh: both private key and private key file specified")
+		}
+
+		var err error
+		privateKey, err = os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("apcssh: failed to read private key file (%w)", err)
+		}
+	}
+
+	var keySigner ssh.Signer
+	if len(privateKey) > 0 {
+		var err error
+		if len(cfg.PrivateKeyPassphrase) > 0 {
+			keySigner, err = ssh.ParsePrivateKeyWithPassphrase(privateKey, cfg.PrivateKeyPassphrase)
+		} else {
+			keySigner, err = ssh.ParsePrivateKey(privateKey)
+		}
+		if err != nil {
+			passphraseErr := &ssh.PassphraseMissingError{}
+			if errors.As(err, &passphraseErr) {
+				return nil, nil, errors.New("apcssh: private key is encrypted and no passphrase was specified")
+			}
+			return nil, nil, fmt.Errorf("apcssh: failed to parse private key (%w)", err)
+		}
+	}
+
+	// agent (its keys are fetched when authenticating, so it stays connected)
+	var agentConn net.Conn
+	var agentClient agent.ExtendedAgent
+	if cfg.AgentSocket != "" {
+		var err error
+		agentConn, err = net.Dial("unix", cfg.AgentSocket)
+		if err != nil {
+			return nil, nil, fmt.Errorf("apcssh: failed to connect to ssh agent (%w)", err)
+		}
+		agentClient = agent.NewClient(agentConn)
+	}
+
+	// x/crypto/ssh only tries the first method of each type, so the private
+	// key and agent keys are one method
+	if keySigner != nil || agentClient != nil {
+		methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			signers := []ssh.Signer{}
+			if keySigner != nil {
+				signers = append(signers, keySigner)
+			}
+			if agentClient != nil {
+				agentSigners, err := agentClient.Signers()
+				if err != nil && len(signers) == 0 {
+					return nil, fmt.Errorf("apcssh: failed to get ssh agent keys (%w)", err)
+				}
+				signers = append(signers, agentSigners...)
+			}
+			return signers, nil
+		}))
+	}
+
+	// password (fallback)
+	if cfg.Password != "" {
+		methods = append(methods, ssh.Password(cfg.Password))
+
+		// some AOS versions only allow keyboard-interactive
+		methods = append(methods, ssh.KeyboardInteractive(func(_name, _instruction string, questions []string, _echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range questions {
+				answers[i] = cfg.Password
+			}
+			return answers, nil
+		}))
+	}
+
+	if len(methods) == 0 {
+		return nil, nil, errNoAuthMethod
+	}
+
+	return methods, agentConn, nil
+}
@@ -1,11 +1,8 @@
 package apcssh
 
 import (
-	"bytes"
-	"crypto/md5"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/hex"
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"runtime"
@@ -15,12 +12,28 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-const (
-	apcSSHVer = 1
+const apcSSHVer = 1
 
-	sshTimeout = 90 * time.Second
+// Default timeouts (used when the Config's timeout is zero); the cmd timeout
+// is very long as it is unlikely to be needed but still exists to avoid an
+// indefinite hang in the unlikely event something does go wrong
+const (
+	DefaultConnectTimeout = 90 * time.Second
+	DefaultLoginTimeout   = 20 * time.Second
+	DefaultCmdTimeout     = 5 * time.Minute
 )
 
+// APC seems to require `Client Version` string to start with "SSH-2" and must be at least
+// 13 characters long
+// working examples from other clients:
+// ClientVersion: "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6",
+// ClientVersion: "SSH-2.0-PuTTY_Release_0.80",
+var clientVersion = fmt.Sprintf("SSH-2.0-apcssh_v%d %s-%s", apcSSHVer, runtime.GOOS, runtime.GOARCH)
+
+// ErrFingerprintMismatch is returned (wrapped) when the server's key does not
+// match the configured fingerprint
+var ErrFingerprintMismatch = errors.New("apcssh: server returned wrong sha256 fingerprint")
+
 // APC UPS won't except Go's SSH "Run()" command as the format isn't quite
 // the same. Therefore, write a custom implementation instead of relying on
 // something like github.com/bramvdbogaerde/go-scp
@@ -31,65 +44,126 @@ type Config struct {
 	Password          string
 	ServerFingerprint string
 	InsecureCipher    bool
+
+	// KnownHostsFile is the path of an OpenSSH known_hosts file to verify the
+	// server key with (instead of ServerFingerprint). If TOFU is set, a host
+	// that is not in the file has its key added (the file is made if needed)
+	// and HostKeyRecorded, if not nil, is called with its sha256 fingerprint.
+	KnownHostsFile  string
+	TOFU            bool
+	HostKeyRecorded func(fingerprint string)
+
+	// PrivateKey is a pem encoded ssh private key (e.g., OPENSSH PRIVATE KEY)
+	// for public key auth, or PrivateKeyFile is the path of one;
+	// PrivateKeyPassphrase decrypts it if it is encrypted
+	PrivateKey           []byte
+	PrivateKeyFile       string
+	PrivateKeyPassphrase []byte
+	// AgentSocket is the path of an ssh-agent socket (e.g., $SSH_AUTH_SOCK)
+	// whose keys are used for public key auth
+	AgentSocket string
+
+	// Dialer, if not nil, makes the connections to the UPS (e.g., a JumpDialer
+	// or SOCKS5 dialer); otherwise the UPS is connected to directly
+	Dialer Dialer
+
+	// ConnectTimeout is the maximum time to connect to the UPS (including
+	// the ssh handshake and auth); LoginTimeout is the maximum time for the UPS
+	// shell to show its prompt after login; CmdTimeout is the maximum time for
+	// each UPS command or file transfer. Zero uses the default.
+	ConnectTimeout time.Duration
+	LoginTimeout   time.Duration
+	CmdTimeout     time.Duration
 }
 
-// Client is an APC UPS SSH client
+// Client is an APC UPS SSH client. All of its actions stop (and return the
+// context's error, wrapped) when their context is done.
 type Client struct {
-	hostname string
-	sshCfg   *ssh.ClientConfig
+	hostname       string
+	sshCfg         *ssh.ClientConfig
+	dialer         Dialer
+	agentConn      net.Conn
+	connectTimeout time.Duration
+	loginTimeout   time.Duration
+	cmdTimeout     time.Duration
 }
 
-// New creates a new SSH Client for the APC UPS.
-func New(cfg *Config) (*Client, error) {
+// orDefault returns timeout, or defaultTimeout if timeout is not > 0
+func orDefault(timeout, defaultTimeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+
+	return defaultTimeout
+}
+
+// withCtxErr returns err with the ctx error (e.g., context.Canceled) wrapped
+// in if ctx is done, since the connection being closed by ctx is then the
+// cause of err
+func withCtxErr(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil || errors.Is(err, ctx.Err()) {
+		return err
+	}
+
+	return fmt.Errorf("%w (%s)", ctx.Err(), err)
+}
+
+// New creates a new SSH Client for the APC UPS and checks that it can connect
+// and log in.
+func New(ctx context.Context, cfg *Config) (*Client, error) {
 	// make host key callback
-	hk := func(_hostname string, _remote net.Addr, key ssh.PublicKey) error {
-		// calculate server's key's SHA256
-		hasher := sha256.New()
-		_, err := hasher.Write(key.Marshal())
-		if err != nil {
-			return err
-		}
-		actualHash := hasher.Sum(nil)
-
-		// convert to expected format for comparison
-		actualHashB64 := base64.RawStdEncoding.EncodeToString(actualHash)
-		actualHashHex := hex.EncodeToString(actualHash)
-
-		// check for fingerprint match (b64 or hex)
-		if actualHashB64 != cfg.ServerFingerprint && actualHashHex != cfg.ServerFingerprint {
-			// calculate server's key's MD5
-			// MD5 CANNOT be used in the config as collisions are too common, however, this
-			// is the value shown in the NMC web interface, so it may be useful to users for
-			// some level of assurance
-			hasher = md5.New()
-			_, err = hasher.Write(key.Marshal())
-			if err != nil {
-				return err
-			}
-			md5ActualHash := hasher.Sum(nil)
-
-			md5ActualHashHex := string(hex.EncodeToString(md5ActualHash))
-
-			// add colons for copy/paste convenience since they exist in the webui
-			var buffer bytes.Buffer
-			n_1 := 1
-			l_1 := len(md5ActualHashHex) - 1
-			for i, rune := range md5ActualHashHex {
-				buffer.WriteRune(rune)
-				if i%2 == n_1 && i != l_1 {
-					buffer.WriteRune(':')
-				}
-			}
-			md5ActualHashHex = buffer.String()
-
-			// return detailed info for convenience and debugging
-			return fmt.Errorf("apcssh: server returned wrong sha256 fingerprint (b64: %s ; hex: %s ; "+
-				"md5 hex is: %s , but is not acceptable in the fingerprint parameter)", actualHashB64, actualHashHex, md5ActualHashHex)
-		}
+	hk, err := hostKeyCallback(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-		return nil
+	// auth (public key and/or password)
+	auth, agentConn, err := authMethods(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// install file on UPS
+	// ssh config
+	config := &ssh.ClientConfig{
+		User:            cfg.Username,
+		Auth:            auth,
+		ClientVersion:   clientVersion,
+		Config:          sshAlgorithms(cfg.InsecureCipher),
+		HostKeyCallback: hk,
+	}
+
+	// if hostname missing a port, add default
+	if !strings.Contains(cfg.Hostname, ":") {
+		cfg.Hostname = cfg.Hostname + ":22"
 	}
 
+	// note: new ssh Dial will be done for each action as the UPS seems to not
+	// do well with more than one Session per Dial
+	cli := &Client{
+		hostname:       cfg.Hostname,
+		sshCfg:         config,
+		dialer:         cfg.Dialer,
+		agentConn:      agentConn,
+		connectTimeout: orDefault(cfg.ConnectTimeout, DefaultConnectTimeout),
+		loginTimeout:   orDefault(cfg.LoginTimeout, DefaultLoginTimeout),
+		cmdTimeout:     orDefault(cfg.CmdTimeout, DefaultCmdTimeout),
+	}
+
+	// connect to ups over SSH (to verify everything works)
+	sshClient, err := cli.dial(ctx)
+	if err != nil {
+		_ = cli.Close()
+		return nil, withCtxErr(ctx, err)
+	}
+	_ = sshClient.Close()
+
+	return cli, nil
+}
+
+// sshAlgorithms returns the key exchange and cipher algorithms to use with
+// the UPS
+func sshAlgorithms(insecureCipher bool) ssh.Config {
 	// kex algos
 	// see defaults: https://cs.opensource.google/go/x/crypto/+/refs/tags/v0.18.0:ssh/common.go;l=62
 	kexAlgos := []string{
@@ -109,49 +183,57 @@ func New(cfg *Config) (*Client, error) {
 	}
 
 	// insecure cipher options?
-	if cfg.InsecureCipher {
+	if insecureCipher {
 		ciphers = append(ciphers, "aes128-cbc", "3des-cbc")
 	}
 
-	// install file on UPS
-	// ssh config
-	config := &ssh.ClientConfig{
-		User: cfg.Username,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(cfg.Password),
-		},
-		// APC seems to require `Client Version` string to start with "SSH-2" and must be at least
-		// 13 characters long
-		// working examples from other clients:
-		// ClientVersion: "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6",
-		// ClientVersion: "SSH-2.0-PuTTY_Release_0.80",
-		ClientVersion: fmt.Sprintf("SSH-2.0-apcssh_v%d %s-%s", apcSSHVer, runtime.GOOS, runtime.GOARCH),
-		Config: ssh.Config{
-			KeyExchanges: kexAlgos,
-			Ciphers:      ciphers,
-		},
-		HostKeyCallback: hk,
+	return ssh.Config{
+		KeyExchanges: kexAlgos,
+		Ciphers:      ciphers,
+	}
+}
 
-		// reasonable timeout for file copy
-		Timeout: sshTimeout,
+// Close releases the client's resources (i.e., the ssh agent connection). UPS
+// connections are not kept open between actions, so there is nothing else to
+// close.
+func (cli *Client) Close() error {
+	if cli.agentConn == nil {
+		return nil
 	}
 
-	// if hostname missing a port, add default
-	if !strings.Contains(cfg.Hostname, ":") {
-		cfg.Hostname = cfg.Hostname + ":22"
+	return cli.agentConn.Close()
+}
+
+// dial connects to the UPS over SSH. The connection is closed when ctx is
+// done (or when the returned client is closed).
+func (cli *Client) dial(ctx context.Context) (*ssh.Client, error) {
+	dialer := cli.dialer
+	if dialer == nil {
+		dialer = directDialer
 	}
 
-	// connect to ups over SSH (to verify everything works)
-	sshClient, err := ssh.Dial("tcp", cfg.Hostname, config)
+	connectCtx, cancel := context.WithTimeout(ctx, cli.connectTimeout)
+	defer cancel()
+
+	conn, err := dialer.DialContext(connectCtx, "tcp", cli.hostname)
 	if err != nil {
-		return nil, err
+		return nil, withCtxErr(connectCtx, err)
+	}
+
+	// abort the handshake when the connect timeout passes, and everything
+	// after it when ctx is done
+	stopConnect := context.AfterFunc(connectCtx, func() { _ = conn.Close() })
+	conn = closeOnDone(ctx, conn)
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, cli.hostname, cli.sshCfg)
+	if !stopConnect() && err == nil {
+		_ = sshConn.Close()
+		err = connectCtx.Err()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, withCtxErr(connectCtx, err)
 	}
-	_ = sshClient.Close()
 
-	// return Client (note: new ssh Dial will be done for each action as the UPS
-	// seems to not do well with more than one Session per Dial)
-	return &Client{
-		hostname: cfg.Hostname,
-		sshCfg:   config,
-	}, nil
+	return ssh.NewClient(sshConn, chans, reqs), nil
 }
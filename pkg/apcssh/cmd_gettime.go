@@ -1,6 +1,7 @@
 package apcssh
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strings"
@@ -9,10 +10,10 @@ import (
 
 // GetTime sends the APC `system` command and then attempts to parse the
 // response to determine the UPS current date/time.
-func (cli *Client) GetTime() (time.Time, error) {
-	result, err := cli.cmd("date")
+func (cli *Client) GetTime(ctx context.Context) (time.Time, error) {
+	result, err := cli.cmd(ctx, "date")
 	if err != nil {
-		return time.Time{}, fmt.Errorf("apcssh: failed to get time (%s)", err)
+		return time.Time{}, fmt.Errorf("apcssh: failed to get time (%w)", err)
 	} else if !strings.EqualFold(result.code, "e000") {
 		return time.Time{}, fmt.Errorf("apcssh: failed to get time (%s: %s)", result.code, result.codeText)
 	}
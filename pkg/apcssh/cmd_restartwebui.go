@@ -1,6 +1,7 @@
 package apcssh
 
 import (
+	"context"
 	"fmt"
 	"strings"
 )
@@ -10,8 +11,8 @@ import (
 // This command will cause SSH to also restart after a slight delay, therefore
 // any command right after this will start to run but then get stuck / fail
 // somewhere in the middle.
-func (cli *Client) RestartWebUI() error {
-	result, err := cli.cmd("reboot -Y")
+func (cli *Client) RestartWebUI(ctx context.Context) error {
+	result, err := cli.cmd(ctx, "reboot -Y")
 	if err != nil {
 		return fmt.Errorf("apcssh: failed to restart web ui (%w)", err)
 	} else if !strings.EqualFold(result.code, "e000") {
@@ -0,0 +1,81 @@
+package apcssh
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"golang.org/x/net/proxy"
+)
+
+// Dialer makes the network connections to the UPS (e.g., through a jump host
+// or proxy); DialContext is the same as net.Dialer's
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// directDialer is the dialer used if none is configured
+var directDialer Dialer = &net.Dialer{}
+
+// ctxConn is a conn that is closed when its context is done
+type ctxConn struct {
+	net.Conn
+	stop func() bool
+}
+
+// Close stops watching the context and closes the conn
+func (conn *ctxConn) Close() error {
+	conn.stop()
+	return conn.Conn.Close()
+}
+
+// closeOnDone returns conn wrapped so it is closed when ctx is done (this
+// also works for conns that do not support deadlines, e.g., through a jump
+// host)
+func closeOnDone(ctx context.Context, conn net.Conn) net.Conn {
+	return &ctxConn{
+		Conn: conn,
+		stop: context.AfterFunc(ctx, func() { _ = conn.Close() }),
+	}
+}
+
+// proxyDialer adapts a Dialer to the x/net proxy.Dialer interface (which also
+// requires Dial)
+type proxyDialer struct {
+	Dialer
+}
+
+// Dial connects to the address on the named network
+func (d proxyDialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// NewSOCKS5Dialer returns a Dialer that connects through the SOCKS5 proxy at
+// address (host:port), which is reached with forward (or directly if forward is
+// nil). Username and password are optional. Hostnames are resolved by the
+// proxy.
+func NewSOCKS5Dialer(address, username, password string, forward Dialer) (Dialer, error) {
+	if forward == nil {
+		forward = directDialer
+	}
+
+	var auth *proxy.Auth
+	if username != "" || password != "" {
+		auth = &proxy.Auth{
+			User:     username,
+			Password: password,
+		}
+	}
+
+	d, err := proxy.SOCKS5("tcp", address, auth, proxyDialer{forward})
+	if err != nil {
+		return nil, fmt.Errorf("apcssh: failed to make socks5 dialer (%w)", err)
+	}
+
+	ctxDialer, ok := d.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("apcssh: socks5 dialer does not support context")
+	}
+
+	return ctxDialer, nil
+}
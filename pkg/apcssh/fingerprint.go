@@ -0,0 +1,112 @@
+package apcssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// errHostKeyFetched aborts the ssh handshake once the server's key is known
+var errHostKeyFetched = errors.New("apcssh: host key fetched")
+
+// HostKey is the ssh host key of a UPS
+type HostKey struct {
+	// Hostname is the host:port the key was fetched from
+	Hostname string
+	// Algorithm is the key's type (e.g., ssh-rsa)
+	Algorithm string
+	// SHA256 fingerprint (either is accepted by the fingerprint option)
+	SHA256B64 string
+	SHA256Hex string
+	// MD5Hex is the colon separated MD5 fingerprint the NMC web ui shows (it
+	// is NOT acceptable in the fingerprint option)
+	MD5Hex string
+
+	key    ssh.PublicKey
+	remote net.Addr
+}
+
+// FetchHostKey connects to the UPS and returns its ssh host key without
+// logging in (and without verifying the key). Only cfg's Hostname,
+// InsecureCipher, Dialer, and ConnectTimeout are used.
+func FetchHostKey(ctx context.Context, cfg *Config) (*HostKey, error) {
+	hostname := cfg.Hostname
+	if !strings.Contains(hostname, ":") {
+		hostname = hostname + ":22"
+	}
+
+	var hostKey *HostKey
+	hk := func(_hostname string, remote net.Addr, key ssh.PublicKey) error {
+		fps := fingerprintsOf(key)
+		hostKey = &HostKey{
+			Hostname:  hostname,
+			Algorithm: key.Type(),
+			SHA256B64: fps.sha256B64,
+			SHA256Hex: fps.sha256Hex,
+			MD5Hex:    fps.md5Hex,
+			key:       key,
+			remote:    remote,
+		}
+
+		return errHostKeyFetched
+	}
+
+	cli := &Client{
+		hostname: hostname,
+		sshCfg: &ssh.ClientConfig{
+			User:            cfg.Username,
+			ClientVersion:   clientVersion,
+			Config:          sshAlgorithms(cfg.InsecureCipher),
+			HostKeyCallback: hk,
+		},
+		dialer:         cfg.Dialer,
+		connectTimeout: orDefault(cfg.ConnectTimeout, DefaultConnectTimeout),
+	}
+
+	sshClient, err := cli.dial(ctx)
+	if err == nil {
+		// should never happen since the callback always aborts
+		_ = sshClient.Close()
+	}
+	if hostKey == nil {
+		return nil, fmt.Errorf("apcssh: failed to fetch host key (%w)", withCtxErr(ctx, err))
+	}
+
+	return hostKey, nil
+}
+
+// KnownHostsLine returns the key as an OpenSSH known_hosts line
+func (hostKey *HostKey) KnownHostsLine() string {
+	return knownhosts.Line([]string{knownhosts.Normalize(hostKey.Hostname)}, hostKey.key)
+}
+
+// AddToKnownHosts adds the key to the known hosts file (which is made if it
+// does not exist) and returns true, or returns false if the file already has
+// the key for the host. If the file has a different key for the host, the
+// file is not changed and ErrHostKeyChanged is returned (wrapped).
+func (hostKey *HostKey) AddToKnownHosts(filePath string) (bool, error) {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	err := touchKnownHosts(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	unknown, err := checkKnownHosts(filePath, hostKey.Hostname, hostKey.remote, hostKey.key)
+	if err != nil || !unknown {
+		return false, err
+	}
+
+	err = appendKnownHost(filePath, hostKey.Hostname, hostKey.key)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,238 @@
+package apcssh
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var (
+	// ErrHostKeyUnknown is returned (wrapped) when the known hosts file has no
+	// key for the server and trust on first use is not enabled
+	ErrHostKeyUnknown = errors.New("apcssh: server host key is not in the known hosts file")
+	// ErrHostKeyChanged is returned (wrapped) when the server's key does not
+	// match the key(s) the known hosts file has for it
+	ErrHostKeyChanged = errors.New("apcssh: server host key does not match the known hosts file (it may have been changed or the connection may be intercepted)")
+
+	errHostKeyNoVerification = errors.New("apcssh: no host key verification (fingerprint or known hosts file) specified")
+	errHostKeyBothMethods    = errors.New("apcssh: both fingerprint and known hosts file specified")
+	errHostKeyTOFUNoFile     = errors.New("apcssh: trust on first use requires a known hosts file")
+)
+
+// knownHostsMu serializes reading and writing known hosts files, so clients
+// connecting in parallel with trust on first use don't add duplicate lines
+var knownHostsMu sync.Mutex
+
+// hostKeyFingerprints are the fingerprints of a server's host key in the
+// formats used by the fingerprint option, known hosts tools, and the NMC web ui
+type hostKeyFingerprints struct {
+	sha256B64 string
+	sha256Hex string
+	// md5Hex is colon separated (e.g., 12:ab:...)
+	md5Hex string
+}
+
+// fingerprintsOf calculates the fingerprints of key
+func fingerprintsOf(key ssh.PublicKey) hostKeyFingerprints {
+	sha256Hash := sha256.Sum256(key.Marshal())
+
+	// MD5 CANNOT be used in the config as collisions are too common, however, this
+	// is the value shown in the NMC web interface, so it may be useful to users for
+	// some level of assurance
+	md5Hash := md5.Sum(key.Marshal())
+	md5HashHex := hex.EncodeToString(md5Hash[:])
+
+	// add colons for copy/paste convenience since they exist in the webui
+	var buffer bytes.Buffer
+	n_1 := 1
+	l_1 := len(md5HashHex) - 1
+	for i, rune := range md5HashHex {
+		buffer.WriteRune(rune)
+		if i%2 == n_1 && i != l_1 {
+			buffer.WriteRune(':')
+		}
+	}
+
+	return hostKeyFingerprints{
+		sha256B64: base64.RawStdEncoding.EncodeToString(sha256Hash[:]),
+		sha256Hex: hex.EncodeToString(sha256Hash[:]),
+		md5Hex:    buffer.String(),
+	}
+}
+
+// hostKeyError wraps err with the detailed fingerprints of the server's key
+func hostKeyError(err error, key ssh.PublicKey) error {
+	fps := fingerprintsOf(key)
+
+	// return detailed info for convenience and debugging
+	return fmt.Errorf("%w (b64: %s ; hex: %s ; "+
+		"md5 hex is: %s , but is not acceptable in the fingerprint parameter)", err, fps.sha256B64, fps.sha256Hex, fps.md5Hex)
+}
+
+// hostKeyCallback returns the callback that verifies the server's host key
+// against cfg's fingerprint or known hosts file
+func hostKeyCallback(cfg *Config) (ssh.HostKeyCallback, error) {
+	switch {
+	case cfg.ServerFingerprint != "" && cfg.KnownHostsFile != "":
+		return nil, errHostKeyBothMethods
+	case cfg.TOFU && cfg.KnownHostsFile == "":
+		return nil, errHostKeyTOFUNoFile
+	case cfg.KnownHostsFile != "":
+		return knownHostsCallback(cfg), nil
+	case cfg.ServerFingerprint != "":
+		return fingerprintCallback(cfg.ServerFingerprint), nil
+
+	default:
+	}
+
+	return nil, errHostKeyNoVerification
+}
+
+// fingerprintCallback returns a callback that accepts only the server key
+// with the sha256 fingerprint (b64 or hex)
+func fingerprintCallback(fingerprint string) ssh.HostKeyCallback {
+	return func(_hostname string, _remote net.Addr, key ssh.PublicKey) error {
+		fps := fingerprintsOf(key)
+
+		// check for fingerprint match (b64 or hex)
+		if fps.sha256B64 != fingerprint && fps.sha256Hex != fingerprint {
+			return hostKeyError(ErrFingerprintMismatch, key)
+		}
+
+		return nil
+	}
+}
+
+// knownHostsCallback returns a callback that accepts the server key if the
+// known hosts file has it for the host. If the file has no key for the host
+// and cfg.TOFU is set, the key is added to the file (which is made if it does
+// not exist) and accepted.
+func knownHostsCallback(cfg *Config) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		knownHostsMu.Lock()
+		defer knownHostsMu.Unlock()
+
+		if cfg.TOFU {
+			err := touchKnownHosts(cfg.KnownHostsFile)
+			if err != nil {
+				return err
+			}
+		}
+
+		// read every time since the file may have been updated by an earlier
+		// connection (e.g., trust on first use)
+		unknown, err := checkKnownHosts(cfg.KnownHostsFile, hostname, remote, key)
+		if err != nil {
+			return err
+		} else if !unknown {
+			return nil
+		}
+
+		// unknown host
+		if !cfg.TOFU {
+			return hostKeyError(ErrHostKeyUnknown, key)
+		}
+
+		err = appendKnownHost(cfg.KnownHostsFile, hostname, key)
+		if err != nil {
+			return err
+		}
+
+		if cfg.HostKeyRecorded != nil {
+			cfg.HostKeyRecorded(fingerprintsOf(key).sha256B64)
+		}
+
+		return nil
+	}
+}
+
+// checkKnownHosts returns an error if the known hosts file has a different
+// key for the host, or unknown true if it has no key for the host
+func checkKnownHosts(filePath, hostname string, remote net.Addr, key ssh.PublicKey) (unknown bool, err error) {
+	check, err := knownhosts.New(filePath)
+	if err != nil {
+		return false, fmt.Errorf("apcssh: failed to read known hosts file (%w)", err)
+	}
+
+	err = check(hostname, remote, key)
+	if err == nil {
+		return false, nil
+	}
+
+	keyErr := &knownhosts.KeyError{}
+	if !errors.As(err, &keyErr) {
+		// e.g., revoked
+		return false, hostKeyError(fmt.Errorf("%w (%s)", ErrHostKeyChanged, err), key)
+	} else if len(keyErr.Want) > 0 {
+		// key does not match a known key
+		return false, hostKeyError(fmt.Errorf("%w (known: %s:%d)", ErrHostKeyChanged, keyErr.Want[0].Filename, keyErr.Want[0].Line), key)
+	}
+
+	return true, nil
+}
+
+// touchKnownHosts makes the known hosts file (and its dir) if it does not
+// exist
+func touchKnownHosts(filePath string) error {
+	_, err := os.Stat(filePath)
+	if err == nil {
+		return nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("apcssh: failed to stat known hosts file (%w)", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(filePath), 0700)
+	if err != nil {
+		return fmt.Errorf("apcssh: failed to make known hosts file dir (%w)", err)
+	}
+
+	err = os.WriteFile(filePath, nil, 0600)
+	if err != nil {
+		return fmt.Errorf("apcssh: failed to make known hosts file (%w)", err)
+	}
+
+	return nil
+}
+
+// appendKnownHost adds a line for hostname's key to the known hosts file
+func appendKnownHost(filePath, hostname string, key ssh.PublicKey) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("apcssh: failed to read known hosts file (%w)", err)
+	}
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key) + "\n"
+	// don't join the line to the last line if it has no newline
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		line = "\n" + line
+	}
+
+	f, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("apcssh: failed to open known hosts file (%w)", err)
+	}
+
+	_, err = f.WriteString(line)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("apcssh: failed to write known hosts file (%w)", err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("apcssh: failed to write known hosts file (%w)", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package apcssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var errJumpNoHops = errors.New("apcssh: no jump hosts specified")
+
+// jumpHop is one ssh jump host of a JumpDialer
+type jumpHop struct {
+	hostname       string
+	sshCfg         *ssh.ClientConfig
+	connectTimeout time.Duration
+}
+
+// JumpDialer is a Dialer that connects through one or more ssh jump hosts
+// (bastions), in order, like OpenSSH's ProxyJump. The jump hosts are
+// connected on the first dial and stay connected (for later dials) until
+// Close.
+type JumpDialer struct {
+	hops       []jumpHop
+	forward    Dialer
+	agentConns []net.Conn
+
+	mu      sync.Mutex
+	clients []*ssh.Client
+}
+
+// NewJumpDialer returns a JumpDialer for hops. Each hop has its own auth,
+// host key verification, and connect timeout (as with New; Dialer and the
+// other timeouts are not used). The first hop is reached with forward (or
+// directly if forward is nil).
+func NewJumpDialer(hops []*Config, forward Dialer) (*JumpDialer, error) {
+	if len(hops) == 0 {
+		return nil, errJumpNoHops
+	}
+	if forward == nil {
+		forward = directDialer
+	}
+
+	d := &JumpDialer{
+		forward: forward,
+	}
+
+	for _, cfg := range hops {
+		hostname := cfg.Hostname
+		if !strings.Contains(hostname, ":") {
+			hostname = hostname + ":22"
+		}
+
+		hk, err := hostKeyCallback(cfg)
+		if err != nil {
+			_ = d.Close()
+			return nil, fmt.Errorf("apcssh: jump host %s: %w", hostname, err)
+		}
+
+		auth, agentConn, err := authMethods(cfg)
+		if err != nil {
+			_ = d.Close()
+			return nil, fmt.Errorf("apcssh: jump host %s: %w", hostname, err)
+		}
+		if agentConn != nil {
+			d.agentConns = append(d.agentConns, agentConn)
+		}
+
+		d.hops = append(d.hops, jumpHop{
+			hostname: hostname,
+			sshCfg: &ssh.ClientConfig{
+				User:            cfg.Username,
+				Auth:            auth,
+				ClientVersion:   clientVersion,
+				Config:          sshAlgorithms(cfg.InsecureCipher),
+				HostKeyCallback: hk,
+			},
+			connectTimeout: orDefault(cfg.ConnectTimeout, DefaultConnectTimeout),
+		})
+	}
+
+	return d, nil
+}
+
+// DialContext connects to address through the jump hosts. If the jump host
+// connections from an earlier dial have dropped, they are reconnected once.
+func (d *JumpDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	reused := d.clients != nil
+	conn, err := d.dialLastHop(ctx, network, address)
+	if err != nil && reused && d.clients == nil && ctx.Err() == nil {
+		conn, err = d.dialLastHop(ctx, network, address)
+	}
+
+	return conn, err
+}
+
+// dialLastHop connects to address through the last jump host (connecting the
+// jump hosts first, if needed). If the jump host connections are broken, they
+// are closed (so the next dial reconnects them).
+func (d *JumpDialer) dialLastHop(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.clients == nil {
+		err := d.connectHops(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	last := len(d.hops) - 1
+	conn, err := d.clients[last].DialContext(ctx, network, address)
+	if err != nil {
+		// an open channel error is the jump host failing to reach address,
+		// anything else (other than ctx being done) is a broken connection
+		openErr := &ssh.OpenChannelError{}
+		if !errors.As(err, &openErr) && ctx.Err() == nil {
+			d.closeClients()
+		}
+
+		return nil, fmt.Errorf("apcssh: jump host %s: failed to connect to %s (%w)", d.hops[last].hostname, address, withCtxErr(ctx, err))
+	}
+
+	return conn, nil
+}
+
+// connectHops connects to each jump host through the previous one
+func (d *JumpDialer) connectHops(ctx context.Context) error {
+	for i, hop := range d.hops {
+		err := d.connectHop(ctx, i, hop)
+		if err != nil {
+			d.closeClients()
+			return fmt.Errorf("apcssh: jump host %s: %w", hop.hostname, withCtxErr(ctx, err))
+		}
+	}
+
+	return nil
+}
+
+// connectHop connects to hop i (through the previous hop, if any)
+func (d *JumpDialer) connectHop(ctx context.Context, i int, hop jumpHop) error {
+	ctx, cancel := context.WithTimeout(ctx, hop.connectTimeout)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	if i == 0 {
+		conn, err = d.forward.DialContext(ctx, "tcp", hop.hostname)
+	} else {
+		conn, err = d.clients[i-1].DialContext(ctx, "tcp", hop.hostname)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect (%w)", withCtxErr(ctx, err))
+	}
+
+	// abort the handshake if ctx is done (conns through a jump host do not
+	// support deadlines)
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, hop.hostname, hop.sshCfg)
+	if !stop() && err == nil {
+		_ = sshConn.Close()
+		err = ctx.Err()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return withCtxErr(ctx, err)
+	}
+
+	d.clients = append(d.clients, ssh.NewClient(sshConn, chans, reqs))
+
+	return nil
+}
+
+// closeClients closes the jump host connections (last hop first)
+func (d *JumpDialer) closeClients() {
+	for i := len(d.clients) - 1; i >= 0; i-- {
+		_ = d.clients[i].Close()
+	}
+	d.clients = nil
+}
+
+// Close closes the jump host connections and the ssh agent connections
+func (d *JumpDialer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closeClients()
+
+	for _, agentConn := range d.agentConns {
+		_ = agentConn.Close()
+	}
+	d.agentConns = nil
+
+	return nil
+}
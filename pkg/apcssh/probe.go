@@ -0,0 +1,189 @@
+package apcssh
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NMCGeneration is the generation of the UPS network management card
+type NMCGeneration int
+
+const (
+	NMCGenerationUnknown NMCGeneration = iota
+	NMCGeneration2
+	NMCGeneration3
+)
+
+// String returns the generation in a log friendly string format.
+func (gen NMCGeneration) String() string {
+	switch gen {
+	case NMCGeneration2:
+		return "nmc2"
+	case NMCGeneration3:
+		return "nmc3"
+
+	default:
+	}
+
+	return "unknown"
+}
+
+// DeviceInfo is the result of probing a UPS
+type DeviceInfo struct {
+	Generation NMCGeneration
+	// from the `about` command (empty if the UPS did not report it)
+	Model              string
+	SerialNumber       string
+	AOSVersion         string
+	ApplicationName    string
+	ApplicationVersion string
+	// SSLCmd is true if the UPS has the `ssl` command (the key p15 and cert pem
+	// are installed with it instead of uploading a key+cert p15)
+	SSLCmd bool
+	// UPS time (zero and TimeErr set if it could not be determined)
+	Time    time.Time
+	TimeErr error
+}
+
+// Firmware returns the firmware versions in a log friendly string format (e.g.,
+// "aos v2.5.0.8, sumx v2.5.0.8")
+func (info *DeviceInfo) Firmware() string {
+	versions := []string{}
+	if info.AOSVersion != "" {
+		versions = append(versions, "aos "+info.AOSVersion)
+	}
+	if info.ApplicationVersion != "" {
+		versions = append(versions, strings.TrimSpace(info.ApplicationName+" "+info.ApplicationVersion))
+	}
+
+	if len(versions) == 0 {
+		return "unknown"
+	}
+
+	return strings.Join(versions, ", ")
+}
+
+// InstallMethod returns the method InstallSSLCert uses for the UPS
+func (info *DeviceInfo) InstallMethod() InstallMethod {
+	if info.SSLCmd {
+		return InstallMethodSSLCmd
+	}
+
+	return InstallMethodLegacy
+}
+
+// TimeZone returns the UPS time zone as an offset (e.g., "-05:00"), or an empty
+// string if the UPS time is not known
+func (info *DeviceInfo) TimeZone() string {
+	if info.Time.IsZero() {
+		return ""
+	}
+
+	return info.Time.Format("-07:00")
+}
+
+// Probe determines the capabilities of the UPS without changing anything on
+// it. Failure to get the UPS time is not an error (see DeviceInfo.TimeErr).
+func (cli *Client) Probe(ctx context.Context) (*DeviceInfo, error) {
+	info := &DeviceInfo{}
+
+	// ssl command
+	var err error
+	info.SSLCmd, err = cli.supportsSSLCmd(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("apcssh: probe: failed to test ssl cmd (%w)", err)
+	}
+
+	// about
+	result, err := cli.cmd(ctx, "about")
+	if err != nil {
+		return nil, fmt.Errorf("apcssh: probe: failed to send about cmd (%w)", err)
+	} else if !strings.EqualFold(result.code, "e000") {
+		return nil, fmt.Errorf("apcssh: probe: about cmd returned error code (%s: %s)", result.code, result.codeText)
+	}
+
+	about := parseAbout(result.resultText)
+	info.Model = about["Hardware Factory"]["Model Number"]
+	info.SerialNumber = about["Hardware Factory"]["Serial Number"]
+	info.AOSVersion = about["APC OS(AOS)"]["Version"]
+	info.ApplicationName = about["Application Module"]["Name"]
+	info.ApplicationVersion = about["Application Module"]["Version"]
+
+	info.Generation = nmcGeneration(info.Model, info.SSLCmd)
+
+	// time
+	info.Time, info.TimeErr = cli.GetTime(ctx)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("apcssh: probe: failed to get time (%w)", info.TimeErr)
+	}
+
+	return info, nil
+}
+
+// supportsSSLCmd runs the `ssl` command to check if the UPS has it
+func (cli *Client) supportsSSLCmd(ctx context.Context) (bool, error) {
+	result, err := cli.cmd(ctx, "ssl")
+	if err != nil {
+		return false, err
+	}
+
+	// E101 is the code for "Command Not Found"
+	return !strings.EqualFold(result.code, "e101"), nil
+}
+
+// nmcGeneration returns the nmc generation based on the model number (e.g.,
+// AP9631 is NMC2 and AP9641 is NMC3) or, if the model is not known, on support
+// for the `ssl` command (which only NMC3 has)
+func nmcGeneration(model string, sslCmd bool) NMCGeneration {
+	model = strings.ToUpper(model)
+	switch {
+	case strings.HasPrefix(model, "AP963"):
+		return NMCGeneration2
+	case strings.HasPrefix(model, "AP964"):
+		return NMCGeneration3
+	case sslCmd:
+		return NMCGeneration3
+
+	default:
+	}
+
+	return NMCGenerationUnknown
+}
+
+// parseAbout parses the output of the `about` command into its sections (e.g.,
+// "Hardware Factory") and their key/value pairs (e.g., "Model Number")
+func parseAbout(text string) map[string]map[string]string {
+	sections := map[string]map[string]string{}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r", ""), "\n")
+	section := ""
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// section heading is followed by a line of dashes
+		if i+1 < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i+1]), "---") {
+			section = line
+			continue
+		}
+		if strings.HasPrefix(line, "---") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+
+		if sections[section] == nil {
+			sections[section] = map[string]string{}
+		}
+		sections[section][strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	return sections
+}
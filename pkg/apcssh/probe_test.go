@@ -0,0 +1,135 @@
+package apcssh
+
+import (
+	"strings"
+	"testing"
+)
+
+// testAboutNMC2 is the about output of an NMC2 (AP9631, AOS v6.9.6) after the
+// E000 line (serial and mac address changed)
+var testAboutNMC2 = strings.ReplaceAll(`Hardware Factory
+---------------
+Model Number:           AP9631
+Serial Number:          5A1234X56789
+Hardware Revision:      HW05
+Manufacture Date:       03/21/2012
+MAC Address:            00 C0 B7 12 34 56
+Management Uptime:      12 Days 3 Hours 25 Minutes
+
+Application Module
+---------------
+Name:                   sumx
+Version:                v6.9.6
+Date:                   May 28 2020
+Time:                   13:29:26
+
+APC OS(AOS)
+---------------
+Name:                   aos
+Version:                v6.9.6
+Date:                   May 28 2020
+Time:                   12:44:40
+
+APC Boot Monitor
+---------------
+Name:                   bootmon
+Version:                v1.0.9
+Date:                   Feb  8 2019
+Time:                   11:10:00`, "\n", "\r\n")
+
+// testAboutNMC3 is the about output of an NMC3 (AP9641, AOS v2.5.0.8) after the
+// E000 line (serial and mac address changed)
+var testAboutNMC3 = strings.ReplaceAll(`Hardware Factory
+---------------
+Model Number:           AP9641
+Serial Number:          ZA2012345678
+Hardware Revision:      05
+Manufacture Date:       2/14/2020
+MAC Address:            28 29 86 12 34 56
+Management Uptime:      0 Days, 5 Hours, 12 Minutes
+
+Application Module
+---------------
+Name:                   sumx
+Version:                v2.5.0.8
+Date:                   Jan 25 2023
+Time:                   12:02:30
+
+APC OS(AOS)
+---------------
+Name:                   aos
+Version:                v2.5.0.8
+Date:                   Jan 25 2023
+Time:                   11:50:37
+
+APC Boot Monitor
+---------------
+Name:                   bootmon
+Version:                v1.0.9
+Date:                   Jun 14 2019
+Time:                   10:15:21`, "\n", "\r\n")
+
+func TestParseAbout(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// section -> key -> value
+		want map[string]map[string]string
+	}{
+		{"nmc2", testAboutNMC2, map[string]map[string]string{
+			"Hardware Factory":   {"Model Number": "AP9631", "Serial Number": "5A1234X56789", "Management Uptime": "12 Days 3 Hours 25 Minutes"},
+			"Application Module": {"Name": "sumx", "Version": "v6.9.6", "Time": "13:29:26"},
+			"APC OS(AOS)":        {"Name": "aos", "Version": "v6.9.6"},
+			"APC Boot Monitor":   {"Name": "bootmon", "Version": "v1.0.9"},
+		}},
+		{"nmc3", testAboutNMC3, map[string]map[string]string{
+			"Hardware Factory":   {"Model Number": "AP9641", "Serial Number": "ZA2012345678", "MAC Address": "28 29 86 12 34 56"},
+			"Application Module": {"Name": "sumx", "Version": "v2.5.0.8"},
+			"APC OS(AOS)":        {"Name": "aos", "Version": "v2.5.0.8", "Date": "Jan 25 2023"},
+			"APC Boot Monitor":   {"Name": "bootmon", "Version": "v1.0.9"},
+		}},
+		{"no sections", "Model Number: AP9641\nnot a key value line\n", map[string]map[string]string{
+			"": {"Model Number": "AP9641"},
+		}},
+		{"empty", "", map[string]map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		got := parseAbout(tt.text)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: parsed %d sections (expected %d)", tt.name, len(got), len(tt.want))
+		}
+
+		for section, values := range tt.want {
+			for key, want := range values {
+				if got[section][key] != want {
+					t.Errorf("%s: %s: %s is %q (expected %q)", tt.name, section, key, got[section][key], want)
+				}
+			}
+		}
+	}
+}
+
+func TestNMCGeneration(t *testing.T) {
+	tests := []struct {
+		name   string
+		model  string
+		sslCmd bool
+		want   NMCGeneration
+	}{
+		{"nmc2 about", parseAbout(testAboutNMC2)["Hardware Factory"]["Model Number"], false, NMCGeneration2},
+		{"nmc3 about", parseAbout(testAboutNMC3)["Hardware Factory"]["Model Number"], true, NMCGeneration3},
+		{"nmc3 old firmware", "AP9641", false, NMCGeneration3},
+		{"nmc2 lower case", "ap9630", false, NMCGeneration2},
+		{"nmc3 ap9643", "AP9643", false, NMCGeneration3},
+		{"unknown model with ssl", "SMT1500RMI2UC", true, NMCGeneration3},
+		{"unknown model", "SMT1500RMI2UC", false, NMCGenerationUnknown},
+		{"no model", "", false, NMCGenerationUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := nmcGeneration(tt.model, tt.sslCmd); got != tt.want {
+			t.Errorf("%s: nmcGeneration(%q, %t) = %s (expected %s)", tt.name, tt.model, tt.sslCmd, got, tt.want)
+		}
+	}
+}
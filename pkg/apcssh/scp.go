@@ -3,21 +3,29 @@ package apcssh
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"path"
+	"strings"
 
 	"golang.org/x/crypto/ssh"
 )
 
+// scpMaxDownloadSize is the largest file DownloadSCP accepts (ssl files are a
+// few KB)
+const scpMaxDownloadSize = 1 << 20
+
 // UploadSCP uploads a file to the destination specified (e.g., "/ssl/file.key")
 // containing the file content specified. An existing file at the destination
 // will be overwritten without warning.
-func (cli *Client) UploadSCP(destination string, fileContent []byte, filePermissions fs.FileMode) error {
+func (cli *Client) UploadSCP(ctx context.Context, destination string, fileContent []byte, filePermissions fs.FileMode) (err error) {
+	defer func() { err = withCtxErr(ctx, err) }()
+
 	// connect
-	sshClient, err := ssh.Dial("tcp", cli.hostname, cli.sshCfg)
+	sshClient, err := cli.dial(ctx)
 	if err != nil {
 		return fmt.Errorf("apcssh: scp: failed to dial client (%w)", err)
 	}
@@ -30,6 +38,13 @@ func (cli *Client) UploadSCP(destination string, fileContent []byte, filePermiss
 	}
 	defer session.Close()
 
+	// close the session early if the transfer hangs
+	xferCtx, cancel := context.WithTimeout(ctx, cli.cmdTimeout)
+	defer cancel()
+	stopAbort := context.AfterFunc(xferCtx, func() { _ = session.Close() })
+	defer stopAbort()
+	defer func() { err = withCtxErr(xferCtx, err) }()
+
 	// attach pipes
 	out, err := session.StdoutPipe()
 	if err != nil {
@@ -41,21 +56,10 @@ func (cli *Client) UploadSCP(destination string, fileContent []byte, filePermiss
 	}
 	defer w.Close()
 
-	// send execute cmd --
-	// build cmd to send as request
-	// Go implementation sends additional 0x22 bytes when using Run() (as
-	// compared to putty's scp tool). these additional bytes seem to cause the
-	// apc ups to fail execution of the command
-	payload := fmt.Appendf(nil, "scp -q -t %s", destination)
-	payloadLen := uint8(len(payload))
-	payload = append([]byte{0, 0, 0, payloadLen}, payload...)
-
-	ok, err := session.SendRequest("exec", true, payload)
+	// send execute cmd
+	err = scpExec(session, "scp -q -t "+destination)
 	if err != nil {
-		return fmt.Errorf("apcssh: scp: failed to execute scp cmd (%w)", err)
-	}
-	if !ok {
-		return errors.New("apcssh: scp: execute scp cmd not ok")
+		return err
 	}
 
 	// check remote response
@@ -101,6 +105,124 @@ func (cli *Client) UploadSCP(destination string, fileContent []byte, filePermiss
 	return nil
 }
 
+// DownloadSCP downloads the file at source (e.g., "/ssl/defaultcert.p15") and
+// returns its content.
+func (cli *Client) DownloadSCP(ctx context.Context, source string) (_ []byte, err error) {
+	defer func() { err = withCtxErr(ctx, err) }()
+
+	// connect
+	sshClient, err := cli.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("apcssh: scp: failed to dial client (%w)", err)
+	}
+	defer sshClient.Close()
+
+	// make session to use for SCP
+	session, err := sshClient.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("apcssh: scp: failed to create session (%w)", err)
+	}
+	defer session.Close()
+
+	// close the session early if the transfer hangs
+	xferCtx, cancel := context.WithTimeout(ctx, cli.cmdTimeout)
+	defer cancel()
+	stopAbort := context.AfterFunc(xferCtx, func() { _ = session.Close() })
+	defer stopAbort()
+	defer func() { err = withCtxErr(xferCtx, err) }()
+
+	// attach pipes
+	out, err := session.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+
+	// send execute cmd
+	err = scpExec(session, "scp -q -f "+source)
+	if err != nil {
+		return nil, err
+	}
+
+	// the remote (source) waits for the sink to be ready
+	_, err = w.Write([]byte{0})
+	if err != nil {
+		return nil, fmt.Errorf("apcssh: scp: failed to send ready (%w)", err)
+	}
+
+	// read file header (e.g., "C0600 1234 defaultcert.p15") or error response
+	outReader := bufio.NewReader(out)
+	responseType, err := outReader.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("apcssh: scp: failed to read file info (%w)", err)
+	}
+	header, err := outReader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("apcssh: scp: failed to read file info (%w)", err)
+	}
+	if responseType != 'C' {
+		return nil, fmt.Errorf("apcssh: scp: remote returned error (%d: %s)", responseType, strings.TrimSpace(header))
+	}
+
+	var mode uint32
+	var size int64
+	var filename string
+	_, err = fmt.Sscanf(header, "%o %d %s", &mode, &size, &filename)
+	if err != nil {
+		return nil, fmt.Errorf("apcssh: scp: failed to parse file info '%s' (%w)", strings.TrimSpace(header), err)
+	}
+	if size < 0 || size > scpMaxDownloadSize {
+		return nil, fmt.Errorf("apcssh: scp: file size %d is not valid", size)
+	}
+
+	// ready for file
+	_, err = w.Write([]byte{0})
+	if err != nil {
+		return nil, fmt.Errorf("apcssh: scp: failed to send ready (%w)", err)
+	}
+
+	// read file and the remote's status after it
+	fileContent := make([]byte, size)
+	_, err = io.ReadFull(outReader, fileContent)
+	if err != nil {
+		return nil, fmt.Errorf("apcssh: scp: failed to read file (%w)", err)
+	}
+
+	err = scpCheckResponse(outReader)
+	if err != nil {
+		return nil, fmt.Errorf("apcssh: scp: failed to read file (bad remote response) (%w)", err)
+	}
+
+	// done
+	_, _ = w.Write([]byte{0})
+
+	return fileContent, nil
+}
+
+// scpExec sends the scp command as an exec request
+func scpExec(session *ssh.Session, command string) error {
+	// Go implementation sends additional 0x22 bytes when using Run() (as
+	// compared to putty's scp tool). these additional bytes seem to cause the
+	// apc ups to fail execution of the command
+	payload := []byte(command)
+	payloadLen := uint8(len(payload))
+	payload = append([]byte{0, 0, 0, payloadLen}, payload...)
+
+	ok, err := session.SendRequest("exec", true, payload)
+	if err != nil {
+		return fmt.Errorf("apcssh: scp: failed to execute scp cmd (%w)", err)
+	}
+	if !ok {
+		return errors.New("apcssh: scp: execute scp cmd not ok")
+	}
+
+	return nil
+}
+
 // scpCheckResponse reads the output from the remote and returns an error
 // if the remote output was not 0
 func scpCheckResponse(remoteOutPipe io.Reader) error {
@@ -2,21 +2,10 @@ package apcssh
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"strings"
-	"time"
-
-	"golang.org/x/crypto/ssh"
-)
-
-// Abort shell connection if UPS doesn't send a recognizable response within
-// the specified timeouts; Cmd timeout is very long as it is unlikely to be
-// needed but still exists to avoid an indefinite hang in the unlikely event
-// something does go wrong at that part of the app
-const (
-	shellTimeoutLogin = 20 * time.Second
-	shellTimeoutCmd   = 5 * time.Minute
 )
 
 // upsCmdResult is a structure that holds all of a shell commands results
@@ -28,9 +17,11 @@ type upsCmdResult struct {
 }
 
 // cmd creates an interactive shell and executes the specified command
-func (cli *Client) cmd(command string) (*upsCmdResult, error) {
+func (cli *Client) cmd(ctx context.Context, command string) (_ *upsCmdResult, err error) {
+	defer func() { err = withCtxErr(ctx, err) }()
+
 	// connect
-	sshClient, err := ssh.Dial("tcp", cli.hostname, cli.sshCfg)
+	sshClient, err := cli.dial(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial client (%w)", err)
 	}
@@ -61,28 +52,19 @@ func (cli *Client) cmd(command string) (*upsCmdResult, error) {
 		return nil, fmt.Errorf("failed to start shell (%w)", err)
 	}
 
-	// use a timer to close the session early in case Scan() hangs (which can
-	// happen if the UPS provides output this app does not understand)
-	cancelAbort := make(chan struct{})
-	defer close(cancelAbort)
-	go func() {
-		select {
-		case <-time.After(shellTimeoutLogin):
-			_ = session.Close()
-
-		case <-cancelAbort:
-			// aborted cancel (i.e., succesful Scan())
-		}
-	}()
+	// close the session early in case Scan() hangs (which can happen if the
+	// UPS provides output this app does not understand)
+	loginCtx, cancelLogin := context.WithTimeout(ctx, cli.loginTimeout)
+	defer cancelLogin()
+	stopAbort := context.AfterFunc(loginCtx, func() { _ = session.Close() })
 
 	// check shell response after connect
 	scannedOk := scanner.Scan()
-	// if failed to scan (e.g., timer closed the session after timeout)
+	stopAbort()
+	// if failed to scan (e.g., session closed after timeout)
 	if !scannedOk {
-		return nil, errors.New("shell did not return parsable login response")
+		return nil, withCtxErr(loginCtx, errors.New("shell did not return parsable login response"))
 	}
-	// success; cancel abort timer
-	cancelAbort <- struct{}{}
 	// discard the initial shell response (login message(s) / initial shell prompt)
 	_ = scanner.Bytes()
 
@@ -92,28 +74,20 @@ func (cli *Client) cmd(command string) (*upsCmdResult, error) {
 		return nil, fmt.Errorf("failed to send shell command (%w)", err)
 	}
 
-	// use a timer to close the session early in case Scan() hangs (which can
-	// happen if the UPS provides output this app does not understand);
-	// since initial login message Scan() was okay, it is relatively unlikely this
-	// will hang
-	go func() {
-		select {
-		case <-time.After(shellTimeoutCmd):
-			_ = session.Close()
-
-		case <-cancelAbort:
-			// aborted cancel (i.e., succesful Scan())
-		}
-	}()
+	// close the session early in case Scan() hangs (which can happen if the
+	// UPS provides output this app does not understand); since initial login
+	// message Scan() was okay, it is relatively unlikely this will hang
+	cmdCtx, cancelCmd := context.WithTimeout(ctx, cli.cmdTimeout)
+	defer cancelCmd()
+	stopAbort = context.AfterFunc(cmdCtx, func() { _ = session.Close() })
 
 	// check shell response to command
 	scannedOk = scanner.Scan()
-	// if failed to scan (e.g., timer closed the session after timeout)
+	stopAbort()
+	// if failed to scan (e.g., session closed after timeout)
 	if !scannedOk {
-		return nil, fmt.Errorf("shell did not return parsable response to cmd '%s'", command)
+		return nil, withCtxErr(cmdCtx, fmt.Errorf("shell did not return parsable response to cmd '%s'", command))
 	}
-	// success; cancel abort timer
-	cancelAbort <- struct{}{}
 
 	// parse the UPS response into result struct and return
 	upsRawResponse := string(scanner.Bytes())
@@ -1,6 +1,7 @@
 package apcssh
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -8,56 +9,88 @@ import (
 
 var errSSLMissingData = errors.New("apcssh: ssl cert install: cant install nil data (unsupported key/nmc version/nmc firmware combo?)")
 
+// paths of the ssl files on the UPS
+const (
+	sslKeyPath        = "/ssl/nmc.key"
+	sslCertPath       = "/ssl/nmc.crt"
+	sslLegacyFilePath = "/ssl/defaultcert.p15"
+)
+
+// InstallMethod is the method used to install the ssl key and cert
+type InstallMethod int
+
+const (
+	InstallMethodUnknown InstallMethod = iota
+	// UPS `ssl` command (e.g., NMC3 with newer firmware)
+	InstallMethodSSLCmd
+	// upload of the p15 key+cert file (e.g., NMC2)
+	InstallMethodLegacy
+)
+
+// String returns the install method in a log friendly string format.
+func (method InstallMethod) String() string {
+	switch method {
+	case InstallMethodSSLCmd:
+		return "ssl"
+	case InstallMethodLegacy:
+		return "scp"
+
+	default:
+	}
+
+	return "unknown"
+}
+
 // InstallSSLCert installs the specified p15 key and p15 cert files on the
 // UPS. It has logic to deduce if the NMC is a newer version (e.g., NMC3 with
-// newer firmware) and acts accordingly.
-func (cli *Client) InstallSSLCert(keyP15 []byte, certPem []byte, keyCertP15 []byte) error {
+// newer firmware) and acts accordingly. The method that was used (or would
+// have been used, if an error is returned after it was determined) is
+// returned.
+func (cli *Client) InstallSSLCert(ctx context.Context, keyP15 []byte, certPem []byte, keyCertP15 []byte) (InstallMethod, error) {
 	// run `ssl` command to check if it exists
-	result, err := cli.cmd("ssl")
+	supportsSSLCmd, err := cli.supportsSSLCmd(ctx)
 	if err != nil {
-		return fmt.Errorf("apcssh: ssl cert install: failed to test ssl cmd (%w)", err)
+		return InstallMethodUnknown, fmt.Errorf("apcssh: ssl cert install: failed to test ssl cmd (%w)", err)
 	}
-	// E101 is the code for "Command Not Found"
-	supportsSSLCmd := !strings.EqualFold(result.code, "e101")
 
 	// if SSL is supported, use that method
 	if supportsSSLCmd {
-		return cli.installSSLCertModern(keyP15, certPem)
+		return InstallMethodSSLCmd, cli.installSSLCertModern(ctx, keyP15, certPem)
 	}
 
 	// fallback to legacy
-	return cli.installSSLCertLegacy(keyCertP15)
+	return InstallMethodLegacy, cli.installSSLCertLegacy(ctx, keyCertP15)
 }
 
 // installSSLCertModern installs the SSL key and certificate using the UPS built-in
 // command `ssl`. This command is not present on older devices (e.g., NMC2) or firmwares.
-func (cli *Client) installSSLCertModern(keyP15 []byte, certPem []byte) error {
+func (cli *Client) installSSLCertModern(ctx context.Context, keyP15 []byte, certPem []byte) error {
 	// fail if required data isn't present
 	if len(keyP15) <= 0 || len(certPem) <= 0 {
 		return errSSLMissingData
 	}
 
 	// upload the key P15 file
-	err := cli.UploadSCP("/ssl/nmc.key", keyP15, 0600)
+	err := cli.UploadSCP(ctx, sslKeyPath, keyP15, 0600)
 	if err != nil {
 		return fmt.Errorf("apcssh: ssl cert install: failed to send nmc.key file to ups over scp (%w)", err)
 	}
 
 	// upload the cert PEM file
-	err = cli.UploadSCP("/ssl/nmc.crt", certPem, 0666)
+	err = cli.UploadSCP(ctx, sslCertPath, certPem, 0666)
 	if err != nil {
 		return fmt.Errorf("apcssh: ssl cert install: failed to send nmc.key file to ups over scp (%w)", err)
 	}
 
 	// run `ssl` install commands
-	result, err := cli.cmd("ssl key -i /ssl/nmc.key")
+	result, err := cli.cmd(ctx, "ssl key -i "+sslKeyPath)
 	if err != nil {
 		return fmt.Errorf("apcssh: ssl cert install: failed to send ssl key install cmd (%w)", err)
 	} else if !strings.EqualFold(result.code, "e000") {
 		return fmt.Errorf("apcssh: ssl cert install: ssl key install cmd returned error code (%s: %s)", result.code, result.codeText)
 	}
 
-	result, err = cli.cmd("ssl cert -i /ssl/nmc.crt")
+	result, err = cli.cmd(ctx, "ssl cert -i "+sslCertPath)
 	if err != nil {
 		return fmt.Errorf("apcssh: ssl cert install: failed to send ssl cert install cmd (%w)", err)
 	} else if !strings.EqualFold(result.code, "e000") {
@@ -70,14 +103,14 @@ func (cli *Client) installSSLCertModern(keyP15 []byte, certPem []byte) error {
 // installSSLCertLegacy installs the SSL key and certificate by directly uploading
 // them to a .p15 file on the UPS. This is used for older devices (e.g., NMC2) and
 // firmwares that do not support the `ssl` command.
-func (cli *Client) installSSLCertLegacy(keyCertP15 []byte) error {
+func (cli *Client) installSSLCertLegacy(ctx context.Context, keyCertP15 []byte) error {
 	// fail if required data isn't present
 	if len(keyCertP15) <= 0 {
 		return errSSLMissingData
 	}
 
 	// upload/install keyCert P15 file
-	err := cli.UploadSCP("/ssl/defaultcert.p15", keyCertP15, 0600)
+	err := cli.UploadSCP(ctx, sslLegacyFilePath, keyCertP15, 0600)
 	if err != nil {
 		return fmt.Errorf("apcssh: ssl cert install: failed to send defaultcert.p15 file to ups over scp (%w)", err)
 	}
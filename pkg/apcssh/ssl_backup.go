@@ -0,0 +1,91 @@
+package apcssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var errSSLBackupIncomplete = errors.New("apcssh: ssl cert restore: backup is incomplete")
+
+// CertBackup is the ssl key and cert as they were on the UPS before a new one
+// was installed
+type CertBackup struct {
+	// Method is the install method the UPS uses (which determines the files)
+	Method InstallMethod
+	// Files maps each UPS path that was downloaded to its content
+	Files map[string][]byte
+	// Missing maps each UPS path that could not be downloaded (e.g., because
+	// it does not exist yet) to the download error
+	Missing map[string]error
+}
+
+// Complete returns true if all of the files of the install method were
+// downloaded (i.e., the backup can be restored)
+func (backup *CertBackup) Complete() bool {
+	return len(backup.Files) > 0 && len(backup.Missing) == 0
+}
+
+// sslFilePaths returns the paths of the files the install method writes
+func sslFilePaths(method InstallMethod) []string {
+	switch method {
+	case InstallMethodSSLCmd:
+		return []string{sslKeyPath, sslCertPath}
+	case InstallMethodLegacy:
+		return []string{sslLegacyFilePath}
+
+	default:
+	}
+
+	return nil
+}
+
+// BackupSSLCert downloads the files that InstallSSLCert would overwrite. A
+// file that can not be downloaded is not an error (see CertBackup.Missing).
+func (cli *Client) BackupSSLCert(ctx context.Context) (*CertBackup, error) {
+	// same install method logic as InstallSSLCert
+	supportsSSLCmd, err := cli.supportsSSLCmd(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("apcssh: ssl cert backup: failed to test ssl cmd (%w)", err)
+	}
+
+	backup := &CertBackup{
+		Method:  InstallMethodLegacy,
+		Files:   map[string][]byte{},
+		Missing: map[string]error{},
+	}
+	if supportsSSLCmd {
+		backup.Method = InstallMethodSSLCmd
+	}
+
+	for _, filePath := range sslFilePaths(backup.Method) {
+		content, err := cli.DownloadSCP(ctx, filePath)
+		if err != nil {
+			backup.Missing[filePath] = err
+			continue
+		}
+
+		backup.Files[filePath] = content
+	}
+
+	return backup, nil
+}
+
+// RestoreSSLCert installs the key and cert of a complete backup, using the
+// backup's install method.
+func (cli *Client) RestoreSSLCert(ctx context.Context, backup *CertBackup) error {
+	if backup == nil || !backup.Complete() {
+		return errSSLBackupIncomplete
+	}
+
+	switch backup.Method {
+	case InstallMethodSSLCmd:
+		return cli.installSSLCertModern(ctx, backup.Files[sslKeyPath], backup.Files[sslCertPath])
+	case InstallMethodLegacy:
+		return cli.installSSLCertLegacy(ctx, backup.Files[sslLegacyFilePath])
+
+	default:
+	}
+
+	return fmt.Errorf("apcssh: ssl cert restore: unknown install method (%s)", backup.Method)
+}
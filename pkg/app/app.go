@@ -6,6 +6,8 @@ import (
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/peterbourgon/ff/v4"
 	"github.com/peterbourgon/ff/v4/ffhelp"
@@ -22,6 +24,8 @@ type app struct {
 	errLogger   *log.Logger
 	cmd         *ff.Command
 	config      *config
+	// events is nil unless json output is enabled
+	events *eventWriter
 }
 
 // actual application start
@@ -33,9 +37,6 @@ func Start(args []string) {
 		errLogger:   log.New(os.Stderr, "", 0),
 	}
 
-	// log start
-	app.stdLogger.Printf("apc-p15-tool v%s", appVersion)
-
 	// get os.Args if args unspecified in func
 	if args == nil {
 		args = os.Args
@@ -49,9 +50,21 @@ func Start(args []string) {
 		app.debugLogger = log.New(os.Stdout, "debug: ", 0)
 	}
 
+	// json output: stdout is only events, text logging moves to stderr
+	if app.config.output != nil && *app.config.output == outputFormatJSON {
+		app.events = newEventWriter(os.Stdout)
+		app.stdLogger.SetOutput(os.Stderr)
+		if app.config.debugLogging != nil && *app.config.debugLogging {
+			app.debugLogger.SetOutput(os.Stderr)
+		}
+	}
+
+	// log start
+	app.stdLogger.Printf("apc-p15-tool v%s", appVersion)
+
 	// deal with config err (after logger re-init)
 	if err != nil {
-		exitCode := 0
+		exitCode := exitCodeOK
 
 		if errors.Is(err, ff.ErrHelp) {
 			// help explicitly requested
@@ -62,24 +75,39 @@ func Start(args []string) {
 			errors.Is(err, ff.ErrNoExec) ||
 			errors.Is(err, ErrExtraArgs) {
 			// other error that suggests user needs to see help
-			exitCode = 1
+			exitCode = exitCodeConfig
 			app.errLogger.Print(err)
 			app.stdLogger.Printf("\n%s\n", ffhelp.Command(app.cmd))
 
 		} else {
 			// any other error
-			exitCode = 1
+			exitCode = exitCodeConfig
 			app.errLogger.Print(err)
 		}
 
+		app.emitResult(exitCode, err)
 		os.Exit(exitCode)
 	}
 
+	// the first interrupt (e.g., ctrl-c) cancels ctx so the command stops
+	// cleanly; after that, the default signal handling is restored so a
+	// second interrupt exits immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	stopInterruptLog := context.AfterFunc(ctx, func() {
+		stop()
+		app.errLogger.Print("interrupted, stopping (interrupt again to exit immediately)")
+	})
+
 	// run it
-	exitCode := 0
-	err = app.cmd.Run(context.Background())
+	err = app.cmd.Run(ctx)
+	interrupted := !stopInterruptLog()
+	stop()
+
+	exitCode := errExitCode(err)
+	if interrupted && err != nil {
+		exitCode = exitCodeInterrupted
+	}
 	if err != nil {
-		exitCode = 1
 		app.errLogger.Print(err)
 
 		// if extra args, show help
@@ -88,6 +116,25 @@ func Start(args []string) {
 		}
 	}
 
+	app.emitResult(exitCode, err)
 	app.stdLogger.Print("apc-p15-tool done")
 	os.Exit(exitCode)
 }
+
+// emitResult emits the final result event (the exit code and error, if any)
+func (app *app) emitResult(exitCode int, err error) {
+	scope := outputScope{}
+	if app.cmd != nil && app.cmd.GetSelected() != nil && app.cmd.GetSelected() != app.cmd {
+		scope = newOutputScope(app.cmd.GetSelected().Name)
+	}
+
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+
+	app.emit(scope, "result", "", message, map[string]any{
+		"ok":        err == nil || errors.Is(err, ff.ErrHelp),
+		"exit_code": exitCode,
+	})
+}
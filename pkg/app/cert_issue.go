@@ -0,0 +1,410 @@
+package app
+
+import (
+	"apc-p15-tool/pkg/nmclint"
+	"apc-p15-tool/pkg/pkcs15"
+	"apc-p15-tool/pkg/tools/asn1obj"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"slices"
+	"time"
+)
+
+const (
+	certIssueDefaultValidDays = 365
+	certIssueMaxValidDays     = 3650
+
+	// certs are backdated slightly to allow for clock skew between this
+	// machine and the nmc
+	certIssueBackdate = 1 * time.Hour
+)
+
+// certIssueCfg contains values common to subcommands that issue a certificate
+// (self-signed or signed by a private ca)
+type certIssueCfg struct {
+	selfSign       *bool
+	caCertFilePath *string
+	caKeyFilePath  *string
+	commonName     *string
+	dnsNames       *[]string
+	ipAddresses    *[]string
+	validDays      *int
+}
+
+// issueRequested returns true if the config requests that a cert be issued
+func (ciCfg *certIssueCfg) issueRequested() bool {
+	return (ciCfg.selfSign != nil && *ciCfg.selfSign) ||
+		(ciCfg.caCertFilePath != nil && *ciCfg.caCertFilePath != "")
+}
+
+// certSigner is a private key that can sign certificates (i.e., the struct
+// returned by the pkcs15 parse functions)
+type certSigner interface {
+	KeyType() pkcs15.KeyType
+	PublicKey() crypto.PublicKey
+	SignCertificate(template, parent *x509.Certificate, publicKey crypto.PublicKey) ([]byte, error)
+}
+
+// certIssuer is the ca that signs an issued cert; if caCert is nil, the cert
+// is self-signed by key
+type certIssuer struct {
+	key    certSigner
+	caCert *x509.Certificate
+}
+
+// targetSupport returns the key types and signing algorithms known to work on
+// the specified target
+func targetSupport(target string) ([]pkcs15.KeyType, []x509.SignatureAlgorithm, error) {
+	switch target {
+	case "nmc2":
+		return nmclint.NMC2KeyTypes, nmclint.NMC2SigningAlgs, nil
+	case "nmc3":
+		return nmclint.NMC3KeyTypes, nmclint.NMC3SigningAlgs, nil
+
+	default:
+	}
+
+	return nil, nil, fmt.Errorf("unknown target (%s)", target)
+}
+
+// isECKeyType returns true if keyType is an ecdsa key type
+func isECKeyType(keyType pkcs15.KeyType) bool {
+	return keyType == pkcs15.KeyTypeECP256 || keyType == pkcs15.KeyTypeECP384 || keyType == pkcs15.KeyTypeECP521
+}
+
+// keyUsageBits returns the keyUsage bits (as used by asn1obj.BitString) that
+// the nmc expects for the key type
+func keyUsageBits(keyType pkcs15.KeyType) string {
+	if isECKeyType(keyType) {
+		return "1" // digitalSignature
+	}
+
+	return "101" // digitalSignature, keyEncipherment
+}
+
+// signingAlgorithmForKey returns the first of the supported signing algorithms
+// that can be used with the key type (x509.UnknownSignatureAlgorithm if none)
+func signingAlgorithmForKey(keyType pkcs15.KeyType, supportedSigningAlgs []x509.SignatureAlgorithm) x509.SignatureAlgorithm {
+	keyAlg := x509.RSA
+	if isECKeyType(keyType) {
+		keyAlg = x509.ECDSA
+	}
+
+	for _, alg := range supportedSigningAlgs {
+		if signatureAlgorithmKeyType(alg) == keyAlg {
+			return alg
+		}
+	}
+
+	return x509.UnknownSignatureAlgorithm
+}
+
+// unsupportedExtension returns the first extension that is not known to work
+// on the nmc (nil if all are okay)
+func unsupportedExtension(extensions []pkix.Extension) *pkix.Extension {
+	for i := range extensions {
+		okOIDs := nmclint.SupportedExtensions
+		if extensions[i].Critical {
+			okOIDs = nmclint.SupportedCriticalExtensions
+		}
+
+		if !slices.ContainsFunc(okOIDs, extensions[i].Id.Equal) {
+			return &extensions[i]
+		}
+	}
+
+	return nil
+}
+
+// subjectAltNames parses the dns and ip list flags and returns the SANs; the
+// common name is added as a SAN if it isn't already one (clients ignore the CN)
+func subjectAltNames(commonName string, dnsFlag, ipFlag *[]string) ([]string, []net.IP, error) {
+	dnsNames := splitListFlag(dnsFlag)
+
+	ipAddresses := []net.IP{}
+	for _, ipString := range splitListFlag(ipFlag) {
+		ip := net.ParseIP(ipString)
+		if ip == nil {
+			return nil, nil, fmt.Errorf("invalid ip address (%s)", ipString)
+		}
+		ipAddresses = append(ipAddresses, ip)
+	}
+
+	if commonName == "" {
+		return dnsNames, ipAddresses, nil
+	}
+
+	if cnIP := net.ParseIP(commonName); cnIP != nil {
+		if !slices.ContainsFunc(ipAddresses, cnIP.Equal) {
+			ipAddresses = append([]net.IP{cnIP}, ipAddresses...)
+		}
+	} else if !slices.Contains(dnsNames, commonName) {
+		dnsNames = append([]string{commonName}, dnsNames...)
+	}
+
+	return dnsNames, ipAddresses, nil
+}
+
+// validDaysValue returns the validated number of days an issued cert should be
+// valid for
+func (ciCfg *certIssueCfg) validDaysValue() (int, error) {
+	days := certIssueDefaultValidDays
+	if ciCfg.validDays != nil {
+		days = *ciCfg.validDays
+	}
+
+	if days < 1 || days > certIssueMaxValidDays {
+		return 0, fmt.Errorf("days must be between 1 and %d (%d)", certIssueMaxValidDays, days)
+	}
+
+	return days, nil
+}
+
+// readKeyFile reads a key file (pem or apc p15, with or without the apc
+// header) and parses it
+func readKeyFile(keyFilePath string) (certSigner, error) {
+	keyFile, err := os.ReadFile(keyFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file %s (%w)", keyFilePath, err)
+	}
+
+	// remove apc header if there is one
+	keyFile, _ = removeFileHeader(keyFile)
+
+	key, err := pkcs15.ParseKeyToPKCS15(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key file %s (%w)", keyFilePath, err)
+	}
+
+	return key, nil
+}
+
+// loadIssuer returns the issuer as specified in the config; if selfSignKey is
+// not nil and the config requests a self-signed cert, selfSignKey is used as the
+// issuer
+func (ciCfg *certIssueCfg) loadIssuer(selfSignKey certSigner) (*certIssuer, error) {
+	selfSign := ciCfg.selfSign != nil && *ciCfg.selfSign
+	caCertFilePath := ""
+	if ciCfg.caCertFilePath != nil {
+		caCertFilePath = *ciCfg.caCertFilePath
+	}
+	caKeyFilePath := ""
+	if ciCfg.caKeyFilePath != nil {
+		caKeyFilePath = *ciCfg.caKeyFilePath
+	}
+
+	if selfSign {
+		if caCertFilePath != "" || caKeyFilePath != "" {
+			return nil, errors.New("both self-sign and ca cert/key specified")
+		}
+		if selfSignKey == nil {
+			return nil, errors.New("self-sign requires a key")
+		}
+
+		return &certIssuer{key: selfSignKey}, nil
+	}
+
+	// private ca
+	if caCertFilePath == "" || caKeyFilePath == "" {
+		return nil, errors.New("ca cert and ca key must both be specified")
+	}
+
+	caCertPem, err := os.ReadFile(caCertFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ca cert file (%w)", err)
+	}
+
+	caCertBlock, _ := pem.Decode(caCertPem)
+	if caCertBlock == nil || caCertBlock.Type != "CERTIFICATE" {
+		return nil, errors.New("ca cert file does not contain a pem certificate")
+	}
+
+	caCert, err := x509.ParseCertificate(caCertBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ca cert (%w)", err)
+	}
+
+	if !caCert.BasicConstraintsValid || !caCert.IsCA {
+		return nil, errors.New("ca cert is not a ca certificate (basicConstraints ca is not true)")
+	}
+	if caCert.KeyUsage != 0 && caCert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, errors.New("ca cert key usage does not permit cert signing")
+	}
+
+	caKey, err := readKeyFile(caKeyFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("ca key: %w", err)
+	}
+
+	// ca key must match ca cert
+	caCertPubKey, ok := caCert.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !caCertPubKey.Equal(caKey.PublicKey()) {
+		return nil, errors.New("ca key does not match ca cert")
+	}
+
+	return &certIssuer{key: caKey, caCert: caCert}, nil
+}
+
+// certIssueRequest is the content of a cert to issue
+type certIssueRequest struct {
+	publicKey   crypto.PublicKey
+	commonName  string
+	dnsNames    []string
+	ipAddresses []net.IP
+	validDays   int
+
+	// target name and its supported key types and signing algorithms
+	target               string
+	supportedKeyTypes    []pkcs15.KeyType
+	supportedSigningAlgs []x509.SignatureAlgorithm
+}
+
+// issue issues a cert as specified in req that follows the same compatibility
+// rules that pemToAPCP15 checks. The cert is returned parsed and in pem format.
+func (issuer *certIssuer) issue(req *certIssueRequest) (*x509.Certificate, []byte, error) {
+	if req.commonName == "" {
+		return nil, nil, errors.New("common name not specified")
+	}
+
+	// subject key
+	keyType := pkcs15.PublicKeyType(req.publicKey)
+	if !slices.Contains(req.supportedKeyTypes, keyType) {
+		return nil, nil, fmt.Errorf("key type %s is not supported by %s", keyType, req.target)
+	}
+
+	// signing alg depends on the issuer's key
+	sigAlg := signingAlgorithmForKey(issuer.key.KeyType(), req.supportedSigningAlgs)
+	if sigAlg == x509.UnknownSignatureAlgorithm {
+		return nil, nil, fmt.Errorf("no known supported signing algorithm for %s issuer key on %s", issuer.key.KeyType(), req.target)
+	}
+
+	// validity
+	notBefore := time.Now().Add(-certIssueBackdate).Truncate(time.Second)
+	notAfter := notBefore.Add(time.Duration(req.validDays) * 24 * time.Hour)
+	if issuer.caCert != nil {
+		if time.Now().After(issuer.caCert.NotAfter) {
+			return nil, nil, errors.New("ca cert is expired")
+		}
+		if notBefore.Before(issuer.caCert.NotBefore) {
+			notBefore = issuer.caCert.NotBefore
+		}
+		// a cert shouldn't outlive its ca
+		if notAfter.After(issuer.caCert.NotAfter) {
+			notAfter = issuer.caCert.NotAfter
+		}
+	}
+
+	// random 128 bit serial (positive)
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to make serial number (%w)", err)
+	}
+	serial.SetBit(serial, 126, 1)
+
+	extKeyUsage, err := asn1.Marshal([]asn1.ObjectIdentifier{oidExtKeyUsageServerAuth})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to make ext key usage extension (%w)", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:       serial,
+		SignatureAlgorithm: sigAlg,
+		Subject: pkix.Name{
+			CommonName: req.commonName,
+		},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+		DNSNames:              req.dnsNames,
+		IPAddresses:           req.ipAddresses,
+		ExtraExtensions: []pkix.Extension{
+			{
+				Id:       oidExtensionKeyUsage,
+				Critical: true,
+				Value:    asn1obj.BitString(keyUsageBits(keyType)),
+			},
+			{
+				Id:    oidExtensionExtKeyUsage,
+				Value: extKeyUsage,
+			},
+		},
+	}
+
+	certPem, err := issuer.key.SignCertificate(template, issuer.caCert, req.publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// verify the cert only uses extensions known to work on the nmc
+	certBlock, _ := pem.Decode(certPem)
+	if certBlock == nil {
+		return nil, nil, errors.New("failed to decode issued cert pem")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse issued cert (%w)", err)
+	}
+
+	if ext := unsupportedExtension(cert.Extensions); ext != nil {
+		return nil, nil, fmt.Errorf("issued cert contains extension %s which may not be supported by nmc (report bug to project repo)", ext.Id)
+	}
+
+	if issuer.caCert != nil {
+		err = cert.CheckSignatureFrom(issuer.caCert)
+		if err != nil {
+			return nil, nil, fmt.Errorf("issued cert signature does not verify with ca cert (%w)", err)
+		}
+	}
+
+	return cert, certPem, nil
+}
+
+// issueForKeyPem issues a cert (as specified in the config) for the key in
+// keyPem; this is used by create and install to make the cert in the same run.
+// The nmc3 rules are used since the key type decides if the result works on
+// nmc2 (and rsa keys are always signed with an nmc2 compatible algorithm).
+func (ciCfg *certIssueCfg) issueForKeyPem(keyPem []byte) ([]byte, error) {
+	key, err := pkcs15.ParseKeyToPKCS15(keyPem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key (%w)", err)
+	}
+
+	issuer, err := ciCfg.loadIssuer(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &certIssueRequest{
+		publicKey:            key.PublicKey(),
+		target:               "nmc3",
+		supportedKeyTypes:    nmclint.NMC3KeyTypes,
+		supportedSigningAlgs: nmclint.NMC3SigningAlgs,
+	}
+
+	if ciCfg.commonName != nil {
+		req.commonName = *ciCfg.commonName
+	}
+
+	req.dnsNames, req.ipAddresses, err = subjectAltNames(req.commonName, ciCfg.dnsNames, ciCfg.ipAddresses)
+	if err != nil {
+		return nil, err
+	}
+
+	req.validDays, err = ciCfg.validDaysValue()
+	if err != nil {
+		return nil, err
+	}
+
+	_, certPem, err := issuer.issue(req)
+	return certPem, err
+}
@@ -22,15 +22,20 @@ func (app *app) cmdCreate(_ context.Context, args []string) error {
 
 	keyPem, certPem, err := app.config.create.keyCertPemCfg.GetPemBytes("create")
 	if err != nil {
-		return err
+		return withExitCode(exitCodeConfig, err)
 	}
 
 	// validation done
 
 	// make p15 files
-	keyFile, apcKeyCertFile, err := app.pemToAPCP15(keyPem, certPem, "create")
+	opts := pemToAPCP15Opts{
+		selfCheck: app.config.create.noSelfCheck == nil || !*app.config.create.noSelfCheck,
+	}
+	opts.verifyChain, opts.caFilePath = app.config.create.chainVerifyOpts()
+
+	keyFile, apcKeyCertFile, _, err := app.pemToAPCP15(keyPem, certPem, opts, "create")
 	if err != nil {
-		return err
+		return withExitCode(exitCodeConfig, err)
 	}
 
 	// determine file name (should already be done by flag parsing, but avoid nil just in case)
@@ -0,0 +1,186 @@
+package app
+
+import (
+	"apc-p15-tool/pkg/pkcs15"
+	"apc-p15-tool/pkg/tools/asn1obj"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	csrDefaultOutFilePath = "apctool.csr.pem"
+)
+
+var (
+	oidExtensionKeyUsage     = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionExtKeyUsage  = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtKeyUsageServerAuth = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}
+)
+
+// signatureAlgorithmKeyType returns the public key algorithm that is used with
+// the signature algorithm
+func signatureAlgorithmKeyType(sigAlg x509.SignatureAlgorithm) x509.PublicKeyAlgorithm {
+	switch sigAlg {
+	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA:
+		return x509.RSA
+	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+		return x509.ECDSA
+
+	default:
+	}
+
+	return x509.UnknownPublicKeyAlgorithm
+}
+
+// splitListFlag splits each of the values of a list flag on commas (so both
+// --dns a --dns b and --dns a,b work) and drops empty values
+func splitListFlag(vals *[]string) []string {
+	split := []string{}
+	if vals == nil {
+		return split
+	}
+
+	for _, val := range *vals {
+		for _, s := range strings.Split(val, ",") {
+			s = strings.TrimSpace(s)
+			if s != "" {
+				split = append(split, s)
+			}
+		}
+	}
+
+	return split
+}
+
+// cmdCsr is the app's command to create a certificate signing request for a
+// private key (pem or apc p15 key file)
+func (app *app) cmdCsr(_ context.Context, args []string) error {
+	// extra args == error
+	if len(args) != 0 {
+		return fmt.Errorf("csr: failed, %w (%d)", ErrExtraArgs, len(args))
+	}
+
+	// must have key file
+	if app.config.csr.keyFilePath == nil || *app.config.csr.keyFilePath == "" {
+		return errors.New("csr: failed, key file not specified")
+	}
+
+	// must have common name
+	if app.config.csr.commonName == nil || *app.config.csr.commonName == "" {
+		return errors.New("csr: failed, common name not specified")
+	}
+	commonName := *app.config.csr.commonName
+
+	// SANs
+	dnsNames, ipAddresses, err := subjectAltNames(commonName, app.config.csr.dnsNames, app.config.csr.ipAddresses)
+	if err != nil {
+		return fmt.Errorf("csr: failed, %w", err)
+	}
+
+	// supported signing algs and key types for target
+	supportedKeyTypes, supportedSigningAlgs, err := targetSupport(*app.config.csr.target)
+	if err != nil {
+		return fmt.Errorf("csr: failed, %w", err)
+	}
+
+	// validation done
+
+	keyFile, err := os.ReadFile(*app.config.csr.keyFilePath)
+	if err != nil {
+		return fmt.Errorf("csr: failed to read key file (%w)", err)
+	}
+
+	// key file can be pem or p15 (remove apc header if there is one)
+	keyFile, _ = removeFileHeader(keyFile)
+
+	p15, err := pkcs15.ParseKeyToPKCS15(keyFile)
+	if err != nil {
+		return fmt.Errorf("csr: failed to parse key file (%w)", err)
+	}
+
+	if !slices.Contains(supportedKeyTypes, p15.KeyType()) {
+		return fmt.Errorf("csr: failed, key type %s is not supported by %s", p15.KeyType(), *app.config.csr.target)
+	}
+
+	// pick the first known good signing alg for the key's type
+	sigAlg := signingAlgorithmForKey(p15.KeyType(), supportedSigningAlgs)
+	if sigAlg == x509.UnknownSignatureAlgorithm {
+		return fmt.Errorf("csr: failed, no known supported signing algorithm for %s key on %s", p15.KeyType(), *app.config.csr.target)
+	}
+
+	// requested extensions (SAN is added automatically from DNSNames and
+	// IPAddresses)
+	extKeyUsage, err := asn1.Marshal([]asn1.ObjectIdentifier{oidExtKeyUsageServerAuth})
+	if err != nil {
+		return fmt.Errorf("csr: failed to make ext key usage extension (%w)", err)
+	}
+
+	template := &x509.CertificateRequest{
+		SignatureAlgorithm: sigAlg,
+		Subject: pkix.Name{
+			CommonName: commonName,
+		},
+		DNSNames:    dnsNames,
+		IPAddresses: ipAddresses,
+		ExtraExtensions: []pkix.Extension{
+			{
+				Id:       oidExtensionKeyUsage,
+				Critical: true,
+				Value:    asn1obj.BitString(keyUsageBits(p15.KeyType())),
+			},
+			{
+				Id:    oidExtensionExtKeyUsage,
+				Value: extKeyUsage,
+			},
+		},
+	}
+
+	csrPem, err := p15.ToPemCSR(template)
+	if err != nil {
+		return fmt.Errorf("csr: %w", err)
+	}
+
+	// verify every extension in the csr is known to work on the nmc
+	csrBlock, _ := pem.Decode(csrPem)
+	if csrBlock == nil {
+		return errors.New("csr: failed to decode generated csr pem")
+	}
+	csr, err := x509.ParseCertificateRequest(csrBlock.Bytes)
+	if err != nil {
+		return fmt.Errorf("csr: failed to parse generated csr (%w)", err)
+	}
+
+	if ext := unsupportedExtension(csr.Extensions); ext != nil {
+		return fmt.Errorf("csr: failed, generated csr contains extension %s which may not be supported by nmc (report bug to project repo)", ext.Id)
+	}
+
+	app.stdLogger.Printf("csr: created csr for %s (key type: %s, signature algorithm: %s)", commonName, p15.KeyType(), sigAlg)
+	for _, dnsName := range dnsNames {
+		app.stdLogger.Printf("csr: subject alt name DNS:%s", dnsName)
+	}
+	for _, ip := range ipAddresses {
+		app.stdLogger.Printf("csr: subject alt name IP:%s", ip)
+	}
+
+	// determine file name (should already be done by flag parsing, but avoid nil just in case)
+	csrFileName := csrDefaultOutFilePath
+	if app.config.csr.outFilePath != nil && *app.config.csr.outFilePath != "" {
+		csrFileName = *app.config.csr.outFilePath
+	}
+
+	err = os.WriteFile(csrFileName, csrPem, 0644)
+	if err != nil {
+		return fmt.Errorf("csr: failed to write csr file (%s)", err)
+	}
+	app.stdLogger.Printf("csr: csr file %s written to disk", csrFileName)
+
+	return nil
+}
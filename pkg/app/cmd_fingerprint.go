@@ -0,0 +1,101 @@
+package app
+
+import (
+	"apc-p15-tool/pkg/apcssh"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// fingerprintDefaultTimeout is the default maximum time to fetch the host key
+const fingerprintDefaultTimeout = 30 * time.Second
+
+// cmdFingerprint is the app's command to fetch and display the ssh host key
+// of an APC UPS (without logging in), and optionally add it to a known_hosts
+// file
+func (app *app) cmdFingerprint(cmdCtx context.Context, args []string) error {
+	// extra args == error
+	if len(args) != 0 {
+		return fmt.Errorf("fingerprint: failed, %w (%d)", ErrExtraArgs, len(args))
+	}
+
+	// must have host
+	if app.config.fingerprint.hostname == nil || *app.config.fingerprint.hostname == "" {
+		return withExitCode(exitCodeConfig, errors.New("fingerprint: failed, apc host not specified"))
+	}
+
+	host := installHost{
+		hostname:       *app.config.fingerprint.hostname,
+		sshPort:        *app.config.fingerprint.sshport,
+		insecureCipher: *app.config.fingerprint.insecureCipher,
+		proxy:          app.config.fingerprint.hostProxy(""),
+	}
+	err := host.proxy.validate()
+	if err != nil {
+		return withExitCode(exitCodeConfig, fmt.Errorf("fingerprint: failed, %w", err))
+	}
+
+	// validation done
+
+	scope := newOutputScope("fingerprint").forHost(host.name(), false)
+
+	host, closeDialer, err := app.withDialer(scope, host)
+	if err != nil {
+		return err
+	}
+	defer closeDialer()
+
+	ctx, cancel := context.WithTimeout(cmdCtx, *app.config.fingerprint.timeout)
+	defer cancel()
+
+	cfg := &apcssh.Config{
+		Hostname:       host.hostname + ":" + strconv.Itoa(host.sshPort),
+		InsecureCipher: host.insecureCipher,
+		Dialer:         host.dialer,
+	}
+
+	hostKey, err := apcssh.FetchHostKey(ctx, cfg)
+	if err != nil {
+		return withExitCode(exitCodeConnect, fmt.Errorf("fingerprint: failed to connect to host (%w)", err))
+	}
+
+	app.stdLogger.Printf("fingerprint: %s host key algorithm: %s", host.name(), hostKey.Algorithm)
+	app.stdLogger.Printf("fingerprint: %s sha256 (b64): %s", host.name(), hostKey.SHA256B64)
+	app.stdLogger.Printf("fingerprint: %s sha256 (hex): %s", host.name(), hostKey.SHA256Hex)
+	app.stdLogger.Printf("fingerprint: %s md5 (as shown in the nmc web ui, NOT acceptable for --fingerprint): %s", host.name(), hostKey.MD5Hex)
+	app.stdLogger.Printf("fingerprint: %s known_hosts: %s", host.name(), hostKey.KnownHostsLine())
+	app.stdLogger.Println("fingerprint: verify the md5 matches the one shown in the nmc web ui before trusting this key")
+
+	app.emit(scope, "fingerprint", "", "", map[string]any{
+		"algorithm":        hostKey.Algorithm,
+		"sha256_b64":       hostKey.SHA256B64,
+		"sha256_hex":       hostKey.SHA256Hex,
+		"md5":              hostKey.MD5Hex,
+		"known_hosts_line": hostKey.KnownHostsLine(),
+	})
+
+	// add to known_hosts file
+	if app.config.fingerprint.knownHostsFile != nil && *app.config.fingerprint.knownHostsFile != "" {
+		knownHostsFile := *app.config.fingerprint.knownHostsFile
+
+		added, err := hostKey.AddToKnownHosts(knownHostsFile)
+		if err != nil {
+			err = fmt.Errorf("fingerprint: failed to add host key to known hosts file (%w)", err)
+			if errors.Is(err, apcssh.ErrHostKeyChanged) {
+				return withExitCode(exitCodeFingerprint, err)
+			}
+			return err
+		}
+
+		if added {
+			app.stdLogger.Printf("fingerprint: %s host key added to %s", host.name(), knownHostsFile)
+		} else {
+			app.stdLogger.Printf("fingerprint: %s host key is already in %s", host.name(), knownHostsFile)
+		}
+		app.emit(scope, "known_hosts", "", "", map[string]any{"file": knownHostsFile, "added": added})
+	}
+
+	return nil
+}
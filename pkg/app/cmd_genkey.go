@@ -0,0 +1,144 @@
+package app
+
+import (
+	"apc-p15-tool/pkg/nmclint"
+	"apc-p15-tool/pkg/pkcs15"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+)
+
+const (
+	genkeyDefaultOutFilePath = "apctool.key.pem"
+)
+
+// genkeyKeyTypes maps the genkey type flag values to key types
+var genkeyKeyTypes = map[string]pkcs15.KeyType{
+	"rsa2048": pkcs15.KeyTypeRSA2048,
+	"rsa3072": pkcs15.KeyTypeRSA3072,
+	"rsa4096": pkcs15.KeyTypeRSA4096,
+	"ecp256":  pkcs15.KeyTypeECP256,
+	"ecp384":  pkcs15.KeyTypeECP384,
+	"ecp521":  pkcs15.KeyTypeECP521,
+}
+
+// writeNewFile writes data to a new file; unlike os.WriteFile, it fails if the
+// file already exists (used to avoid clobbering an existing key)
+func writeNewFile(name string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err1 := f.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+
+	return err
+}
+
+// cmdGenKey is the app's command to generate a new private key (in pem and,
+// optionally, apc p15 key format)
+func (app *app) cmdGenKey(_ context.Context, args []string) error {
+	// extra args == error
+	if len(args) != 0 {
+		return fmt.Errorf("genkey: failed, %w (%d)", ErrExtraArgs, len(args))
+	}
+
+	// key type
+	keyType, ok := genkeyKeyTypes[*app.config.genkey.keyType]
+	if !ok {
+		return fmt.Errorf("genkey: failed, unknown key type (%s)", *app.config.genkey.keyType)
+	}
+
+	// key type must be supported by target
+	var supportedKeyTypes []pkcs15.KeyType
+	switch *app.config.genkey.target {
+	case "nmc2":
+		supportedKeyTypes = nmclint.NMC2KeyTypes
+	case "nmc3":
+		supportedKeyTypes = nmclint.NMC3KeyTypes
+	default:
+		return fmt.Errorf("genkey: failed, unknown target (%s)", *app.config.genkey.target)
+	}
+
+	if !slices.Contains(supportedKeyTypes, keyType) {
+		return fmt.Errorf("genkey: failed, key type %s is not supported by %s", keyType, *app.config.genkey.target)
+	}
+
+	// determine file names (should already be done by flag parsing, but avoid nil just in case)
+	keyFileName := genkeyDefaultOutFilePath
+	if app.config.genkey.outFilePath != nil && *app.config.genkey.outFilePath != "" {
+		keyFileName = *app.config.genkey.outFilePath
+	}
+
+	p15FileName := ""
+	if app.config.genkey.outP15FilePath != nil {
+		p15FileName = *app.config.genkey.outP15FilePath
+	}
+
+	// don't overwrite existing files (check before doing anything so a partial
+	// result isn't written)
+	for _, fileName := range []string{keyFileName, p15FileName} {
+		if fileName == "" {
+			continue
+		}
+
+		_, err := os.Stat(fileName)
+		if err == nil {
+			return fmt.Errorf("genkey: failed, %s already exists (remove it or specify a different file name)", fileName)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("genkey: failed to check %s (%w)", fileName, err)
+		}
+	}
+
+	// validation done
+
+	app.stdLogger.Printf("genkey: generating %s key for %s...", keyType, *app.config.genkey.target)
+
+	p15, err := pkcs15.GenerateKey(keyType)
+	if err != nil {
+		return fmt.Errorf("genkey: %w", err)
+	}
+
+	keyPem, err := p15.ToPemKey(pkcs15.KeyPemFormatPKCS8)
+	if err != nil {
+		return fmt.Errorf("genkey: failed to make key pem (%w)", err)
+	}
+
+	// make p15 key file (if requested)
+	var keyFile []byte
+	if p15FileName != "" {
+		keyFile, err = p15.ToP15Key()
+		if err != nil {
+			return fmt.Errorf("genkey: failed to make p15 key file (%w)", err)
+		}
+
+		// self check
+		err = p15.VerifyP15KeyFile(keyFile)
+		if err != nil {
+			return fmt.Errorf("genkey: self-check of generated p15 key file failed (%w)", err)
+		}
+	}
+
+	// write file(s)
+	err = writeNewFile(keyFileName, keyPem, 0600)
+	if err != nil {
+		return fmt.Errorf("genkey: failed to write key pem file (%w)", err)
+	}
+	app.stdLogger.Printf("genkey: key pem file %s written to disk", keyFileName)
+
+	if p15FileName != "" {
+		err = writeNewFile(p15FileName, keyFile, 0600)
+		if err != nil {
+			return fmt.Errorf("genkey: failed to write apc p15 key file (%w)", err)
+		}
+		app.stdLogger.Printf("genkey: apc p15 key file %s written to disk", p15FileName)
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package app
+
+import (
+	"apc-p15-tool/pkg/pkcs15"
+	"apc-p15-tool/pkg/tools/asn1obj"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// inspectValid returns a log friendly string for a validity check result
+func inspectValid(valid bool) string {
+	if valid {
+		return "valid"
+	}
+	return "INVALID"
+}
+
+// inspectPublicKey returns a log friendly description of a public key
+func inspectPublicKey(publicKey any) string {
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d bits (e=%d)", pub.N.BitLen(), pub.E)
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", pub.Curve.Params().Name)
+
+	default:
+	}
+
+	return fmt.Sprintf("unknown (%T)", publicKey)
+}
+
+// cmdInspect is the app's command to print the apc header and the structure of
+// an apc p15 file (key or key+cert)
+func (app *app) cmdInspect(_ context.Context, args []string) error {
+	// extra args == error
+	if len(args) != 0 {
+		return fmt.Errorf("inspect: failed, %w (%d)", ErrExtraArgs, len(args))
+	}
+
+	// must have in file
+	if app.config.inspect.inFilePath == nil || *app.config.inspect.inFilePath == "" {
+		return errors.New("inspect: failed, p15 file not specified")
+	}
+
+	// validation done
+
+	apcFile, err := os.ReadFile(*app.config.inspect.inFilePath)
+	if err != nil {
+		return fmt.Errorf("inspect: failed to read p15 file (%w)", err)
+	}
+
+	out := app.stdLogger
+
+	out.Printf("file: %s (%d bytes)", *app.config.inspect.inFilePath, len(apcFile))
+
+	// header - a plain p15 file starts with a SEQUENCE; anything else is
+	// decoded as a header (even if invalid) so it can be inspected
+	p15File := apcFile
+	if len(apcFile) >= apcHeaderLen && apcFile[0] != 0x30 {
+		header, err := parseFileHeader(apcFile)
+		if err != nil {
+			return fmt.Errorf("inspect: failed to parse apc header (%w)", err)
+		}
+
+		out.Println("apc header:")
+		out.Printf("  version words: %d, %d", header.version1, header.version2)
+		out.Printf("  tool name: %q", header.toolName)
+		out.Printf("  words at 208, 212: %d, %d", header.unknown1, header.unknown2)
+		out.Printf("  data length: %d [%s]", header.dataLength, inspectValid(header.dataLengthValid))
+		out.Printf("  file checksum: 0x%08x [%s]", header.fileChecksum, inspectValid(header.fileChecksumValid))
+		out.Printf("  header checksum: 0x%08x [%s]", header.headerChecksum, inspectValid(header.headerChecksumValid))
+
+		p15File = apcFile[apcHeaderLen:]
+	} else {
+		out.Println("apc header: not present")
+	}
+
+	// p15 content
+	info, err := pkcs15.InspectP15(p15File)
+	if err != nil {
+		return fmt.Errorf("inspect: failed to parse p15 content (%w)", err)
+	}
+
+	out.Printf("pkcs15 content (version %d):", info.Version)
+
+	for _, obj := range info.Objects {
+		out.Printf("  %s object:", obj.Type)
+		out.Printf("    label: %q", obj.Label)
+
+		if obj.ID != nil {
+			out.Printf("    id: %s", hex.EncodeToString(obj.ID))
+		}
+
+		for _, keyId := range obj.KeyIDs {
+			out.Printf("    key id %d (%s): %s", keyId.IDType, keyId, hex.EncodeToString(keyId.Value))
+		}
+
+		if obj.Usage != nil {
+			out.Printf("    usage: %s", strings.Join(obj.UsageNames(), ", "))
+		}
+
+		if obj.AccessFlags != nil {
+			out.Printf("    access flags: %s", strings.Join(obj.AccessFlagNames(), ", "))
+		}
+
+		if !obj.StartDate.IsZero() {
+			out.Printf("    start date: %s", obj.StartDate.Format(timeLoggingFormat))
+		}
+
+		if !obj.EndDate.IsZero() {
+			out.Printf("    end date: %s", obj.EndDate.Format(timeLoggingFormat))
+		}
+
+		if obj.PublicKey != nil {
+			out.Printf("    public key: %s", inspectPublicKey(obj.PublicKey))
+		}
+
+		if obj.Cert != nil {
+			cert := obj.Cert
+			out.Println("    certificate:")
+			out.Printf("      subject: %s", cert.Subject)
+			out.Printf("      issuer: %s", cert.Issuer)
+			out.Printf("      serial: %s", hex.EncodeToString(cert.SerialNumber.Bytes()))
+			out.Printf("      not before: %s", cert.NotBefore.Format(timeLoggingFormat))
+			out.Printf("      not after: %s", cert.NotAfter.Format(timeLoggingFormat))
+			out.Printf("      public key: %s", inspectPublicKey(cert.PublicKey))
+			out.Printf("      signature algorithm: %s", cert.SignatureAlgorithm)
+
+			sans := []string{}
+			for _, name := range cert.DNSNames {
+				sans = append(sans, "DNS:"+name)
+			}
+			for _, ip := range cert.IPAddresses {
+				sans = append(sans, "IP:"+ip.String())
+			}
+			for _, email := range cert.EmailAddresses {
+				sans = append(sans, "email:"+email)
+			}
+			for _, uri := range cert.URIs {
+				sans = append(sans, "URI:"+uri.String())
+			}
+			if len(sans) > 0 {
+				out.Printf("      subject alt names: %s", strings.Join(sans, ", "))
+			}
+
+			if cert.KeyUsage != 0 {
+				out.Printf("      key usage: 0x%x", int(cert.KeyUsage))
+			}
+
+			for _, ext := range cert.Extensions {
+				out.Printf("      extension: %s (critical: %t)", ext.Id, ext.Critical)
+			}
+		}
+
+		if obj.Envelope != nil {
+			env := obj.Envelope
+			out.Println("    encrypted envelope:")
+			out.Printf("      kdf: %s", asn1obj.OIDName(asn1obj.OIDpkcs5PBKDF2))
+			out.Printf("        prf: %s", asn1obj.OIDName(env.KDFPRF))
+			out.Printf("        salt: %s", hex.EncodeToString(env.KDFSalt))
+			out.Printf("        iterations: %d", env.KDFIterations)
+			if env.KDFKeyLength > 0 {
+				out.Printf("        key length: %d", env.KDFKeyLength)
+			}
+			out.Printf("      key encryption: %s (%d byte encrypted key)", asn1obj.OIDName(env.KEKAlgorithm), env.EncryptedKeyLength)
+			out.Printf("      content: %s (%d byte encrypted content)", asn1obj.OIDName(env.ContentAlgorithm), env.EncryptedContentLength)
+			out.Printf("        encryption: %s", asn1obj.OIDName(env.ContentEncryptionAlgorithm))
+			out.Printf("        mac: %s", asn1obj.OIDName(env.MACAlgorithm))
+		}
+	}
+
+	// decryption result
+	if info.DecryptErr != nil {
+		out.Printf("private key decryption: FAILED (%s)", info.DecryptErr)
+	} else {
+		out.Println("private key decryption: ok (key matches public key / certificate)")
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// cmdInstallAll is the app's command to create apc p15 file content from key
+// and cert pem files and upload the p15 to every APC UPS in an inventory file
+func (app *app) cmdInstallAll(cmdCtx context.Context, args []string) error {
+	// extra args == error
+	if len(args) != 0 {
+		return fmt.Errorf("install-all: failed, %w (%d)", ErrExtraArgs, len(args))
+	}
+
+	// must have inventory
+	if app.config.installAll.inventoryFilePath == nil || *app.config.installAll.inventoryFilePath == "" {
+		return withExitCode(exitCodeConfig, errors.New("install-all: failed, inventory file not specified"))
+	}
+
+	parallel, timeout, err := multiHostOpts("install-all", app.config.installAll.parallel, app.config.installAll.timeout)
+	if err != nil {
+		return err
+	}
+
+	// read and validate all hosts before installing on any of them
+	hosts, err := readInventory(*app.config.installAll.inventoryFilePath, app.config.installAll.installHost())
+	if err != nil {
+		return withExitCode(exitCodeConfig, fmt.Errorf("install-all: failed to read inventory (%w)", err))
+	}
+
+	keyPem, certPem, err := app.config.installAll.keyCertPemCfg.GetPemBytes("install-all")
+	if err != nil {
+		return withExitCode(exitCodeConfig, err)
+	}
+
+	// validation done
+
+	// make p15 file (same for every host)
+	opts := pemToAPCP15Opts{
+		selfCheck:     app.config.installAll.noSelfCheck == nil || !*app.config.installAll.noSelfCheck,
+		fullChain:     app.config.installAll.fullChain != nil && *app.config.installAll.fullChain,
+		failOnWarning: app.config.installAll.failOnWarning != nil && *app.config.installAll.failOnWarning,
+	}
+	opts.verifyChain, opts.caFilePath = app.config.installAll.chainVerifyOpts()
+
+	keyP15, keyCertP15, nmcCertPem, err := app.pemToAPCP15(keyPem, certPem, opts, "install-all")
+	if err != nil {
+		return withExitCode(exitCodeConfig, err)
+	}
+
+	app.stdLogger.Printf("install-all: installing on %d host(s) (parallel: %d, timeout per host: %s)", len(hosts), parallel, timeout)
+
+	// install on each host, at most parallel at a time
+	results := app.runOnHosts(cmdCtx, "install-all", hosts, parallel, timeout, func(ctx context.Context, scope outputScope, host installHost) error {
+		return app.installOnHost(ctx, scope, host, keyP15, keyCertP15, nmcCertPem)
+	})
+
+	failed := app.logHostsSummary("install-all", hosts, results)
+	if failed > 0 {
+		return withExitCode(exitCodeHostsFailed, fmt.Errorf("install-all: failed on %d of %d host(s)", failed, len(hosts)))
+	}
+
+	app.stdLogger.Printf("install-all: installed on all %d host(s)", len(hosts))
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package app
+
+import (
+	"apc-p15-tool/pkg/nmclint"
+	"apc-p15-tool/pkg/pkcs15"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// lintTargets maps the target flag values to nmclint devices
+var lintTargets = map[string]nmclint.Device{
+	"any":  nmclint.DeviceAny,
+	"nmc2": nmclint.DeviceNMC2,
+	"nmc3": nmclint.DeviceNMC3,
+}
+
+// cmdLint is the app's command to check a cert (and optionally its key) for
+// nmc compatibility issues without making a p15 file
+func (app *app) cmdLint(_ context.Context, args []string) error {
+	// extra args == error
+	if len(args) != 0 {
+		return fmt.Errorf("lint: failed, %w (%d)", ErrExtraArgs, len(args))
+	}
+
+	device, ok := lintTargets[*app.config.lint.target]
+	if !ok {
+		return withExitCode(exitCodeConfig, fmt.Errorf("lint: failed, unknown target (%s)", *app.config.lint.target))
+	}
+
+	cert, err := app.config.lint.lintCert()
+	if err != nil {
+		return withExitCode(exitCodeConfig, err)
+	}
+
+	// validation done
+
+	scope := newOutputScope("lint")
+	app.stdLogger.Printf("lint: checking certificate %s (issuer: %s) for target %s", cert.Subject, cert.Issuer, device)
+
+	findings := nmclint.Lint(&nmclint.Input{Cert: cert, Now: time.Now()}, device)
+	for _, finding := range findings {
+		app.stdLogger.Printf("lint: %s [%s] (%s): %s", strings.ToUpper(finding.Severity.String()), finding.ID, finding.Target, finding.Message)
+		app.emit(scope, "finding", finding.ID, finding.Message, findingData(finding))
+	}
+
+	maxSeverity, found := nmclint.MaxSeverity(findings)
+	if !found {
+		app.stdLogger.Printf("lint: no compatibility issues found")
+		return nil
+	}
+
+	app.stdLogger.Printf("lint: %d finding(s)", len(findings))
+
+	if maxSeverity >= nmclint.SeverityWarning {
+		return withExitCode(exitCodeLint, fmt.Errorf("lint: failed, compatibility %ss were found", maxSeverity))
+	}
+
+	return nil
+}
+
+// lintCert returns the cert to lint. If a key is specified, the cert that
+// matches the key is used, otherwise the first cert in the cert pem is used.
+func (kcCfg *keyCertPemCfg) lintCert() (*x509.Certificate, error) {
+	if kcCfg.keySpecified() {
+		keyPem, certPem, err := kcCfg.GetPemBytes("lint")
+		if err != nil {
+			return nil, err
+		}
+
+		p15, err := pkcs15.ParsePEMToPKCS15(keyPem, certPem)
+		if err != nil {
+			return nil, fmt.Errorf("lint: failed to parse pem files (%w)", err)
+		}
+
+		return p15.Cert, nil
+	}
+
+	inFormat, err := kcCfg.getInputFormat("lint")
+	if err != nil {
+		return nil, err
+	}
+
+	certPem, err := kcCfg.getCertPem("lint", inFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	for rest := certPem; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		// skip anything that isn't a cert
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("lint: failed to parse cert (%w)", err)
+		}
+
+		return cert, nil
+	}
+
+	return nil, errors.New("lint: failed, cert pem does not contain a certificate")
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"apc-p15-tool/pkg/apcssh"
+	"apc-p15-tool/pkg/nmclint"
+	"apc-p15-tool/pkg/pkcs15"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// cmdProbe is the app's command to report the capabilities of an APC UPS (or
+// every APC UPS in an inventory file) without changing anything on it
+func (app *app) cmdProbe(cmdCtx context.Context, args []string) error {
+	// extra args == error
+	if len(args) != 0 {
+		return fmt.Errorf("probe: failed, %w (%d)", ErrExtraArgs, len(args))
+	}
+
+	parallel, timeout, err := multiHostOpts("probe", app.config.probe.parallel, app.config.probe.timeout)
+	if err != nil {
+		return err
+	}
+
+	// single host
+	if app.config.probe.inventoryFilePath == nil || *app.config.probe.inventoryFilePath == "" {
+		host := app.config.probe.installHost()
+		err = host.validate()
+		if err != nil {
+			return withExitCode(exitCodeConfig, fmt.Errorf("probe: failed, %w", err))
+		}
+
+		// validation done
+
+		ctx, cancel := context.WithTimeout(cmdCtx, timeout)
+		defer cancel()
+
+		return app.probeHost(ctx, newOutputScope("probe").forHost(host.name(), false), host)
+	}
+
+	// inventory
+	if app.config.probe.hostname != nil && *app.config.probe.hostname != "" {
+		return withExitCode(exitCodeConfig, errors.New("probe: failed, both hostname and inventory specified"))
+	}
+
+	hosts, err := readInventory(*app.config.probe.inventoryFilePath, app.config.probe.installHost())
+	if err != nil {
+		return withExitCode(exitCodeConfig, fmt.Errorf("probe: failed to read inventory (%w)", err))
+	}
+
+	// validation done
+
+	app.stdLogger.Printf("probe: probing %d host(s) (parallel: %d, timeout per host: %s)", len(hosts), parallel, timeout)
+
+	results := app.runOnHosts(cmdCtx, "probe", hosts, parallel, timeout, app.probeHost)
+
+	failed := app.logHostsSummary("probe", hosts, results)
+	if failed > 0 {
+		return withExitCode(exitCodeHostsFailed, fmt.Errorf("probe: failed on %d of %d host(s)", failed, len(hosts)))
+	}
+
+	return nil
+}
+
+// probeHost connects to the ups, then logs and emits its device info
+func (app *app) probeHost(ctx context.Context, scope outputScope, host installHost) error {
+	host, closeDialer, err := app.withDialer(scope, host)
+	if err != nil {
+		return err
+	}
+	defer closeDialer()
+
+	client, err := app.connectHost(ctx, scope, host)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+
+	info, err := client.Probe(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", scope.logPrefix, err)
+	}
+
+	keyTypes := []string{}
+	for _, keyType := range installMethodKeyTypes(info.InstallMethod()) {
+		keyTypes = append(keyTypes, keyType.String())
+	}
+
+	model := info.Model
+	if model == "" {
+		model = "unknown"
+	}
+
+	app.stdLogger.Printf("%s: generation: %s (model: %s, serial: %s)", scope.logPrefix, info.Generation, model, info.SerialNumber)
+	app.stdLogger.Printf("%s: firmware: %s", scope.logPrefix, info.Firmware())
+	app.stdLogger.Printf("%s: ssl command: %t (install method: %s)", scope.logPrefix, info.SSLCmd, info.InstallMethod())
+	app.stdLogger.Printf("%s: supported key types: %s", scope.logPrefix, strings.Join(keyTypes, ", "))
+
+	data := map[string]any{
+		"generation":          info.Generation.String(),
+		"model":               info.Model,
+		"serial":              info.SerialNumber,
+		"aos_version":         info.AOSVersion,
+		"application_name":    info.ApplicationName,
+		"application_version": info.ApplicationVersion,
+		"ssl_cmd":             info.SSLCmd,
+		"install_method":      info.InstallMethod().String(),
+		"key_types":           keyTypes,
+	}
+
+	if info.TimeErr != nil {
+		app.stdLogger.Printf("%s: time: unknown (%s)", scope.logPrefix, info.TimeErr)
+	} else {
+		skew := time.Until(info.Time).Round(time.Second)
+		app.stdLogger.Printf("%s: time: %s (time zone: %s, skew vs. this system: %s)", scope.logPrefix, info.Time.Format(timeLoggingFormat), info.TimeZone(), skew)
+
+		data["time"] = info.Time
+		data["time_zone"] = info.TimeZone()
+		data["skew_seconds"] = skew.Seconds()
+	}
+
+	app.emit(scope, "probe", "", "", data)
+
+	return nil
+}
+
+// installMethodKeyTypes returns the key types a ups can use with the install
+// method; the legacy key+cert p15 upload only supports the key types NMC2
+// supports, even on NMC3
+func installMethodKeyTypes(method apcssh.InstallMethod) []pkcs15.KeyType {
+	if method == apcssh.InstallMethodSSLCmd {
+		return nmclint.NMC3KeyTypes
+	}
+
+	return nmclint.NMC2KeyTypes
+}
@@ -0,0 +1,194 @@
+package app
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+const (
+	signDefaultOutFilePath = "apctool.cert.pem"
+)
+
+// issueCfg contains values common to the selfsign and sign subcommands
+type issueCfg struct {
+	certIssueCfg
+	keyFilePath *string
+	target      *string
+	outFilePath *string
+}
+
+// readCsrFile reads and parses a pem csr file and verifies its signature
+func readCsrFile(csrFilePath string) (*x509.CertificateRequest, error) {
+	csrPem, err := os.ReadFile(csrFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read csr file (%w)", err)
+	}
+
+	csrBlock, _ := pem.Decode(csrPem)
+	if csrBlock == nil || (csrBlock.Type != "CERTIFICATE REQUEST" && csrBlock.Type != "NEW CERTIFICATE REQUEST") {
+		return nil, errors.New("csr file does not contain a pem certificate request")
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse csr (%w)", err)
+	}
+
+	err = csr.CheckSignature()
+	if err != nil {
+		return nil, fmt.Errorf("csr signature is invalid (%w)", err)
+	}
+
+	return csr, nil
+}
+
+// issueAndWrite issues the cert for publicKey as specified in the issue config
+// and writes it to the out file; csr (optional) provides a default common name
+// and additional SANs
+func (app *app) issueAndWrite(cmdName string, cfg *issueCfg, issuer *certIssuer, publicKey crypto.PublicKey, csr *x509.CertificateRequest) error {
+	req := &certIssueRequest{
+		publicKey: publicKey,
+		target:    *cfg.target,
+	}
+
+	var err error
+	req.supportedKeyTypes, req.supportedSigningAlgs, err = targetSupport(*cfg.target)
+	if err != nil {
+		return fmt.Errorf("%s: failed, %w", cmdName, err)
+	}
+
+	// common name (flag overrides csr)
+	if cfg.commonName != nil && *cfg.commonName != "" {
+		req.commonName = *cfg.commonName
+	} else if csr != nil {
+		req.commonName = csr.Subject.CommonName
+	}
+	if req.commonName == "" {
+		return fmt.Errorf("%s: failed, common name not specified", cmdName)
+	}
+
+	req.dnsNames, req.ipAddresses, err = subjectAltNames(req.commonName, cfg.dnsNames, cfg.ipAddresses)
+	if err != nil {
+		return fmt.Errorf("%s: failed, %w", cmdName, err)
+	}
+
+	// add SANs from csr
+	if csr != nil {
+		for _, dnsName := range csr.DNSNames {
+			if !slices.Contains(req.dnsNames, dnsName) {
+				req.dnsNames = append(req.dnsNames, dnsName)
+			}
+		}
+		for _, ip := range csr.IPAddresses {
+			if !slices.ContainsFunc(req.ipAddresses, ip.Equal) {
+				req.ipAddresses = append(req.ipAddresses, ip)
+			}
+		}
+	}
+
+	req.validDays, err = cfg.validDaysValue()
+	if err != nil {
+		return fmt.Errorf("%s: failed, %w", cmdName, err)
+	}
+
+	cert, certPem, err := issuer.issue(req)
+	if err != nil {
+		return fmt.Errorf("%s: failed, %w", cmdName, err)
+	}
+
+	app.stdLogger.Printf("%s: issued cert for %s (target: %s, signature algorithm: %s)", cmdName, req.commonName, *cfg.target, cert.SignatureAlgorithm)
+	app.stdLogger.Printf("%s: cert valid from %s to %s", cmdName, cert.NotBefore.Local().Format(timeLoggingFormat), cert.NotAfter.Local().Format(timeLoggingFormat))
+	if issuer.caCert != nil && cert.NotAfter.Equal(issuer.caCert.NotAfter) {
+		app.warn(newOutputScope(cmdName), "cert-validity-shortened", "cert validity was shortened to the ca cert's NotAfter time")
+	}
+	for _, dnsName := range req.dnsNames {
+		app.stdLogger.Printf("%s: subject alt name DNS:%s", cmdName, dnsName)
+	}
+	for _, ip := range req.ipAddresses {
+		app.stdLogger.Printf("%s: subject alt name IP:%s", cmdName, ip)
+	}
+
+	// determine file name (should already be done by flag parsing, but avoid nil just in case)
+	certFileName := signDefaultOutFilePath
+	if cfg.outFilePath != nil && *cfg.outFilePath != "" {
+		certFileName = *cfg.outFilePath
+	}
+
+	err = os.WriteFile(certFileName, certPem, 0644)
+	if err != nil {
+		return fmt.Errorf("%s: failed to write cert file (%w)", cmdName, err)
+	}
+	app.stdLogger.Printf("%s: cert file %s written to disk", cmdName, certFileName)
+
+	return nil
+}
+
+// cmdSelfSign is the app's command to issue a self-signed cert for a private
+// key (pem or apc p15 key file)
+func (app *app) cmdSelfSign(_ context.Context, args []string) error {
+	// extra args == error
+	if len(args) != 0 {
+		return fmt.Errorf("selfsign: failed, %w (%d)", ErrExtraArgs, len(args))
+	}
+
+	// must have key file
+	if app.config.selfsign.keyFilePath == nil || *app.config.selfsign.keyFilePath == "" {
+		return errors.New("selfsign: failed, key file not specified")
+	}
+
+	// validation done
+
+	key, err := readKeyFile(*app.config.selfsign.keyFilePath)
+	if err != nil {
+		return fmt.Errorf("selfsign: %w", err)
+	}
+
+	return app.issueAndWrite("selfsign", &app.config.selfsign, &certIssuer{key: key}, key.PublicKey(), nil)
+}
+
+// cmdSign is the app's command to issue a cert signed by a private ca for a
+// csr or a private key (pem or apc p15 key file)
+func (app *app) cmdSign(_ context.Context, args []string) error {
+	// extra args == error
+	if len(args) != 0 {
+		return fmt.Errorf("sign: failed, %w (%d)", ErrExtraArgs, len(args))
+	}
+
+	// must have exactly one of csr or key file
+	haveCsr := app.config.sign.csrFilePath != nil && *app.config.sign.csrFilePath != ""
+	haveKey := app.config.sign.keyFilePath != nil && *app.config.sign.keyFilePath != ""
+	if haveCsr == haveKey {
+		return errors.New("sign: failed, specify either a csr file or a key file")
+	}
+
+	// validation done
+
+	issuer, err := app.config.sign.loadIssuer(nil)
+	if err != nil {
+		return fmt.Errorf("sign: failed, %w", err)
+	}
+
+	var csr *x509.CertificateRequest
+	var publicKey crypto.PublicKey
+	if haveCsr {
+		csr, err = readCsrFile(*app.config.sign.csrFilePath)
+		if err != nil {
+			return fmt.Errorf("sign: %w", err)
+		}
+		publicKey = csr.PublicKey
+	} else {
+		key, err := readKeyFile(*app.config.sign.keyFilePath)
+		if err != nil {
+			return fmt.Errorf("sign: %w", err)
+		}
+		publicKey = key.PublicKey()
+	}
+
+	return app.issueAndWrite("sign", &app.config.sign.issueCfg, issuer, publicKey, csr)
+}
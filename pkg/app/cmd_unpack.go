@@ -0,0 +1,107 @@
+package app
+
+import (
+	"apc-p15-tool/pkg/pkcs15"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	unpackDefaultOutKeyFilePath  = "apctool.key.pem"
+	unpackDefaultOutCertFilePath = "apctool.cert.pem"
+)
+
+// cmdUnpack is the app's command to convert an apc p15 file (key or key+cert)
+// back into key and cert pem files
+func (app *app) cmdUnpack(_ context.Context, args []string) error {
+	// extra args == error
+	if len(args) != 0 {
+		return fmt.Errorf("unpack: failed, %w (%d)", ErrExtraArgs, len(args))
+	}
+
+	// must have in file
+	if app.config.unpack.inFilePath == nil || *app.config.unpack.inFilePath == "" {
+		return errors.New("unpack: failed, p15 file not specified")
+	}
+
+	// pem format of the output key
+	var keyFormat pkcs15.KeyPemFormat
+	switch *app.config.unpack.keyFormat {
+	case "pkcs8":
+		keyFormat = pkcs15.KeyPemFormatPKCS8
+	case "pkcs1":
+		keyFormat = pkcs15.KeyPemFormatPKCS1
+	case "sec1":
+		keyFormat = pkcs15.KeyPemFormatSEC1
+	default:
+		return fmt.Errorf("unpack: failed, unknown key format (%s)", *app.config.unpack.keyFormat)
+	}
+
+	// validation done
+
+	apcFile, err := os.ReadFile(*app.config.unpack.inFilePath)
+	if err != nil {
+		return fmt.Errorf("unpack: failed to read p15 file (%w)", err)
+	}
+
+	// remove header (if there is one)
+	p15File, headerFound := removeFileHeader(apcFile)
+	if headerFound {
+		app.stdLogger.Println("unpack: apc header found and removed")
+	} else {
+		app.debugLogger.Println("unpack: apc header not found, treating file as plain p15")
+	}
+
+	// parse p15 and decrypt key
+	p15, err := pkcs15.ParseP15ToPKCS15(p15File)
+	if err != nil {
+		return fmt.Errorf("unpack: failed to parse p15 file (%w)", err)
+	}
+
+	app.stdLogger.Printf("unpack: successfully parsed p15 file (key type: %s)", p15.KeyType())
+
+	// make pem files
+	keyPem, err := p15.ToPemKey(keyFormat)
+	if err != nil {
+		return fmt.Errorf("unpack: failed to make key pem (%w)", err)
+	}
+
+	// determine file names (should already be done by flag parsing, but avoid nil just in case)
+	keyFileName := unpackDefaultOutKeyFilePath
+	if app.config.unpack.outKeyFilePath != nil && *app.config.unpack.outKeyFilePath != "" {
+		keyFileName = *app.config.unpack.outKeyFilePath
+	}
+
+	certFileName := unpackDefaultOutCertFilePath
+	if app.config.unpack.outCertFilePath != nil && *app.config.unpack.outCertFilePath != "" {
+		certFileName = *app.config.unpack.outCertFilePath
+	}
+
+	// write file(s)
+	err = os.WriteFile(keyFileName, keyPem, 0600)
+	if err != nil {
+		return fmt.Errorf("unpack: failed to write key pem file (%s)", err)
+	}
+	app.stdLogger.Printf("unpack: key pem file %s (%s) written to disk", keyFileName, keyFormat)
+
+	// skip cert if the p15 didn't contain one (i.e., key file)
+	if p15.Cert == nil {
+		app.stdLogger.Println("unpack: p15 file does not contain a certificate, cert pem file not written")
+		return nil
+	}
+
+	certPem, err := p15.ToPemCert()
+	if err != nil {
+		return fmt.Errorf("unpack: failed to make cert pem (%w)", err)
+	}
+
+	err = os.WriteFile(certFileName, certPem, 0644)
+	if err != nil {
+		return fmt.Errorf("unpack: failed to write cert pem file (%s)", err)
+	}
+	app.stdLogger.Printf("unpack: cert pem file %s written to disk", certFileName)
+
+	return nil
+}
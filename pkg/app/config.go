@@ -1,9 +1,15 @@
 package app
 
 import (
+	"apc-p15-tool/pkg/apcssh"
+	"apc-p15-tool/pkg/pkcs15"
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/peterbourgon/ff/v4"
 )
@@ -14,6 +20,14 @@ var (
 	environmentVarPrefix = "APC_P15_TOOL"
 )
 
+// inputFormats maps the informat flag values to input formats
+var inputFormats = map[string]pkcs15.InputFormat{
+	"auto":   pkcs15.InputFormatAuto,
+	"pem":    pkcs15.InputFormatPEM,
+	"der":    pkcs15.InputFormatDER,
+	"base64": pkcs15.InputFormatBase64,
+}
+
 // keyCertPemCfg contains values common to subcommands that need to use key
 // and cert pem
 type keyCertPemCfg struct {
@@ -21,32 +35,138 @@ type keyCertPemCfg struct {
 	certPemFilePath *string
 	keyPem          *string
 	certPem         *string
+	inFormat        *string
+	keyPassword     *string
+	keyPasswordFile *string
+	pfxFilePath     *string
+	pfxPassword     *string
+	verifyChain     *bool
+	caFilePath      *string
+
+	// issue the cert from the key instead of using cert pem
+	certIssueCfg
+}
+
+// upsHostCfg contains the connection and install options of subcommands that
+// install on a ups
+type upsHostCfg struct {
+	hostname             *string
+	sshport              *int
+	fingerprint          *string
+	knownHostsFile       *string
+	tofu                 *bool
+	username             *string
+	password             *string
+	sshKeyFile           *string
+	sshKeyPassphrase     *string
+	sshAgent             *bool
+	restartWebUI         *bool
+	webUISSLPort         *int
+	skipVerify           *bool
+	insecureCipher       *bool
+	backupDir            *string
+	rollbackOnFailure    *bool
+	onlyIfChanged        *bool
+	onlyIfExpiringWithin *time.Duration
+	verifyTimeout        *time.Duration
+	connectTimeout       *time.Duration
+	loginTimeout         *time.Duration
+	cmdTimeout           *time.Duration
+
+	proxyCfg
+}
+
+// proxyCfg contains the options of subcommands that can reach a ups through
+// jump hosts and/or a socks5 proxy
+type proxyCfg struct {
+	jumpHosts          *[]string
+	jumpFingerprints   *[]string
+	jumpKnownHostsFile *string
+	jumpPassword       *string
+	jumpSSHKeyFile     *string
+	jumpSSHAgent       *bool
+	socks5             *string
 }
 
 // app's config options from user
 type config struct {
-	debugLogging *bool
-	create       struct {
+	debugLogging   *bool
+	output         *string
+	configFilePath *string
+	profile        *string
+	create         struct {
 		keyCertPemCfg
 		outFilePath    *string
 		outKeyFilePath *string
+		noSelfCheck    *bool
 	}
 	install struct {
 		keyCertPemCfg
+		upsHostCfg
+		noSelfCheck   *bool
+		fullChain     *bool
+		failOnWarning *bool
+	}
+	installAll struct {
+		keyCertPemCfg
+		upsHostCfg
+		inventoryFilePath *string
+		parallel          *int
+		timeout           *time.Duration
+		noSelfCheck       *bool
+		fullChain         *bool
+		failOnWarning     *bool
+	}
+	lint struct {
+		keyCertPemCfg
+		target *string
+	}
+	probe struct {
+		upsHostCfg
+		inventoryFilePath *string
+		parallel          *int
+		timeout           *time.Duration
+	}
+	fingerprint struct {
+		proxyCfg
 		hostname       *string
 		sshport        *int
-		fingerprint    *string
-		username       *string
-		password       *string
-		restartWebUI   *bool
-		webUISSLPort   *int
-		skipVerify     *bool
 		insecureCipher *bool
+		knownHostsFile *string
+		timeout        *time.Duration
+	}
+	unpack struct {
+		inFilePath      *string
+		outKeyFilePath  *string
+		outCertFilePath *string
+		keyFormat       *string
+	}
+	inspect struct {
+		inFilePath *string
+	}
+	genkey struct {
+		keyType        *string
+		target         *string
+		outFilePath    *string
+		outP15FilePath *string
+	}
+	csr struct {
+		keyFilePath *string
+		commonName  *string
+		dnsNames    *[]string
+		ipAddresses *[]string
+		target      *string
+		outFilePath *string
+	}
+	selfsign issueCfg
+	sign     struct {
+		issueCfg
+		csrFilePath *string
 	}
 }
 
-// getConfig returns the app's configuration from either command line args,
-// or environment variables
+// getConfig returns the app's configuration from command line args,
+// environment variables, or a config file (in that order of precedence)
 func (app *app) getConfig(args []string) error {
 	// make config
 	cfg := &config{}
@@ -54,13 +174,24 @@ func (app *app) getConfig(args []string) error {
 	// commands:
 	// create
 	// install
-	// TODO:
-	// unpack (both key & key+cert)
+	// install-all
+	// lint
+	// probe
+	// fingerprint
+	// unpack
+	// inspect
+	// genkey
+	// csr
+	// selfsign
+	// sign
 
 	// apc-p15-tool -- root command
 	rootFlags := ff.NewFlagSet("apc-p15-tool")
 
 	cfg.debugLogging = rootFlags.BoolLong("debug", "set this flag to enable additional debug logging messages and files")
+	cfg.output = rootFlags.StringEnumLong("output", "output format: text, or json (one json event per line on stdout; text logging moves to stderr)", outputFormatText, outputFormatJSON)
+	cfg.configFilePath = rootFlags.StringLong("config", "", "path and filename of a yaml or toml config file with a defaults section and named profiles of flag values")
+	cfg.profile = rootFlags.StringLong("profile", "", "name of the config file profile to use (its values replace the config file defaults)")
 
 	rootCmd := &ff.Command{
 		Name:  "apc-p15-tool",
@@ -71,12 +202,12 @@ func (app *app) getConfig(args []string) error {
 	// create -- subcommand
 	createFlags := ff.NewFlagSet("create").SetParent(rootFlags)
 
-	cfg.create.keyPemFilePath = createFlags.StringLong("keyfile", "", "path and filename of the key in pem format")
-	cfg.create.certPemFilePath = createFlags.StringLong("certfile", "", "path and filename of the certificate in pem format")
-	cfg.create.keyPem = createFlags.StringLong("keypem", "", "string of the key in pem format")
-	cfg.create.certPem = createFlags.StringLong("certpem", "", "string of the certificate in pem format")
+	addKeyCertFlags(createFlags, &cfg.create.keyCertPemCfg)
+	addChainVerifyFlags(createFlags, &cfg.create.keyCertPemCfg)
+	addCertIssueFlags(createFlags, &cfg.create.certIssueCfg)
 	cfg.create.outFilePath = createFlags.StringLong("outfile", createDefaultOutFilePath, "path and filename to write the key+cert p15 file to")
 	cfg.create.outKeyFilePath = createFlags.StringLong("outkeyfile", createDefaultOutKeyFilePath, "path and filename to write the key p15 file to")
+	cfg.create.noSelfCheck = createFlags.BoolLong("no-selfcheck", "the tool parses the generated p15 file(s) back and verifies them before writing; this flag disables that check")
 
 	createCmd := &ff.Command{
 		Name:      "create",
@@ -91,19 +222,15 @@ func (app *app) getConfig(args []string) error {
 	// install -- subcommand
 	installFlags := ff.NewFlagSet("install").SetParent(rootFlags)
 
-	cfg.install.keyPemFilePath = installFlags.StringLong("keyfile", "", "path and filename of the key in pem format")
-	cfg.install.certPemFilePath = installFlags.StringLong("certfile", "", "path and filename of the certificate in pem format")
-	cfg.install.keyPem = installFlags.StringLong("keypem", "", "string of the key in pem format")
-	cfg.install.certPem = installFlags.StringLong("certpem", "", "string of the certificate in pem format")
+	addKeyCertFlags(installFlags, &cfg.install.keyCertPemCfg)
+	addChainVerifyFlags(installFlags, &cfg.install.keyCertPemCfg)
+	addCertIssueFlags(installFlags, &cfg.install.certIssueCfg)
 	cfg.install.hostname = installFlags.StringLong("hostname", "", "hostname of the apc ups to install the certificate on")
-	cfg.install.sshport = installFlags.IntLong("sshport", 22, "apc ups ssh port number")
-	cfg.install.fingerprint = installFlags.StringLong("fingerprint", "", "the SHA256 fingerprint value of the ups' ssh server")
-	cfg.install.username = installFlags.StringLong("username", "", "username to login to the apc ups")
-	cfg.install.password = installFlags.StringLong("password", "", "password to login to the apc ups")
-	cfg.install.restartWebUI = installFlags.BoolLong("restartwebui", "some devices may need a webui restart to begin using the new cert, enabling this option sends the restart command after the p15 is installed")
-	cfg.install.webUISSLPort = installFlags.IntLong("sslport", 443, "apc ups ssl webui port number")
-	cfg.install.skipVerify = installFlags.BoolLong("skipverify", "the tool will try to connect to the UPS web UI to verify install success; this flag disables that check")
-	cfg.install.insecureCipher = installFlags.BoolLong("insecurecipher", "allows the use of insecure ssh ciphers (NOT recommended)")
+	addUpsHostFlags(installFlags, &cfg.install.upsHostCfg)
+	addUpsInstallFlags(installFlags, &cfg.install.upsHostCfg)
+	cfg.install.fullChain = installFlags.BoolLong("fullchain", "for devices that install the cert pem (NMC3 ssl cert -i), upload the certificate followed by its chain instead of only the certificate")
+	cfg.install.noSelfCheck = installFlags.BoolLong("no-selfcheck", "the tool parses the generated p15 file(s) back and verifies them before uploading; this flag disables that check")
+	cfg.install.failOnWarning = installFlags.BoolLong("fail-on-warning", "do not install if the certificate has compatibility warnings (see the lint command)")
 
 	installCmd := &ff.Command{
 		Name:      "install",
@@ -115,20 +242,540 @@ func (app *app) getConfig(args []string) error {
 
 	rootCmd.Subcommands = append(rootCmd.Subcommands, installCmd)
 
+	// install-all -- subcommand
+	installAllFlags := ff.NewFlagSet("install-all").SetParent(rootFlags)
+
+	addKeyCertFlags(installAllFlags, &cfg.installAll.keyCertPemCfg)
+	addChainVerifyFlags(installAllFlags, &cfg.installAll.keyCertPemCfg)
+	cfg.installAll.inventoryFilePath = installAllFlags.StringLong("inventory", "", "path and filename of a yaml or toml file listing the apc ups hosts to install the certificate on (the ups flags, e.g. --username, are defaults for hosts that do not specify them)")
+	cfg.installAll.parallel = installAllFlags.IntLong("parallel", multiHostDefaultParallel, "maximum number of hosts to install on at the same time")
+	cfg.installAll.timeout = installAllFlags.DurationLong("timeout", multiHostDefaultTimeout, "maximum time for each host's install, including verification (also limits --verify-timeout) (e.g., 90s or 5m)")
+	addUpsHostFlags(installAllFlags, &cfg.installAll.upsHostCfg)
+	addUpsInstallFlags(installAllFlags, &cfg.installAll.upsHostCfg)
+	cfg.installAll.fullChain = installAllFlags.BoolLong("fullchain", "for devices that install the cert pem (NMC3 ssl cert -i), upload the certificate followed by its chain instead of only the certificate")
+	cfg.installAll.noSelfCheck = installAllFlags.BoolLong("no-selfcheck", "the tool parses the generated p15 file(s) back and verifies them before uploading; this flag disables that check")
+	cfg.installAll.failOnWarning = installAllFlags.BoolLong("fail-on-warning", "do not install on any host if the certificate has compatibility warnings (see the lint command)")
+
+	installAllCmd := &ff.Command{
+		Name:      "install-all",
+		Usage:     "apc-p15-tool install-all --keyfile key.pem --certfile cert.pem --inventory devices.yaml [--parallel 4] [--timeout 5m]",
+		ShortHelp: "install the specified key and cert pem files on every apc ups in an inventory file",
+		Flags:     installAllFlags,
+		Exec:      app.cmdInstallAll,
+	}
+
+	rootCmd.Subcommands = append(rootCmd.Subcommands, installAllCmd)
+
+	// lint -- subcommand
+	lintFlags := ff.NewFlagSet("lint").SetParent(rootFlags)
+
+	addKeyCertFlags(lintFlags, &cfg.lint.keyCertPemCfg)
+	cfg.lint.target = lintFlags.StringEnumLong("target", "the device to check compatibility with: nmc3, nmc2, or any (the findings of every device, so a cert must work on both to pass)", "nmc3", "nmc2", "any")
+
+	lintCmd := &ff.Command{
+		Name:      "lint",
+		Usage:     "apc-p15-tool lint --certfile cert.pem [--keyfile key.pem] [--target nmc3]",
+		ShortHelp: "check the specified cert for nmc compatibility issues (no p15 file is made)",
+		Flags:     lintFlags,
+		Exec:      app.cmdLint,
+	}
+
+	rootCmd.Subcommands = append(rootCmd.Subcommands, lintCmd)
+
+	// probe -- subcommand
+	probeFlags := ff.NewFlagSet("probe").SetParent(rootFlags)
+
+	cfg.probe.hostname = probeFlags.StringLong("hostname", "", "hostname of the apc ups to probe")
+	addUpsHostFlags(probeFlags, &cfg.probe.upsHostCfg)
+	cfg.probe.inventoryFilePath = probeFlags.StringLong("inventory", "", "path and filename of a yaml or toml inventory file (as used by install-all) to probe every host in, instead of --hostname (the ups flags, e.g. --username, are defaults for hosts that do not specify them)")
+	cfg.probe.parallel = probeFlags.IntLong("parallel", multiHostDefaultParallel, "maximum number of inventory hosts to probe at the same time")
+	cfg.probe.timeout = probeFlags.DurationLong("timeout", multiHostDefaultTimeout, "maximum time for each host's probe (e.g., 30s or 2m)")
+
+	probeCmd := &ff.Command{
+		Name:      "probe",
+		Usage:     "apc-p15-tool probe --hostname example.com --fingerprint 123abc --username apc --password test",
+		ShortHelp: "report the nmc generation, firmware, ssl command support, supported key types, and time of an apc ups (or every ups in an inventory)",
+		Flags:     probeFlags,
+		Exec:      app.cmdProbe,
+	}
+
+	rootCmd.Subcommands = append(rootCmd.Subcommands, probeCmd)
+
+	// fingerprint -- subcommand
+	fingerprintFlags := ff.NewFlagSet("fingerprint").SetParent(rootFlags)
+
+	cfg.fingerprint.hostname = fingerprintFlags.StringLong("hostname", "", "hostname of the apc ups to fetch the ssh host key of")
+	cfg.fingerprint.sshport = fingerprintFlags.IntLong("sshport", 22, "apc ups ssh port number")
+	cfg.fingerprint.insecureCipher = fingerprintFlags.BoolLong("insecurecipher", "allows the use of insecure ssh ciphers (NOT recommended)")
+	addProxyFlags(fingerprintFlags, &cfg.fingerprint.proxyCfg)
+	cfg.fingerprint.knownHostsFile = fingerprintFlags.StringLong("knownhosts", "", "path and filename of an OpenSSH known_hosts file to add the host key to (made if it does not exist; a different key already in the file is an error)")
+	cfg.fingerprint.timeout = fingerprintFlags.DurationLong("timeout", fingerprintDefaultTimeout, "maximum time to fetch the host key (e.g., 10s or 1m)")
+
+	fingerprintCmd := &ff.Command{
+		Name:      "fingerprint",
+		Usage:     "apc-p15-tool fingerprint --hostname example.com [--knownhosts known_hosts]",
+		ShortHelp: "fetch and display the ssh host key fingerprints of an apc ups (without logging in) for use with --fingerprint or --knownhosts",
+		Flags:     fingerprintFlags,
+		Exec:      app.cmdFingerprint,
+	}
+
+	rootCmd.Subcommands = append(rootCmd.Subcommands, fingerprintCmd)
+
+	// unpack -- subcommand
+	unpackFlags := ff.NewFlagSet("unpack").SetParent(rootFlags)
+
+	cfg.unpack.inFilePath = unpackFlags.StringLong("infile", "", "path and filename of the apc p15 file to unpack (key or key+cert; the apc header is removed if present)")
+	cfg.unpack.outKeyFilePath = unpackFlags.StringLong("outkeyfile", unpackDefaultOutKeyFilePath, "path and filename to write the key pem file to")
+	cfg.unpack.outCertFilePath = unpackFlags.StringLong("outcertfile", unpackDefaultOutCertFilePath, "path and filename to write the cert pem file to (if the p15 contains a cert)")
+	cfg.unpack.keyFormat = unpackFlags.StringEnumLong("keyformat", "format of the key pem file: pkcs8, pkcs1 (rsa only), or sec1 (ecdsa only)", "pkcs8", "pkcs1", "sec1")
+
+	unpackCmd := &ff.Command{
+		Name:      "unpack",
+		Usage:     "apc-p15-tool unpack --infile apctool.p15 [--outkeyfile apctool.key.pem] [--outcertfile apctool.cert.pem]",
+		ShortHelp: "unpack an apc p15 file back into key and cert pem files",
+		Flags:     unpackFlags,
+		Exec:      app.cmdUnpack,
+	}
+
+	rootCmd.Subcommands = append(rootCmd.Subcommands, unpackCmd)
+
+	// inspect -- subcommand
+	inspectFlags := ff.NewFlagSet("inspect").SetParent(rootFlags)
+
+	cfg.inspect.inFilePath = inspectFlags.StringLong("infile", "", "path and filename of the apc p15 file to inspect (key or key+cert, with or without the apc header)")
+
+	inspectCmd := &ff.Command{
+		Name:      "inspect",
+		Usage:     "apc-p15-tool inspect --infile apctool.p15",
+		ShortHelp: "print the apc header and the structure of an apc p15 file",
+		Flags:     inspectFlags,
+		Exec:      app.cmdInspect,
+	}
+
+	rootCmd.Subcommands = append(rootCmd.Subcommands, inspectCmd)
+
+	// genkey -- subcommand
+	genkeyFlags := ff.NewFlagSet("genkey").SetParent(rootFlags)
+
+	cfg.genkey.keyType = genkeyFlags.StringEnumLong("type", "type of key to generate: rsa2048, rsa3072, rsa4096, ecp256, ecp384, or ecp521", "rsa2048", "rsa3072", "rsa4096", "ecp256", "ecp384", "ecp521")
+	cfg.genkey.target = genkeyFlags.StringEnumLong("target", "the device the key will be used on: nmc2 or nmc3 (key types the target does not support are refused)", "nmc2", "nmc3")
+	cfg.genkey.outFilePath = genkeyFlags.StringLong("outfile", genkeyDefaultOutFilePath, "path and filename to write the key pem file to (an existing file is never overwritten)")
+	cfg.genkey.outP15FilePath = genkeyFlags.StringLong("outp15keyfile", "", "if specified, path and filename to also write the key p15 file to (e.g., apctool.key.p15)")
+
+	genkeyCmd := &ff.Command{
+		Name:      "genkey",
+		Usage:     "apc-p15-tool genkey [--type rsa2048] [--target nmc2] [--outfile apctool.key.pem] [--outp15keyfile apctool.key.p15]",
+		ShortHelp: "generate a new private key that is compatible with the target nmc",
+		Flags:     genkeyFlags,
+		Exec:      app.cmdGenKey,
+	}
+
+	rootCmd.Subcommands = append(rootCmd.Subcommands, genkeyCmd)
+
+	// csr -- subcommand
+	csrFlags := ff.NewFlagSet("csr").SetParent(rootFlags)
+
+	cfg.csr.keyFilePath = csrFlags.StringLong("keyfile", "", "path and filename of the key in pem or apc p15 (e.g., apctool.key.p15) format")
+	cfg.csr.commonName = csrFlags.StringLong("cn", "", "common name of the certificate (also added as a subject alt name)")
+	cfg.csr.dnsNames = csrFlags.StringListLong("dns", "dns subject alt name(s) (comma separated and/or repeated)")
+	cfg.csr.ipAddresses = csrFlags.StringListLong("ip", "ip address subject alt name(s) (comma separated and/or repeated)")
+	cfg.csr.target = csrFlags.StringEnumLong("target", "the device the certificate will be used on: nmc2 or nmc3 (selects the signature algorithm)", "nmc2", "nmc3")
+	cfg.csr.outFilePath = csrFlags.StringLong("outfile", csrDefaultOutFilePath, "path and filename to write the csr pem file to")
+
+	csrCmd := &ff.Command{
+		Name:      "csr",
+		Usage:     "apc-p15-tool csr --keyfile key.pem --cn ups1.example.com [--dns a.example.com,b.example.com] [--ip 10.0.0.5] [--target nmc2]",
+		ShortHelp: "create a certificate signing request (csr) using the specified key",
+		Flags:     csrFlags,
+		Exec:      app.cmdCsr,
+	}
+
+	rootCmd.Subcommands = append(rootCmd.Subcommands, csrCmd)
+
+	// selfsign -- subcommand
+	selfsignFlags := ff.NewFlagSet("selfsign").SetParent(rootFlags)
+
+	cfg.selfsign.keyFilePath = selfsignFlags.StringLong("keyfile", "", "path and filename of the key in pem or apc p15 (e.g., apctool.key.p15) format")
+	addCertSubjectFlags(selfsignFlags, &cfg.selfsign.certIssueCfg)
+	cfg.selfsign.target = selfsignFlags.StringEnumLong("target", "the device the certificate will be used on: nmc2 or nmc3 (selects the signature algorithm)", "nmc2", "nmc3")
+	cfg.selfsign.outFilePath = selfsignFlags.StringLong("outfile", signDefaultOutFilePath, "path and filename to write the cert pem file to")
+
+	selfsignCmd := &ff.Command{
+		Name:      "selfsign",
+		Usage:     "apc-p15-tool selfsign --keyfile key.pem --cn ups1.example.com [--dns a.example.com] [--ip 10.0.0.5] [--days 365] [--target nmc2]",
+		ShortHelp: "issue a self-signed certificate for the specified key",
+		Flags:     selfsignFlags,
+		Exec:      app.cmdSelfSign,
+	}
+
+	rootCmd.Subcommands = append(rootCmd.Subcommands, selfsignCmd)
+
+	// sign -- subcommand
+	signFlags := ff.NewFlagSet("sign").SetParent(rootFlags)
+
+	cfg.sign.caCertFilePath = signFlags.StringLong("ca-cert", "", "path and filename of the private ca's certificate in pem format")
+	cfg.sign.caKeyFilePath = signFlags.StringLong("ca-key", "", "path and filename of the private ca's key in pem format")
+	cfg.sign.csrFilePath = signFlags.StringLong("csrfile", "", "path and filename of the csr in pem format (the common name and SANs of the csr are used unless overridden)")
+	cfg.sign.keyFilePath = signFlags.StringLong("keyfile", "", "path and filename of the key in pem or apc p15 format (alternative to --csrfile)")
+	addCertSubjectFlags(signFlags, &cfg.sign.certIssueCfg)
+	cfg.sign.target = signFlags.StringEnumLong("target", "the device the certificate will be used on: nmc2 or nmc3 (nmc2 requires an rsa ca key)", "nmc2", "nmc3")
+	cfg.sign.outFilePath = signFlags.StringLong("outfile", signDefaultOutFilePath, "path and filename to write the cert pem file to")
+
+	signCmd := &ff.Command{
+		Name:      "sign",
+		Usage:     "apc-p15-tool sign --ca-cert ca.pem --ca-key ca.key.pem (--csrfile apctool.csr.pem | --keyfile key.pem) [--cn ups1.example.com] [--days 365] [--target nmc2]",
+		ShortHelp: "issue a certificate signed by a private ca for the specified csr or key",
+		Flags:     signFlags,
+		Exec:      app.cmdSign,
+	}
+
+	rootCmd.Subcommands = append(rootCmd.Subcommands, signCmd)
+
 	// set cfg & parse
 	app.config = cfg
 	app.cmd = rootCmd
-	err := app.cmd.Parse(args[1:], ff.WithEnvVarPrefix(environmentVarPrefix))
+	err := app.cmd.Parse(args[1:],
+		ff.WithEnvVarPrefix(environmentVarPrefix),
+		ff.WithConfigFileFlag("config"),
+		ff.WithConfigFileParser(configFileParser(cfg.configFilePath, cfg.profile, configFileKnownFlags(rootCmd))),
+	)
+	if err != nil {
+		return err
+	}
+
+	// profile requires config file
+	if *cfg.profile != "" && *cfg.configFilePath == "" {
+		return errors.New("apc-p15-tool: failed, profile specified without a config file")
+	}
+
+	return nil
+}
+
+// daysDuration is a duration flag value that also accepts whole days (e.g.,
+// 30d)
+type daysDuration time.Duration
+
+func (d *daysDuration) Set(s string) error {
+	if days, found := strings.CutSuffix(s, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid number of days (%s)", s)
+		}
+
+		*d = daysDuration(time.Duration(n) * 24 * time.Hour)
+		return nil
+	}
+
+	duration, err := time.ParseDuration(s)
 	if err != nil {
 		return err
 	}
 
+	*d = daysDuration(duration)
 	return nil
 }
 
+func (d *daysDuration) String() string {
+	return formatDuration(time.Duration(*d))
+}
+
+// formatDuration formats d in days if it is a whole number of days (e.g., 30d),
+// otherwise as a time.Duration
+func formatDuration(d time.Duration) string {
+	if d > 0 && d%(24*time.Hour) == 0 {
+		return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+	}
+
+	return d.String()
+}
+
+// daysDurationLong adds a daysDuration flag (default 0) and returns a pointer
+// to its value; like the other ff flag helpers, it panics on error
+func daysDurationLong(fs *ff.FlagSet, name, usage string) *time.Duration {
+	d := new(time.Duration)
+	_, err := fs.AddFlag(ff.FlagConfig{
+		LongName:    name,
+		Usage:       usage,
+		Value:       (*daysDuration)(d),
+		Placeholder: "DURATION",
+		NoDefault:   true,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return d
+}
+
+// addKeyCertFlags adds the flags that specify the key and cert (as pem, der,
+// base64, or pfx)
+func addKeyCertFlags(fs *ff.FlagSet, kcCfg *keyCertPemCfg) {
+	kcCfg.keyPemFilePath = fs.StringLong("keyfile", "", "path and filename of the key in pem format")
+	kcCfg.certPemFilePath = fs.StringLong("certfile", "", "path and filename of the certificate in pem format")
+	kcCfg.keyPem = fs.StringLong("keypem", "", "string of the key in pem format")
+	kcCfg.certPem = fs.StringLong("certpem", "", "string of the certificate in pem format")
+	kcCfg.inFormat = fs.StringEnumLong("informat", "format of the key and cert (file or string): auto (detect), pem, der, or base64 (of der or pem)", "auto", "pem", "der", "base64")
+	kcCfg.keyPassword = fs.StringLong("keypassword", "", "password to decrypt the key if it is encrypted (ENCRYPTED PRIVATE KEY or legacy Proc-Type encrypted pem)")
+	kcCfg.keyPasswordFile = fs.StringLong("keypasswordfile", "", "path and filename of a file containing the password to decrypt the key (alternative to --keypassword)")
+	kcCfg.pfxFilePath = fs.StringLong("pfxfile", "", "path and filename of a pkcs12 (pfx) file containing the key and certificate (alternative to the key and cert pem options)")
+	kcCfg.pfxPassword = fs.StringLong("pfxpassword", "", "password of the pfx file")
+}
+
+// addChainVerifyFlags adds the flags to verify the cert chain
+func addChainVerifyFlags(fs *ff.FlagSet, kcCfg *keyCertPemCfg) {
+	kcCfg.verifyChain = fs.BoolLong("verifychain", "verify the certificate chains to a trusted root (the system roots unless --cafile is specified); chain certificates in the cert pem are used as intermediates")
+	kcCfg.caFilePath = fs.StringLong("cafile", "", "path and filename of a pem bundle of trusted root certificates to verify the certificate chain against (implies --verifychain)")
+}
+
+// addUpsHostFlags adds the flags to connect and login to a ups (including the
+// proxy and ssh timeout flags)
+func addUpsHostFlags(fs *ff.FlagSet, hCfg *upsHostCfg) {
+	hCfg.sshport = fs.IntLong("sshport", 22, "apc ups ssh port number")
+	hCfg.fingerprint = fs.StringLong("fingerprint", "", "the SHA256 fingerprint value of the ups' ssh server")
+	hCfg.knownHostsFile = fs.StringLong("knownhosts", "", "path and filename of an OpenSSH known_hosts file to verify the ups' ssh server key with (alternative to --fingerprint)")
+	hCfg.tofu = fs.BoolLong("tofu", "trust on first use: if a ups is not in the --knownhosts file, add its current key (later key changes are still refused)")
+	hCfg.username = fs.StringLong("username", "", "username to login to the apc ups")
+	hCfg.password = fs.StringLong("password", "", "password to login to the apc ups")
+	hCfg.sshKeyFile = fs.StringLong("sshkeyfile", "", "path and filename of an ssh private key to login to the apc ups with (public key auth, tried before the password)")
+	hCfg.sshKeyPassphrase = fs.StringLong("sshkeypassphrase", "", "passphrase to decrypt the ssh private key if it is encrypted")
+	hCfg.sshAgent = fs.BoolLong("sshagent", "login to the apc ups with the keys of the running ssh-agent (SSH_AUTH_SOCK), tried before the password")
+	hCfg.insecureCipher = fs.BoolLong("insecurecipher", "allows the use of insecure ssh ciphers (NOT recommended)")
+	addProxyFlags(fs, &hCfg.proxyCfg)
+	addSSHTimeoutFlags(fs, hCfg)
+}
+
+// addUpsInstallFlags adds the flags that control how the cert is installed on
+// a ups and how the install is verified
+func addUpsInstallFlags(fs *ff.FlagSet, hCfg *upsHostCfg) {
+	hCfg.restartWebUI = fs.BoolLong("restartwebui", "some devices may need a webui restart to begin using the new cert, enabling this option sends the restart command after the p15 is installed")
+	hCfg.webUISSLPort = fs.IntLong("sslport", 443, "apc ups ssl webui port number")
+	hCfg.skipVerify = fs.BoolLong("skipverify", "the tool will try to connect to the UPS web UI to verify install success; this flag disables that check")
+	hCfg.verifyTimeout = fs.DurationLong("verify-timeout", verifyDefaultTimeout, "maximum time to poll the web ui (with backoff) until it serves the new cert (e.g., 90s or 5m)")
+	hCfg.onlyIfChanged = fs.BoolLong("only-if-changed", "check the cert the web ui serves first and skip the install (and webui restart) if it is already the new cert")
+	hCfg.onlyIfExpiringWithin = daysDurationLong(fs, "only-if-expiring-within", "check the cert the web ui serves first and skip the install unless it expires within this duration (e.g., 30d or 72h)")
+	hCfg.backupDir = fs.StringLong("backup-dir", "", "directory to save the ups' current ssl key and cert files to (downloaded over scp, with a timestamp) before installing")
+	hCfg.rollbackOnFailure = fs.BoolLong("rollback-on-failure", "if the install or its verification fails, restore the ssl key and cert that were on the ups before the install")
+}
+
+// addCertSubjectFlags adds the flags that specify the subject and validity of
+// an issued cert
+func addCertSubjectFlags(fs *ff.FlagSet, ciCfg *certIssueCfg) {
+	ciCfg.commonName = fs.StringLong("cn", "", "common name of the issued certificate (also added as a subject alt name)")
+	ciCfg.dnsNames = fs.StringListLong("dns", "dns subject alt name(s) of the issued certificate (comma separated and/or repeated)")
+	ciCfg.ipAddresses = fs.StringListLong("ip", "ip address subject alt name(s) of the issued certificate (comma separated and/or repeated)")
+	ciCfg.validDays = fs.IntLong("days", certIssueDefaultValidDays, fmt.Sprintf("number of days the issued certificate is valid for (1 - %d)", certIssueMaxValidDays))
+}
+
+// addCertIssueFlags adds the flags for subcommands that can issue the cert
+// from the key instead of using a cert pem
+func addCertIssueFlags(fs *ff.FlagSet, ciCfg *certIssueCfg) {
+	ciCfg.selfSign = fs.BoolLong("selfsign", "issue a self-signed certificate for the key instead of using a cert pem")
+	ciCfg.caCertFilePath = fs.StringLong("ca-cert", "", "issue a certificate for the key signed by this private ca certificate (pem) instead of using a cert pem")
+	ciCfg.caKeyFilePath = fs.StringLong("ca-key", "", "path and filename of the private ca's key in pem format (used with --ca-cert)")
+	addCertSubjectFlags(fs, ciCfg)
+}
+
+// addProxyFlags adds the jump host and socks5 proxy flags to fs
+func addProxyFlags(fs *ff.FlagSet, pCfg *proxyCfg) {
+	pCfg.jumpHosts = fs.StringListLong("jump", "ssh jump host(s) (bastions) to connect to the apc ups through, as [user@]host[:port] (comma separated and/or repeated, in order, like ssh ProxyJump)")
+	pCfg.jumpFingerprints = fs.StringListLong("jump-fingerprint", "the SHA256 fingerprint value(s) of the jump hosts' ssh servers (comma separated and/or repeated, one per jump host, in the same order)")
+	pCfg.jumpKnownHostsFile = fs.StringLong("jump-knownhosts", "", "path and filename of an OpenSSH known_hosts file to verify the jump hosts' ssh server keys with (alternative to --jump-fingerprint; defaults to --knownhosts)")
+	pCfg.jumpPassword = fs.StringLong("jump-password", "", "password to login to the jump host(s)")
+	pCfg.jumpSSHKeyFile = fs.StringLong("jump-sshkeyfile", "", "path and filename of an ssh private key to login to the jump host(s) with")
+	pCfg.jumpSSHAgent = fs.BoolLong("jump-sshagent", "login to the jump host(s) with the keys of the running ssh-agent (SSH_AUTH_SOCK)")
+	pCfg.socks5 = fs.StringLong("socks5", "", "socks5 proxy to connect through (to the first jump host, or else the apc ups and its web ui), as [user[:password]@]host:port")
+}
+
+// addSSHTimeoutFlags adds the timeouts of each ssh step to fs
+func addSSHTimeoutFlags(fs *ff.FlagSet, hCfg *upsHostCfg) {
+	hCfg.connectTimeout = fs.DurationLong("connect-timeout", apcssh.DefaultConnectTimeout, "maximum time to connect and login to the apc ups ssh server, for each connection (e.g., 30s or 2m)")
+	hCfg.loginTimeout = fs.DurationLong("login-timeout", apcssh.DefaultLoginTimeout, "maximum time for the apc ups shell to show its prompt after login (e.g., 20s)")
+	hCfg.cmdTimeout = fs.DurationLong("cmd-timeout", apcssh.DefaultCmdTimeout, "maximum time for each apc ups command or file upload (e.g., 1m or 5m)")
+}
+
+// hostProxy returns the proxy options as a hostProxy; if there are jump hosts,
+// the jump known hosts file defaults to knownHostsFile (unless jump
+// fingerprints are set)
+func (pCfg *proxyCfg) hostProxy(knownHostsFile string) hostProxy {
+	hp := hostProxy{}
+
+	// ProxyJump format is comma separated
+	hp.jumpHosts = splitListFlag(pCfg.jumpHosts)
+	hp.jumpFingerprints = splitListFlag(pCfg.jumpFingerprints)
+	if pCfg.jumpKnownHostsFile != nil {
+		hp.jumpKnownHostsFile = *pCfg.jumpKnownHostsFile
+	}
+	if len(hp.jumpHosts) > 0 && hp.jumpKnownHostsFile == "" && len(hp.jumpFingerprints) == 0 {
+		hp.jumpKnownHostsFile = knownHostsFile
+	}
+	if pCfg.jumpPassword != nil {
+		hp.jumpPassword = *pCfg.jumpPassword
+	}
+	if pCfg.jumpSSHKeyFile != nil {
+		hp.jumpSSHKeyFile = *pCfg.jumpSSHKeyFile
+	}
+	if pCfg.jumpSSHAgent != nil {
+		hp.jumpSSHAgent = *pCfg.jumpSSHAgent
+	}
+	if pCfg.socks5 != nil {
+		hp.socks5 = *pCfg.socks5
+	}
+
+	return hp
+}
+
+// installHost returns the ups options as an installHost (unset options are
+// zero values)
+func (hCfg *upsHostCfg) installHost() installHost {
+	host := installHost{}
+
+	if hCfg.hostname != nil {
+		host.hostname = *hCfg.hostname
+	}
+	if hCfg.sshport != nil {
+		host.sshPort = *hCfg.sshport
+	}
+	if hCfg.fingerprint != nil {
+		host.fingerprint = *hCfg.fingerprint
+	}
+	if hCfg.knownHostsFile != nil {
+		host.knownHostsFile = *hCfg.knownHostsFile
+	}
+	if hCfg.tofu != nil {
+		host.tofu = *hCfg.tofu
+	}
+	if hCfg.username != nil {
+		host.username = *hCfg.username
+	}
+	if hCfg.password != nil {
+		host.password = *hCfg.password
+	}
+	if hCfg.sshKeyFile != nil {
+		host.sshKeyFile = *hCfg.sshKeyFile
+	}
+	if hCfg.sshKeyPassphrase != nil {
+		host.sshKeyPassphrase = *hCfg.sshKeyPassphrase
+	}
+	if hCfg.sshAgent != nil {
+		host.sshAgent = *hCfg.sshAgent
+	}
+	if hCfg.restartWebUI != nil {
+		host.restartWebUI = *hCfg.restartWebUI
+	}
+	if hCfg.webUISSLPort != nil {
+		host.webUISSLPort = *hCfg.webUISSLPort
+	}
+	if hCfg.skipVerify != nil {
+		host.skipVerify = *hCfg.skipVerify
+	}
+	if hCfg.insecureCipher != nil {
+		host.insecureCipher = *hCfg.insecureCipher
+	}
+	if hCfg.backupDir != nil {
+		host.backupDir = *hCfg.backupDir
+	}
+	if hCfg.rollbackOnFailure != nil {
+		host.rollbackOnFailure = *hCfg.rollbackOnFailure
+	}
+	if hCfg.onlyIfChanged != nil {
+		host.onlyIfChanged = *hCfg.onlyIfChanged
+	}
+	if hCfg.onlyIfExpiringWithin != nil {
+		host.onlyIfExpiringWithin = *hCfg.onlyIfExpiringWithin
+	}
+	if hCfg.verifyTimeout != nil {
+		host.verifyTimeout = *hCfg.verifyTimeout
+	}
+	if hCfg.connectTimeout != nil {
+		host.connectTimeout = *hCfg.connectTimeout
+	}
+	if hCfg.loginTimeout != nil {
+		host.loginTimeout = *hCfg.loginTimeout
+	}
+	if hCfg.cmdTimeout != nil {
+		host.cmdTimeout = *hCfg.cmdTimeout
+	}
+	host.proxy = hCfg.hostProxy(host.knownHostsFile)
+
+	return host
+}
+
+// chainVerifyOpts returns if the cert chain should be verified and the ca file
+// to verify against (empty for system roots)
+func (kcCfg *keyCertPemCfg) chainVerifyOpts() (verify bool, caFilePath string) {
+	if kcCfg.caFilePath != nil && *kcCfg.caFilePath != "" {
+		return true, *kcCfg.caFilePath
+	}
+
+	return kcCfg.verifyChain != nil && *kcCfg.verifyChain, ""
+}
+
+// getKeyPassword returns the key password from the arg or file (nil if neither
+// is specified). When read from a file, a trailing newline is removed.
+func (kcCfg *keyCertPemCfg) getKeyPassword() ([]byte, error) {
+	if kcCfg.keyPassword != nil && *kcCfg.keyPassword != "" {
+		// error if filename is also set
+		if kcCfg.keyPasswordFile != nil && *kcCfg.keyPasswordFile != "" {
+			return nil, errors.New("both key password and key password file specified")
+		}
+
+		return []byte(*kcCfg.keyPassword), nil
+	}
+
+	if kcCfg.keyPasswordFile == nil || *kcCfg.keyPasswordFile == "" {
+		return nil, nil
+	}
+
+	password, err := os.ReadFile(*kcCfg.keyPasswordFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key password file (%w)", err)
+	}
+
+	password = bytes.TrimSuffix(password, []byte("\n"))
+	password = bytes.TrimSuffix(password, []byte("\r"))
+	if len(password) == 0 {
+		return nil, errors.New("key password file is empty")
+	}
+
+	return password, nil
+}
+
 // GetPemBytes returns the key and cert pem bytes as specified in keyCertPemCfg
-// or an error if it cant get the bytes of both
+// or an error if it cant get the bytes of both. If cert issuance is requested,
+// the cert is issued from the key.
 func (kcCfg *keyCertPemCfg) GetPemBytes(subcommand string) (keyPem, certPem []byte, err error) {
+	// pfx contains both key and cert
+	if kcCfg.pfxFilePath != nil && *kcCfg.pfxFilePath != "" {
+		// error if any other key or cert source is also set
+		if (kcCfg.keyPem != nil && *kcCfg.keyPem != "") || (kcCfg.keyPemFilePath != nil && *kcCfg.keyPemFilePath != "") ||
+			(kcCfg.certPem != nil && *kcCfg.certPem != "") || (kcCfg.certPemFilePath != nil && *kcCfg.certPemFilePath != "") {
+			return nil, nil, fmt.Errorf("%s: failed, pfx file specified with key or cert pem or file", subcommand)
+		}
+		if (kcCfg.keyPassword != nil && *kcCfg.keyPassword != "") || (kcCfg.keyPasswordFile != nil && *kcCfg.keyPasswordFile != "") {
+			return nil, nil, fmt.Errorf("%s: failed, key password specified with pfx file (use pfx password)", subcommand)
+		}
+		if kcCfg.issueRequested() {
+			return nil, nil, fmt.Errorf("%s: failed, pfx file specified with cert issuance (selfsign or ca-cert)", subcommand)
+		}
+
+		pfx, err := os.ReadFile(*kcCfg.pfxFilePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: failed to read pfx file (%w)", subcommand, err)
+		}
+
+		pfxPassword := ""
+		if kcCfg.pfxPassword != nil {
+			pfxPassword = *kcCfg.pfxPassword
+		}
+
+		keyPem, certPem, err = pkcs15.PFXToPem(pfx, pfxPassword)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: failed to decode pfx file (%w)", subcommand, err)
+		}
+
+		return keyPem, certPem, nil
+	}
+
 	// key pem (from arg or file)
 	if kcCfg.keyPem != nil && *kcCfg.keyPem != "" {
 		// error if filename is also set
@@ -151,11 +798,80 @@ func (kcCfg *keyCertPemCfg) GetPemBytes(subcommand string) (keyPem, certPem []by
 		}
 	}
 
+	// input format (pem, der, base64)
+	inFormat, err := kcCfg.getInputFormat(subcommand)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPem, err = pkcs15.KeyInputToPem(keyPem, inFormat)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: failed to decode key (%w)", subcommand, err)
+	}
+
+	// decrypt key (if password specified)
+	keyPassword, err := kcCfg.getKeyPassword()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: failed, %w", subcommand, err)
+	}
+	if keyPassword != nil {
+		keyPem, err = pkcs15.DecryptPemKey(keyPem, keyPassword)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: failed to decrypt key (%w)", subcommand, err)
+		}
+	}
+
+	// issue cert from key
+	if kcCfg.issueRequested() {
+		// error if cert was also specified
+		if (kcCfg.certPem != nil && *kcCfg.certPem != "") || (kcCfg.certPemFilePath != nil && *kcCfg.certPemFilePath != "") {
+			return nil, nil, fmt.Errorf("%s: failed, cert pem or cert file specified with cert issuance (selfsign or ca-cert)", subcommand)
+		}
+
+		certPem, err = kcCfg.issueForKeyPem(keyPem)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: failed to issue cert (%w)", subcommand, err)
+		}
+
+		return keyPem, certPem, nil
+	}
+
 	// cert pem (repeat same process)
+	certPem, err = kcCfg.getCertPem(subcommand, inFormat)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return keyPem, certPem, nil
+}
+
+// keySpecified returns true if a key source (key pem, key file, or pfx file)
+// is specified
+func (kcCfg *keyCertPemCfg) keySpecified() bool {
+	return (kcCfg.keyPem != nil && *kcCfg.keyPem != "") || (kcCfg.keyPemFilePath != nil && *kcCfg.keyPemFilePath != "") ||
+		(kcCfg.pfxFilePath != nil && *kcCfg.pfxFilePath != "")
+}
+
+// getInputFormat returns the input format of the key and cert
+func (kcCfg *keyCertPemCfg) getInputFormat(subcommand string) (pkcs15.InputFormat, error) {
+	if kcCfg.inFormat == nil {
+		return pkcs15.InputFormatAuto, nil
+	}
+
+	inFormat, ok := inputFormats[*kcCfg.inFormat]
+	if !ok {
+		return pkcs15.InputFormatAuto, fmt.Errorf("%s: failed, unknown input format (%s)", subcommand, *kcCfg.inFormat)
+	}
+
+	return inFormat, nil
+}
+
+// getCertPem returns the cert pem bytes from the cert pem or file
+func (kcCfg *keyCertPemCfg) getCertPem(subcommand string, inFormat pkcs15.InputFormat) (certPem []byte, err error) {
 	if kcCfg.certPem != nil && *kcCfg.certPem != "" {
 		// error if filename is also set
 		if kcCfg.certPemFilePath != nil && *kcCfg.certPemFilePath != "" {
-			return nil, nil, fmt.Errorf("%s: failed, both cert pem and cert file specified", subcommand)
+			return nil, fmt.Errorf("%s: failed, both cert pem and cert file specified", subcommand)
 		}
 
 		// use pem
@@ -163,15 +879,20 @@ func (kcCfg *keyCertPemCfg) GetPemBytes(subcommand string) (keyPem, certPem []by
 	} else {
 		// pem wasn't specified, try reading file
 		if kcCfg.certPemFilePath == nil || *kcCfg.certPemFilePath == "" {
-			return nil, nil, fmt.Errorf("%s: failed, neither cert pem nor cert file specified", subcommand)
+			return nil, fmt.Errorf("%s: failed, neither cert pem nor cert file specified", subcommand)
 		}
 
 		// read file to get pem
 		certPem, err = os.ReadFile(*kcCfg.certPemFilePath)
 		if err != nil {
-			return nil, nil, fmt.Errorf("%s: failed to read cert file (%w)", subcommand, err)
+			return nil, fmt.Errorf("%s: failed to read cert file (%w)", subcommand, err)
 		}
 	}
 
-	return keyPem, certPem, nil
+	certPem, err = pkcs15.CertInputToPem(certPem, inFormat)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to decode cert (%w)", subcommand, err)
+	}
+
+	return certPem, nil
 }
@@ -0,0 +1,169 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/peterbourgon/ff/v4"
+	"github.com/peterbourgon/ff/v4/fftoml"
+	"github.com/peterbourgon/ff/v4/ffyaml"
+)
+
+const (
+	configFileDefaultsSection = "defaults"
+	configFileProfilesSection = "profiles"
+
+	// delimiter for nested keys (profile names may contain dots, e.g.
+	// hostnames)
+	configFileKeyDelimiter = "/"
+)
+
+// configFileOptions maps option name to value(s) (list options such as dns
+// may have more than one value)
+type configFileOptions map[string][]string
+
+// configFileParser returns an ff config file parser that reads a yaml or toml
+// config file consisting of a defaults section and named profiles, e.g.
+//
+//	defaults:
+//	  username: apc
+//	profiles:
+//	  ups-rack3:
+//	    hostname: ups-rack3.example.com
+//
+// The options of the selected profile replace the same options in defaults.
+// Options that exist on some subcommand but not on the one being parsed are
+// skipped, so one profile can be shared by several subcommands.
+func configFileParser(configFilePath, profile *string, knownFlags map[string]struct{}) ff.ConfigFileParseFunc {
+	return func(r io.Reader, set func(name, value string) error) error {
+		// pick parser from the file extension
+		var parse ff.ConfigFileParseFunc
+		switch strings.ToLower(filepath.Ext(*configFilePath)) {
+		case ".yaml", ".yml":
+			parse = ffyaml.Parser{Delimiter: configFileKeyDelimiter}.Parse
+		case ".toml":
+			parse = fftoml.Parser{Delimiter: configFileKeyDelimiter}.Parse
+		default:
+			return errors.New("config file name must end in .yaml, .yml, or .toml")
+		}
+
+		profileName := ""
+		if profile != nil {
+			profileName = *profile
+		}
+
+		// sort options into defaults and profiles
+		defaults := configFileOptions{}
+		profiles := map[string]configFileOptions{}
+
+		err := parse(r, func(key, value string) error {
+			section, rest, _ := strings.Cut(key, configFileKeyDelimiter)
+
+			var options configFileOptions
+			switch section {
+			case configFileDefaultsSection:
+				options = defaults
+
+			case configFileProfilesSection:
+				var name string
+				name, rest, _ = strings.Cut(rest, configFileKeyDelimiter)
+				if name == "" || rest == "" {
+					return fmt.Errorf("profile %q has no options", name)
+				}
+				if _, ok := profiles[name]; !ok {
+					profiles[name] = configFileOptions{}
+				}
+				options = profiles[name]
+
+			default:
+				return fmt.Errorf("unknown section %q (expected %s or %s)", section, configFileDefaultsSection, configFileProfilesSection)
+			}
+
+			if rest == "" || strings.Contains(rest, configFileKeyDelimiter) {
+				return fmt.Errorf("invalid option %q", key)
+			}
+
+			options[rest] = append(options[rest], value)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// merge selected profile over defaults
+		if profileName != "" {
+			profileOptions, ok := profiles[profileName]
+			if !ok {
+				names := []string{}
+				for name := range profiles {
+					names = append(names, name)
+				}
+				slices.Sort(names)
+
+				return fmt.Errorf("profile %q not found (profiles: %s)", profileName, strings.Join(names, ", "))
+			}
+
+			for name, values := range profileOptions {
+				defaults[name] = values
+			}
+		}
+
+		// set flags (in a consistent order)
+		names := []string{}
+		for name := range defaults {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		for _, name := range names {
+			if name == "config" || name == "profile" {
+				return fmt.Errorf("option %q can not be set in the config file", name)
+			}
+			if _, ok := knownFlags[name]; !ok {
+				return fmt.Errorf("unknown option %q", name)
+			}
+
+			for _, value := range defaults[name] {
+				err = set(name, value)
+				// option belongs to a different subcommand
+				if errors.Is(err, ff.ErrUnknownFlag) {
+					break
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+// configFileKnownFlags returns the long names of the flags of cmd and all of
+// its subcommands
+func configFileKnownFlags(cmd *ff.Command) map[string]struct{} {
+	known := map[string]struct{}{}
+
+	var walk func(cmd *ff.Command)
+	walk = func(cmd *ff.Command) {
+		if cmd.Flags != nil {
+			_ = cmd.Flags.WalkFlags(func(f ff.Flag) error {
+				if name, ok := f.GetLongName(); ok {
+					known[name] = struct{}{}
+				}
+				return nil
+			})
+		}
+
+		for _, subcommand := range cmd.Subcommands {
+			walk(subcommand)
+		}
+	}
+	walk(cmd)
+
+	return known
+}
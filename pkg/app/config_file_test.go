@@ -0,0 +1,167 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/peterbourgon/ff/v4"
+)
+
+// testConfigFileFlags are the long names of all flags of the test command and
+// of a (pretend) sibling subcommand that owns cn
+var testConfigFileFlags = map[string]struct{}{
+	"config":   {},
+	"profile":  {},
+	"hostname": {},
+	"username": {},
+	"dns":      {},
+	"cn":       {},
+}
+
+// testConfigFileParse writes content to a config file named fileName and
+// parses it with the given profile into a flag set that has hostname,
+// username, and dns (but not cn)
+func testConfigFileParse(t *testing.T, fileName, content, profile string) (hostname, username string, dns []string, err error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), fileName)
+	err = os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := ff.NewFlagSet("install")
+	configFilePath := fs.StringLong("config", "", "")
+	profilePtr := fs.StringLong("profile", "", "")
+	hostnamePtr := fs.StringLong("hostname", "", "")
+	usernamePtr := fs.StringLong("username", "", "")
+	dnsPtr := fs.StringListLong("dns", "")
+
+	args := []string{"--config", path}
+	if profile != "" {
+		args = append(args, "--profile", profile)
+	}
+
+	err = ff.Parse(fs, args,
+		ff.WithConfigFileFlag("config"),
+		ff.WithConfigFileParser(configFileParser(configFilePath, profilePtr, testConfigFileFlags)),
+	)
+
+	return *hostnamePtr, *usernamePtr, *dnsPtr, err
+}
+
+func TestConfigFileParser(t *testing.T) {
+	yamlConfig := `
+defaults:
+  username: apc
+  hostname: ups.example.com
+  cn: ups.example.com
+  dns:
+    - a.example.com
+profiles:
+  ups-rack3:
+    hostname: ups-rack3.example.com
+    dns:
+      - rack3.example.com
+      - ups-rack3.example.com
+  ups.rack4:
+    username: admin
+`
+	tomlConfig := `
+[defaults]
+username = "apc"
+hostname = "ups.example.com"
+cn = "ups.example.com"
+dns = ["a.example.com"]
+
+[profiles.ups-rack3]
+hostname = "ups-rack3.example.com"
+dns = ["rack3.example.com", "ups-rack3.example.com"]
+
+[profiles."ups.rack4"]
+username = "admin"
+`
+
+	tests := []struct {
+		name         string
+		fileName     string
+		content      string
+		profile      string
+		wantHostname string
+		wantUsername string
+		wantDNS      []string
+		wantErr      string
+	}{
+		{"yaml defaults", "apc.yaml", yamlConfig, "", "ups.example.com", "apc", []string{"a.example.com"}, ""},
+		{"yaml profile over defaults", "apc.yml", yamlConfig, "ups-rack3", "ups-rack3.example.com", "apc", []string{"rack3.example.com", "ups-rack3.example.com"}, ""},
+		{"yaml profile with dot", "apc.yaml", yamlConfig, "ups.rack4", "ups.example.com", "admin", []string{"a.example.com"}, ""},
+		{"yaml unknown profile", "apc.yaml", yamlConfig, "ups-rack9", "", "", nil, `profile "ups-rack9" not found (profiles: ups-rack3, ups.rack4)`},
+		{"toml defaults", "apc.toml", tomlConfig, "", "ups.example.com", "apc", []string{"a.example.com"}, ""},
+		{"toml profile over defaults", "apc.toml", tomlConfig, "ups-rack3", "ups-rack3.example.com", "apc", []string{"rack3.example.com", "ups-rack3.example.com"}, ""},
+		{"toml profile with dot", "apc.toml", tomlConfig, "ups.rack4", "ups.example.com", "admin", []string{"a.example.com"}, ""},
+		{"toml unknown profile", "apc.toml", tomlConfig, "ups-rack9", "", "", nil, `profile "ups-rack9" not found (profiles: ups-rack3, ups.rack4)`},
+		{"yaml option of other subcommand", "apc.yaml", "defaults:\n  cn: ups\n  username: apc\n", "", "", "apc", nil, ""},
+		{"toml option of other subcommand", "apc.toml", "[defaults]\ncn = \"ups\"\nusername = \"apc\"\n", "", "", "apc", nil, ""},
+		{"yaml config in file", "apc.yaml", "defaults:\n  config: other.yaml\n", "", "", "", nil, `option "config" can not be set in the config file`},
+		{"yaml profile in file", "apc.yaml", "defaults:\n  profile: ups-rack3\n", "", "", "", nil, `option "profile" can not be set in the config file`},
+		{"toml config in profile", "apc.toml", "[profiles.a]\nconfig = \"other.toml\"\n", "a", "", "", nil, `option "config" can not be set in the config file`},
+		{"yaml unknown option", "apc.yaml", "defaults:\n  colour: blue\n", "", "", "", nil, `unknown option "colour"`},
+		{"yaml unknown section", "apc.yaml", "hosts:\n  hostname: ups\n", "", "", "", nil, `unknown section "hosts"`},
+		{"toml option outside section", "apc.toml", "hostname = \"ups\"\n", "", "", "", nil, `unknown section "hostname"`},
+		{"yaml nested option", "apc.yaml", "defaults:\n  ssh:\n    username: apc\n", "", "", "", nil, `invalid option "defaults/ssh/username"`},
+		{"bad extension", "apc.json", "{}", "", "", "", nil, "config file name must end in .yaml, .yml, or .toml"},
+	}
+
+	for _, tt := range tests {
+		hostname, username, dns, err := testConfigFileParse(t, tt.fileName, tt.content, tt.profile)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: expected error containing %q (%v)", tt.name, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: parse failed (%s)", tt.name, err)
+			continue
+		}
+
+		if hostname != tt.wantHostname {
+			t.Errorf("%s: hostname is %q (expected %q)", tt.name, hostname, tt.wantHostname)
+		}
+		if username != tt.wantUsername {
+			t.Errorf("%s: username is %q (expected %q)", tt.name, username, tt.wantUsername)
+		}
+		if !slices.Equal(dns, tt.wantDNS) {
+			t.Errorf("%s: dns is %v (expected %v)", tt.name, dns, tt.wantDNS)
+		}
+	}
+}
+
+func TestConfigFileKnownFlags(t *testing.T) {
+	rootFlags := ff.NewFlagSet("root")
+	rootFlags.StringLong("config", "", "")
+	subFlags := ff.NewFlagSet("sub").SetParent(rootFlags)
+	subFlags.StringLong("hostname", "", "")
+	subFlags.BoolLong("debug", "")
+
+	rootCmd := &ff.Command{
+		Name:  "root",
+		Flags: rootFlags,
+		Subcommands: []*ff.Command{
+			{Name: "sub", Flags: subFlags},
+		},
+	}
+
+	known := configFileKnownFlags(rootCmd)
+	for _, name := range []string{"config", "hostname", "debug"} {
+		if _, ok := known[name]; !ok {
+			t.Errorf("flag %q missing from known flags", name)
+		}
+	}
+	if len(known) != 3 {
+		t.Errorf("known flags has %d entries (expected 3)", len(known))
+	}
+}
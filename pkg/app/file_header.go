@@ -1,6 +1,7 @@
 package app
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 
@@ -57,21 +58,108 @@ func makeFileHeader(p15File []byte) ([]byte, error) {
 	binary.LittleEndian.PutUint32(size, uint32(len(p15File)))
 	copy(header[216:], size)
 
-	// check sums (CRC Table)
-	checksumTable := crc16.MakeTable(crc16.CRC16_XMODEM)
-
-	// NOTE: 16 bit checksums are moved to 32 bit int with sign-extension by converting
-	// to int16 and then to uint32
-
 	// file checksum
 	fileChecksum := make([]byte, 4)
-	binary.LittleEndian.PutUint32(fileChecksum, uint32(int16(crc16.Checksum(p15File, checksumTable))))
+	binary.LittleEndian.PutUint32(fileChecksum, apcChecksum(p15File))
 	copy(header[220:], fileChecksum)
 
 	// header checksum
 	headerChecksum := make([]byte, 4)
-	binary.LittleEndian.PutUint32(headerChecksum, uint32(int16(crc16.Checksum(header[:224], checksumTable))))
+	binary.LittleEndian.PutUint32(headerChecksum, apcChecksum(header[:224]))
 	copy(header[224:], headerChecksum)
 
 	return header, nil
 }
+
+// apcChecksum returns the CRC16 (XMODEM) checksum of data in the form used by
+// the APC header
+func apcChecksum(data []byte) uint32 {
+	// check sums (CRC Table)
+	checksumTable := crc16.MakeTable(crc16.CRC16_XMODEM)
+
+	// NOTE: 16 bit checksums are moved to 32 bit int with sign-extension by converting
+	// to int16 and then to uint32
+	return uint32(int16(crc16.Checksum(data, checksumTable)))
+}
+
+// verifyFileHeader checks that apcFile starts with a valid header (as made by
+// makeFileHeader) for the data that follows it. Both checksums are recomputed
+// and compared to the values in the header.
+func verifyFileHeader(apcFile []byte) error {
+	p15File, headerFound := removeFileHeader(apcFile)
+	if !headerFound {
+		return errors.New("apc header not found or has the wrong data length")
+	}
+
+	if binary.LittleEndian.Uint32(apcFile[220:]) != apcChecksum(p15File) {
+		return errors.New("apc header file checksum is incorrect")
+	}
+
+	if binary.LittleEndian.Uint32(apcFile[224:]) != apcChecksum(apcFile[:224]) {
+		return errors.New("apc header checksum is incorrect")
+	}
+
+	return nil
+}
+
+// removeFileHeader checks apcFile for the 228 byte header that is prepended
+// by makeFileHeader. If the header is found, the p15 file without the header
+// is returned. If the header is not found, apcFile is returned unmodified.
+func removeFileHeader(apcFile []byte) (p15File []byte, headerFound bool) {
+	// too short to contain a header and a file
+	if len(apcFile) <= apcHeaderLen {
+		return apcFile, false
+	}
+
+	// always 1 values and the size of the data after the header must match
+	if binary.LittleEndian.Uint32(apcFile[0:]) != 1 ||
+		binary.LittleEndian.Uint32(apcFile[4:]) != 1 ||
+		binary.LittleEndian.Uint32(apcFile[216:]) != uint32(len(apcFile)-apcHeaderLen) {
+		return apcFile, false
+	}
+
+	return apcFile[apcHeaderLen:], true
+}
+
+// apcFileHeader contains the values decoded from an apc header
+type apcFileHeader struct {
+	version1       uint32
+	version2       uint32
+	toolName       string
+	unknown1       uint32
+	unknown2       uint32
+	dataLength     uint32
+	fileChecksum   uint32
+	headerChecksum uint32
+
+	// results of recomputing the values from the file
+	dataLengthValid     bool
+	fileChecksumValid   bool
+	headerChecksumValid bool
+}
+
+// parseFileHeader decodes the header values at the start of apcFile. Unlike
+// removeFileHeader, the values are decoded even if they are not valid (so
+// they can be inspected).
+func parseFileHeader(apcFile []byte) (*apcFileHeader, error) {
+	if len(apcFile) < apcHeaderLen {
+		return nil, errors.New("file is too short to contain an apc header")
+	}
+
+	header := &apcFileHeader{
+		version1:       binary.LittleEndian.Uint32(apcFile[0:]),
+		version2:       binary.LittleEndian.Uint32(apcFile[4:]),
+		toolName:       string(bytes.TrimRight(apcFile[8:208], "\x00")),
+		unknown1:       binary.LittleEndian.Uint32(apcFile[208:]),
+		unknown2:       binary.LittleEndian.Uint32(apcFile[212:]),
+		dataLength:     binary.LittleEndian.Uint32(apcFile[216:]),
+		fileChecksum:   binary.LittleEndian.Uint32(apcFile[220:]),
+		headerChecksum: binary.LittleEndian.Uint32(apcFile[224:]),
+	}
+
+	header.dataLengthValid = header.dataLength == uint32(len(apcFile)-apcHeaderLen)
+	header.fileChecksumValid = header.fileChecksum == apcChecksum(apcFile[apcHeaderLen:])
+	header.headerChecksumValid = header.headerChecksum == apcChecksum(apcFile[:224])
+
+	return header, nil
+}
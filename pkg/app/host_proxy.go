@@ -0,0 +1,202 @@
+package app
+
+import (
+	"apc-p15-tool/pkg/apcssh"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strings"
+)
+
+// hostProxy contains the options to reach a ups through ssh jump hosts
+// (bastions) and/or a socks5 proxy
+type hostProxy struct {
+	// [user@]host[:port] of each jump host, in order
+	jumpHosts []string
+	// host key verification of the jump hosts: one fingerprint per jump host
+	// (in order) or a known_hosts file
+	jumpFingerprints   []string
+	jumpKnownHostsFile string
+	// auth of the jump hosts (the same for each)
+	jumpPassword   string
+	jumpSSHKeyFile string
+	jumpSSHAgent   bool
+	// [user[:password]@]host:port of the socks5 proxy (the first jump host, or
+	// the ups, is connected to through it)
+	socks5 string
+}
+
+// enabled returns true if the ups is reached through a jump host or proxy
+func (hp *hostProxy) enabled() bool {
+	return len(hp.jumpHosts) > 0 || hp.socks5 != ""
+}
+
+// validate returns an error if the proxy options are incomplete
+func (hp *hostProxy) validate() error {
+	if len(hp.jumpHosts) == 0 {
+		if len(hp.jumpFingerprints) > 0 || hp.jumpKnownHostsFile != "" {
+			return errors.New("jump host fingerprints or known hosts file specified without a jump host")
+		}
+		if hp.jumpPassword != "" || hp.jumpSSHKeyFile != "" || hp.jumpSSHAgent {
+			return errors.New("jump host password, ssh key file, or ssh agent specified without a jump host")
+		}
+
+		if hp.socks5 != "" {
+			_, _, _, err := parseSOCKS5(hp.socks5)
+			return err
+		}
+
+		return nil
+	}
+
+	for _, jumpHost := range hp.jumpHosts {
+		_, _, err := parseJumpHost(jumpHost)
+		if err != nil {
+			return err
+		}
+	}
+
+	if hp.jumpKnownHostsFile == "" && len(hp.jumpFingerprints) != len(hp.jumpHosts) {
+		return fmt.Errorf("jump host fingerprints (%d) must be specified for each jump host (%d), or a jump known hosts file", len(hp.jumpFingerprints), len(hp.jumpHosts))
+	}
+	if hp.jumpKnownHostsFile != "" && len(hp.jumpFingerprints) > 0 {
+		return errors.New("both jump host fingerprints and jump known hosts file specified")
+	}
+	if hp.jumpPassword == "" && hp.jumpSSHKeyFile == "" && !hp.jumpSSHAgent {
+		return errors.New("jump host password, ssh key file, or ssh agent not specified")
+	}
+
+	if hp.socks5 != "" {
+		_, _, _, err := parseSOCKS5(hp.socks5)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseJumpHost splits a jump host in OpenSSH ProxyJump format
+// ([user@]host[:port]) into the user (empty if not specified) and host:port
+func parseJumpHost(jumpHost string) (username, hostname string, err error) {
+	username, hostname, found := strings.Cut(jumpHost, "@")
+	if !found {
+		username, hostname = "", jumpHost
+	}
+
+	// port defaults to 22
+	host, port, err := net.SplitHostPort(hostname)
+	if err != nil {
+		host, port = strings.Trim(hostname, "[]"), ""
+	}
+	if port == "" {
+		port = "22"
+	}
+	if host == "" {
+		return "", "", fmt.Errorf("jump host %q has no hostname", jumpHost)
+	}
+
+	return username, net.JoinHostPort(host, port), nil
+}
+
+// parseSOCKS5 splits a socks5 proxy ([user[:password]@]host:port) into its
+// parts
+func parseSOCKS5(socks5 string) (username, password, address string, err error) {
+	// the password may contain @
+	userInfo, address := "", socks5
+	if i := strings.LastIndex(socks5, "@"); i >= 0 {
+		userInfo, address = socks5[:i], socks5[i+1:]
+	}
+	username, password, _ = strings.Cut(userInfo, ":")
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host == "" || port == "" {
+		return "", "", "", fmt.Errorf("socks5 proxy %q is not host:port", address)
+	}
+
+	return username, password, address, nil
+}
+
+// withDialer returns host with its dialer set for its jump hosts and/or socks5
+// proxy (host is returned as-is if it has neither), and a func to close the
+// dialer when done. Errors have an exit code.
+func (app *app) withDialer(scope outputScope, host installHost) (installHost, func(), error) {
+	hp := host.proxy
+	if !hp.enabled() {
+		return host, func() {}, nil
+	}
+
+	var dialer apcssh.Dialer
+
+	// socks5 first (the first jump host is reached through it)
+	if hp.socks5 != "" {
+		username, password, address, err := parseSOCKS5(hp.socks5)
+		if err != nil {
+			return host, nil, withExitCode(exitCodeConfig, fmt.Errorf("%s: failed, %w", scope.logPrefix, err))
+		}
+
+		dialer, err = apcssh.NewSOCKS5Dialer(address, username, password, nil)
+		if err != nil {
+			return host, nil, withExitCode(exitCodeConfig, fmt.Errorf("%s: failed, %w", scope.logPrefix, err))
+		}
+
+		app.debugLogger.Printf("%s: connecting through socks5 proxy %s", scope.logPrefix, address)
+	}
+
+	if len(hp.jumpHosts) == 0 {
+		host.dialer = dialer
+		return host, func() {}, nil
+	}
+
+	// jump hosts
+	agentSocket := ""
+	if hp.jumpSSHAgent {
+		agentSocket = os.Getenv("SSH_AUTH_SOCK")
+		if agentSocket == "" {
+			return host, nil, withExitCode(exitCodeConfig, fmt.Errorf("%s: failed, jump host ssh agent specified but SSH_AUTH_SOCK is not set", scope.logPrefix))
+		}
+	}
+
+	hops := []*apcssh.Config{}
+	for i, jumpHost := range hp.jumpHosts {
+		username, hostname, err := parseJumpHost(jumpHost)
+		if err != nil {
+			return host, nil, withExitCode(exitCodeConfig, fmt.Errorf("%s: failed, %w", scope.logPrefix, err))
+		}
+
+		// like ProxyJump, the user defaults to the local user
+		if username == "" {
+			currentUser, err := user.Current()
+			if err != nil {
+				return host, nil, withExitCode(exitCodeConfig, fmt.Errorf("%s: failed, jump host %s user not specified (%w)", scope.logPrefix, hostname, err))
+			}
+			username = currentUser.Username
+		}
+
+		hop := &apcssh.Config{
+			Hostname:       hostname,
+			Username:       username,
+			Password:       hp.jumpPassword,
+			PrivateKeyFile: hp.jumpSSHKeyFile,
+			AgentSocket:    agentSocket,
+			KnownHostsFile: hp.jumpKnownHostsFile,
+		}
+		if len(hp.jumpFingerprints) > i {
+			hop.ServerFingerprint = hp.jumpFingerprints[i]
+		}
+
+		hops = append(hops, hop)
+	}
+
+	jumpDialer, err := apcssh.NewJumpDialer(hops, dialer)
+	if err != nil {
+		return host, nil, withExitCode(exitCodeConfig, fmt.Errorf("%s: failed, %w", scope.logPrefix, err))
+	}
+
+	app.debugLogger.Printf("%s: connecting through jump host(s) %s", scope.logPrefix, strings.Join(hp.jumpHosts, ", "))
+
+	host.dialer = jumpDialer
+	return host, func() { _ = jumpDialer.Close() }, nil
+}
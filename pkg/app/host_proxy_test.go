@@ -0,0 +1,143 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseJumpHost(t *testing.T) {
+	tests := []struct {
+		jumpHost     string
+		wantUsername string
+		wantHostname string
+	}{
+		{"bastion.example.com", "", "bastion.example.com:22"},
+		{"bastion.example.com:2222", "", "bastion.example.com:2222"},
+		{"admin@bastion.example.com", "admin", "bastion.example.com:22"},
+		{"admin@bastion.example.com:2222", "admin", "bastion.example.com:2222"},
+		{"bastion.example.com:", "", "bastion.example.com:22"},
+		{"10.0.0.5", "", "10.0.0.5:22"},
+		{"[2001:db8::5]:2222", "", "[2001:db8::5]:2222"},
+		{"[2001:db8::5]", "", "[2001:db8::5]:22"},
+		{"2001:db8::5", "", "[2001:db8::5]:22"},
+		{"admin@[2001:db8::5]:2222", "admin", "[2001:db8::5]:2222"},
+	}
+
+	for _, tt := range tests {
+		username, hostname, err := parseJumpHost(tt.jumpHost)
+		if err != nil {
+			t.Errorf("%s: parse failed (%s)", tt.jumpHost, err)
+			continue
+		}
+
+		if username != tt.wantUsername || hostname != tt.wantHostname {
+			t.Errorf("%s: parsed %q, %q (expected %q, %q)", tt.jumpHost, username, hostname, tt.wantUsername, tt.wantHostname)
+		}
+	}
+
+	for _, jumpHost := range []string{"", "admin@", ":2222", "admin@:2222", "[]:2222"} {
+		if _, _, err := parseJumpHost(jumpHost); err == nil {
+			t.Errorf("%q: expected parse error", jumpHost)
+		}
+	}
+}
+
+func TestParseSOCKS5(t *testing.T) {
+	tests := []struct {
+		socks5       string
+		wantUsername string
+		wantPassword string
+		wantAddress  string
+	}{
+		{"proxy.example.com:1080", "", "", "proxy.example.com:1080"},
+		{"alice@proxy.example.com:1080", "alice", "", "proxy.example.com:1080"},
+		{"alice:secret@proxy.example.com:1080", "alice", "secret", "proxy.example.com:1080"},
+		{"alice:se:cr@t@proxy.example.com:1080", "alice", "se:cr@t", "proxy.example.com:1080"},
+		{"[2001:db8::1]:1080", "", "", "[2001:db8::1]:1080"},
+		{"alice:secret@[2001:db8::1]:1080", "alice", "secret", "[2001:db8::1]:1080"},
+	}
+
+	for _, tt := range tests {
+		username, password, address, err := parseSOCKS5(tt.socks5)
+		if err != nil {
+			t.Errorf("%s: parse failed (%s)", tt.socks5, err)
+			continue
+		}
+
+		if username != tt.wantUsername || password != tt.wantPassword || address != tt.wantAddress {
+			t.Errorf("%s: parsed %q, %q, %q (expected %q, %q, %q)", tt.socks5, username, password, address, tt.wantUsername, tt.wantPassword, tt.wantAddress)
+		}
+	}
+
+	for _, socks5 := range []string{"", "proxy.example.com", "proxy.example.com:", ":1080", "alice:secret@proxy.example.com", "2001:db8::1", "[2001:db8::1]", "alice@"} {
+		if _, _, _, err := parseSOCKS5(socks5); err == nil {
+			t.Errorf("%q: expected parse error", socks5)
+		}
+	}
+}
+
+func TestHostProxyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		hp      hostProxy
+		wantErr string
+	}{
+		{"none", hostProxy{}, ""},
+		{"socks5", hostProxy{socks5: "proxy:1080"}, ""},
+		{"socks5 no port", hostProxy{socks5: "proxy"}, "is not host:port"},
+		{"jump fingerprint", hostProxy{jumpHosts: []string{"a", "b"}, jumpFingerprints: []string{"fp1", "fp2"}, jumpPassword: "pw"}, ""},
+		{"jump known hosts", hostProxy{jumpHosts: []string{"a"}, jumpKnownHostsFile: "known_hosts", jumpSSHAgent: true, socks5: "proxy:1080"}, ""},
+		{"jump fingerprint count", hostProxy{jumpHosts: []string{"a", "b"}, jumpFingerprints: []string{"fp1"}, jumpPassword: "pw"}, "must be specified for each jump host"},
+		{"jump fingerprint and known hosts", hostProxy{jumpHosts: []string{"a"}, jumpFingerprints: []string{"fp1"}, jumpKnownHostsFile: "known_hosts", jumpPassword: "pw"}, "both jump host fingerprints and jump known hosts file"},
+		{"jump no auth", hostProxy{jumpHosts: []string{"a"}, jumpFingerprints: []string{"fp1"}}, "jump host password, ssh key file, or ssh agent not specified"},
+		{"jump bad host", hostProxy{jumpHosts: []string{"a@"}, jumpFingerprints: []string{"fp1"}, jumpPassword: "pw"}, "has no hostname"},
+		{"fingerprint without jump", hostProxy{jumpFingerprints: []string{"fp1"}}, "specified without a jump host"},
+		{"known hosts without jump", hostProxy{jumpKnownHostsFile: "known_hosts", socks5: "proxy:1080"}, "specified without a jump host"},
+		{"password without jump", hostProxy{jumpPassword: "pw"}, "specified without a jump host"},
+		{"key file without jump", hostProxy{jumpSSHKeyFile: "id_ed25519"}, "specified without a jump host"},
+		{"agent without jump", hostProxy{jumpSSHAgent: true}, "specified without a jump host"},
+	}
+
+	for _, tt := range tests {
+		err := tt.hp.validate()
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validate failed (%s)", tt.name, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error containing %q (%v)", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestProxyCfgHostProxy(t *testing.T) {
+	knownHostsFile := "known_hosts"
+
+	// the jump known hosts file only defaults to --knownhosts with a jump host
+	noJump := []string{}
+	pCfg := proxyCfg{jumpHosts: &noJump}
+	hp := pCfg.hostProxy(knownHostsFile)
+	if hp.jumpKnownHostsFile != "" {
+		t.Errorf("no jump: jump known hosts file is %q (expected none)", hp.jumpKnownHostsFile)
+	}
+
+	jumps := []string{"a,b", "c"}
+	pCfg = proxyCfg{jumpHosts: &jumps}
+	hp = pCfg.hostProxy(knownHostsFile)
+	if hp.jumpKnownHostsFile != knownHostsFile {
+		t.Errorf("jump: jump known hosts file is %q (expected %q)", hp.jumpKnownHostsFile, knownHostsFile)
+	}
+	if strings.Join(hp.jumpHosts, " ") != "a b c" {
+		t.Errorf("jump: jump hosts are %v (expected [a b c])", hp.jumpHosts)
+	}
+
+	fingerprints := []string{"fp1", "fp2", "fp3"}
+	pCfg = proxyCfg{jumpHosts: &jumps, jumpFingerprints: &fingerprints}
+	hp = pCfg.hostProxy(knownHostsFile)
+	if hp.jumpKnownHostsFile != "" {
+		t.Errorf("jump fingerprints: jump known hosts file is %q (expected none)", hp.jumpKnownHostsFile)
+	}
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"apc-p15-tool/pkg/apcssh"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat is the timestamp format of backup file names
+const backupTimeFormat = "20060102T150405Z"
+
+// rollbackTimeout is the maximum time to restore the backup; the rollback is
+// not aborted when the install's ctx is done (e.g., it timed out or was
+// interrupted) since that is often why the install failed
+const rollbackTimeout = 2 * time.Minute
+
+// backupHost downloads the ups' current ssl files and, if host.backupDir is
+// set, saves them there. Files that could not be downloaded are logged but do
+// not fail the backup. Errors have an exit code.
+func (app *app) backupHost(ctx context.Context, scope outputScope, client *apcssh.Client, host installHost) (*apcssh.CertBackup, error) {
+	app.stdLogger.Printf("%s: backing up current ssl key and cert...", scope.logPrefix)
+
+	backup, err := client.BackupSSLCert(ctx)
+	if err != nil {
+		return nil, withExitCode(exitCodeInstall, fmt.Errorf("%s: failed to back up current cert (%w)", scope.logPrefix, err))
+	}
+
+	upsPaths := []string{}
+	for upsPath := range backup.Files {
+		upsPaths = append(upsPaths, upsPath)
+	}
+	sort.Strings(upsPaths)
+
+	missing := []string{}
+	for upsPath, err := range backup.Missing {
+		missing = append(missing, upsPath)
+		app.warn(scope, "backup-file-missing", "failed to download %s for backup (%s)", upsPath, err)
+	}
+	sort.Strings(missing)
+
+	if host.rollbackOnFailure && !backup.Complete() {
+		app.warn(scope, "rollback-unavailable", "the backup is incomplete, the current cert can NOT be restored if the install fails")
+	}
+
+	// save files
+	savedPaths := []string{}
+	if host.backupDir != "" {
+		err = os.MkdirAll(host.backupDir, 0700)
+		if err != nil {
+			return nil, withExitCode(exitCodeInstall, fmt.Errorf("%s: failed to make backup dir (%w)", scope.logPrefix, err))
+		}
+
+		// e.g., ups1.example.com_20261017T053900Z_defaultcert.p15
+		prefix := strings.ReplaceAll(host.name(), ":", "_") + "_" + time.Now().UTC().Format(backupTimeFormat) + "_"
+		for _, upsPath := range upsPaths {
+			savedPath := filepath.Join(host.backupDir, prefix+path.Base(upsPath))
+			err = os.WriteFile(savedPath, backup.Files[upsPath], 0600)
+			if err != nil {
+				return nil, withExitCode(exitCodeInstall, fmt.Errorf("%s: failed to write backup file (%w)", scope.logPrefix, err))
+			}
+
+			app.stdLogger.Printf("%s: backed up %s to %s", scope.logPrefix, upsPath, savedPath)
+			savedPaths = append(savedPaths, savedPath)
+		}
+	}
+
+	app.emit(scope, "backup", "", "", map[string]any{
+		"method":   backup.Method.String(),
+		"files":    upsPaths,
+		"missing":  missing,
+		"saved_to": savedPaths,
+		"complete": backup.Complete(),
+	})
+
+	return backup, nil
+}
+
+// rollbackOnFailure restores backup if host.rollbackOnFailure is set and
+// returns installErr with the outcome of the rollback added (installErr is
+// returned as-is if no rollback is done)
+func (app *app) rollbackOnFailure(ctx context.Context, scope outputScope, client *apcssh.Client, host installHost, backup *apcssh.CertBackup, installErr error) error {
+	if !host.rollbackOnFailure || backup == nil || !backup.Complete() {
+		return installErr
+	}
+
+	app.stdLogger.Printf("%s: install failed, rolling back to the previous ssl key and cert...", scope.logPrefix)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	err := client.RestoreSSLCert(ctx, backup)
+	if err == nil && host.restartWebUI {
+		err = client.RestartWebUI(ctx)
+	}
+
+	if err != nil {
+		app.emit(scope, "rollback", "", err.Error(), map[string]any{"ok": false})
+		return fmt.Errorf("%w (rollback failed: %s)", installErr, err)
+	}
+
+	app.stdLogger.Printf("%s: rolled back to the previous ssl key and cert", scope.logPrefix)
+	app.emit(scope, "rollback", "", "", map[string]any{"ok": true})
+
+	return fmt.Errorf("%w (rolled back to the previous cert)", installErr)
+}
@@ -0,0 +1,428 @@
+package app
+
+import (
+	"apc-p15-tool/pkg/apcssh"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// installHost contains the connection and install options for one ups
+type installHost struct {
+	hostname    string
+	sshPort     int
+	fingerprint string
+	// verify the host key with a known_hosts file instead of fingerprint
+	knownHostsFile string
+	// add the host key to knownHostsFile if the host is not in it yet
+	tofu     bool
+	username string
+	password string
+	// public key auth (tried before the password)
+	sshKeyFile       string
+	sshKeyPassphrase string
+	sshAgent         bool
+	restartWebUI     bool
+	webUISSLPort     int
+	skipVerify       bool
+	insecureCipher   bool
+	// back up the current cert to backupDir (if not empty) before install
+	backupDir string
+	// restore the backed up cert if the install or verification fails
+	rollbackOnFailure bool
+	// skip the install if the web ui already serves the new cert
+	onlyIfChanged bool
+	// skip the install unless the web ui's cert expires within this (if > 0)
+	onlyIfExpiringWithin time.Duration
+	// maximum time to poll the web ui for the new cert
+	verifyTimeout time.Duration
+	// maximum time of each ssh step (zero uses the apcssh default)
+	connectTimeout time.Duration
+	loginTimeout   time.Duration
+	cmdTimeout     time.Duration
+	// jump hosts and/or socks5 proxy to reach the ups through
+	proxy hostProxy
+	// dialer for proxy (set by withDialer; nil connects directly)
+	dialer apcssh.Dialer
+}
+
+// validate returns an error if a required option of the host is missing
+func (host *installHost) validate() error {
+	if host.username == "" {
+		return errors.New("username not specified")
+	}
+	if host.password == "" && host.sshKeyFile == "" && !host.sshAgent {
+		return errors.New("password, ssh key file, or ssh agent not specified")
+	}
+	if host.fingerprint == "" && host.knownHostsFile == "" {
+		return errors.New("fingerprint or known hosts file not specified")
+	}
+	if host.fingerprint != "" && host.knownHostsFile != "" {
+		return errors.New("both fingerprint and known hosts file specified")
+	}
+	if host.tofu && host.knownHostsFile == "" {
+		return errors.New("tofu requires a known hosts file")
+	}
+	if host.hostname == "" || host.sshPort == 0 {
+		return errors.New("apc host not specified")
+	}
+	if host.verifyTimeout < 0 {
+		return errors.New("verify timeout must not be negative")
+	}
+	if host.connectTimeout < 0 || host.loginTimeout < 0 || host.cmdTimeout < 0 {
+		return errors.New("connect, login, and cmd timeouts must not be negative")
+	}
+
+	err := host.proxy.validate()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// sleepContext sleeps for d or until ctx is done (in which case the ctx error
+// is returned)
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// nmcGeneration returns the nmc generation that uses the install method
+func nmcGeneration(method apcssh.InstallMethod) string {
+	switch method {
+	case apcssh.InstallMethodSSLCmd:
+		return "nmc3"
+	case apcssh.InstallMethodLegacy:
+		return "nmc2"
+
+	default:
+	}
+
+	return "unknown"
+}
+
+// connectHost connects to the ups ssh server. The client's actions are aborted
+// when their ctx is done. Errors have an exit code.
+func (app *app) connectHost(ctx context.Context, scope outputScope, host installHost) (*apcssh.Client, error) {
+	// log warning if insecure cipher
+	if host.insecureCipher {
+		app.warn(scope, "insecure-cipher", "insecure ciphers are enabled (--insecurecipher). SSH with an insecure cipher is NOT secure and should NOT be used.")
+	}
+
+	// make APC SSH client
+	cfg := &apcssh.Config{
+		Hostname:          host.hostname + ":" + strconv.Itoa(host.sshPort),
+		Username:          host.username,
+		Password:          host.password,
+		ServerFingerprint: host.fingerprint,
+		InsecureCipher:    host.insecureCipher,
+		Dialer:            host.dialer,
+		ConnectTimeout:    host.connectTimeout,
+		LoginTimeout:      host.loginTimeout,
+		CmdTimeout:        host.cmdTimeout,
+		KnownHostsFile:    host.knownHostsFile,
+		TOFU:              host.tofu,
+		HostKeyRecorded: func(fingerprint string) {
+			app.stdLogger.Printf("%s: host not in known hosts file, trusted its key on first use and added it (sha256 fingerprint: %s)", scope.logPrefix, fingerprint)
+			app.emit(scope, "host_key_recorded", "", "", map[string]any{"fingerprint": fingerprint, "known_hosts_file": host.knownHostsFile})
+		},
+	}
+	if host.sshKeyFile != "" {
+		cfg.PrivateKeyFile = host.sshKeyFile
+		cfg.PrivateKeyPassphrase = []byte(host.sshKeyPassphrase)
+	}
+	if host.sshAgent {
+		cfg.AgentSocket = os.Getenv("SSH_AUTH_SOCK")
+		if cfg.AgentSocket == "" {
+			return nil, withExitCode(exitCodeConfig, fmt.Errorf("%s: failed, ssh agent specified but SSH_AUTH_SOCK is not set", scope.logPrefix))
+		}
+	}
+
+	client, err := apcssh.New(ctx, cfg)
+	if err != nil {
+		err = fmt.Errorf("%s: failed to connect to host (%w)", scope.logPrefix, err)
+		if errors.Is(err, apcssh.ErrFingerprintMismatch) || errors.Is(err, apcssh.ErrHostKeyUnknown) || errors.Is(err, apcssh.ErrHostKeyChanged) {
+			return nil, withExitCode(exitCodeFingerprint, err)
+		}
+		return nil, withExitCode(exitCodeConnect, err)
+	}
+	app.emit(scope, "connected", "", "", nil)
+
+	return client, nil
+}
+
+// installOnHost uploads the p15 files (or for newer devices, the key p15 and
+// cert pem) to the ups, then optionally restarts the web ui and verifies the
+// web ui serves the new cert. If ctx has a deadline, the install is aborted
+// when it passes. Errors have an exit code for the step that failed.
+func (app *app) installOnHost(ctx context.Context, scope outputScope, host installHost, keyP15, keyCertP15, nmcCertPem []byte) error {
+	logPrefix := scope.logPrefix
+
+	host, closeDialer, err := app.withDialer(scope, host)
+	if err != nil {
+		return err
+	}
+	defer closeDialer()
+
+	// check if the install is needed
+	if host.onlyIfChanged || host.onlyIfExpiringWithin > 0 {
+		needed, reason := app.installNeeded(ctx, scope, host, nmcCertPem)
+		if !needed {
+			app.stdLogger.Printf("%s: install skipped (%s)", logPrefix, reason)
+			app.emit(scope, "skip", "", reason, nil)
+			return nil
+		}
+
+		app.stdLogger.Printf("%s: install needed (%s)", logPrefix, reason)
+	}
+
+	client, err := app.connectHost(ctx, scope, host)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+	app.stdLogger.Printf("%s: connected to ups ssh, installing ssl key and cert...", logPrefix)
+
+	// check time - don't fail it time is no good, just do logging here
+	upsT, err := client.GetTime(ctx)
+	if err != nil {
+		app.errLogger.Printf("warn: %s: failed to fetch UPS time (%s), you should manually verify the time is correct on the UPS", logPrefix, err)
+		app.emit(scope, "warning", "ups-time-unknown", fmt.Sprintf("failed to fetch UPS time (%s)", err), nil)
+	} else if upsT.After(time.Now().Add(1*time.Hour)) || upsT.Before(time.Now().Add(-1*time.Hour)) {
+		app.errLogger.Printf("warn: %s: UPS clock skew detected (this system's time is %s vs. UPS time %s", logPrefix, time.Now().Local().Format(timeLoggingFormat), upsT.Local().Format(timeLoggingFormat))
+		app.emit(scope, "warning", "ups-clock-skew", "UPS clock skew detected", map[string]any{"system_time": time.Now(), "ups_time": upsT})
+	} else {
+		app.stdLogger.Printf("%s: UPS clock appears correct (%s)", logPrefix, upsT.Local().Format(timeLoggingFormat))
+	}
+
+	// back up current cert
+	var backup *apcssh.CertBackup
+	if host.backupDir != "" || host.rollbackOnFailure {
+		backup, err = app.backupHost(ctx, scope, client, host)
+		if err != nil {
+			return err
+		}
+	}
+
+	// install SSL Cert
+	method, err := client.InstallSSLCert(ctx, keyP15, nmcCertPem, keyCertP15)
+	installData := map[string]any{
+		"method":         method.String(),
+		"nmc_generation": nmcGeneration(method),
+		"ok":             err == nil,
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %w", logPrefix, err)
+		app.emit(scope, "install", "", err.Error(), installData)
+		return withExitCode(exitCodeInstall, app.rollbackOnFailure(ctx, scope, client, host, backup, err))
+	}
+
+	// installed
+	app.stdLogger.Printf("%s: apc p15 file installed on %s (method: %s)", logPrefix, host.hostname, method)
+	app.emit(scope, "install", "", "", installData)
+
+	// restart UPS webUI
+	if host.restartWebUI {
+		app.stdLogger.Printf("%s: sending restart command", logPrefix)
+
+		err = client.RestartWebUI(ctx)
+		if err != nil {
+			return withExitCode(exitCodeInstall, fmt.Errorf("%s: failed to send webui restart command (%w)", logPrefix, err))
+		}
+
+		app.stdLogger.Printf("%s: sent webui restart command", logPrefix)
+		app.emit(scope, "restart_webui", "", "", nil)
+	}
+
+	// check the new certificate is installed
+	if host.skipVerify || host.webUISSLPort == 0 {
+		app.emit(scope, "verify", "", "", map[string]any{"result": "skipped"})
+		return nil
+	}
+
+	err = app.verifyInstall(ctx, scope, host, nmcCertPem)
+	if err != nil {
+		result := "failed"
+		if errors.Is(err, errVerifyMismatch) {
+			result = "mismatch"
+		} else if errors.Is(err, context.Canceled) {
+			result = "interrupted"
+		}
+		app.emit(scope, "verify", "", err.Error(), map[string]any{"result": result})
+
+		return withExitCode(exitCodeVerify, app.rollbackOnFailure(ctx, scope, client, host, backup, fmt.Errorf("%s: %w", logPrefix, err)))
+	}
+
+	app.stdLogger.Printf("%s: ups web ui cert verified", logPrefix)
+	app.emit(scope, "verify", "", "", map[string]any{"result": "verified"})
+
+	return nil
+}
+
+// installNeeded checks the cert the web ui serves against the only-if-changed
+// and only-if-expiring-within options and returns false if the install should
+// be skipped, and the reason either way. If the web ui's cert can't be fetched,
+// the install is needed.
+func (app *app) installNeeded(ctx context.Context, scope outputScope, host installHost, nmcCertPem []byte) (bool, string) {
+	if host.webUISSLPort == 0 {
+		app.warn(scope, "webui-check-failed", "can't check the web ui's current cert (no ssl port)")
+		return true, "web ui cert unknown"
+	}
+
+	leafCert, err := fetchWebUILeaf(ctx, host)
+	if err != nil {
+		app.warn(scope, "webui-check-failed", "can't check the web ui's current cert (%s)", err)
+		return true, "web ui cert unknown"
+	}
+
+	app.stdLogger.Printf("%s: web ui currently serves %s (expires: %s)", scope.logPrefix, leafCert.Subject, leafCert.NotAfter.Local().Format(timeLoggingFormat))
+
+	if host.onlyIfChanged && certPemLeafEqual(nmcCertPem, leafCert) {
+		return false, "web ui already serves the new cert"
+	}
+
+	if host.onlyIfExpiringWithin > 0 && time.Until(leafCert.NotAfter) > host.onlyIfExpiringWithin {
+		return false, fmt.Sprintf("web ui cert does not expire within %s", formatDuration(host.onlyIfExpiringWithin))
+	}
+
+	if host.onlyIfExpiringWithin > 0 {
+		return true, fmt.Sprintf("web ui cert expires within %s", formatDuration(host.onlyIfExpiringWithin))
+	}
+
+	return true, "web ui serves a different cert"
+}
+
+var errVerifyMismatch = errors.New("web ui leaf cert does not match new cert (your cert may not be compatible with NMC; check for WARNINGs in this tool's output)")
+
+// verification polling
+const (
+	verifyDefaultTimeout    = 2 * time.Minute
+	verifyAttemptTimeout    = 10 * time.Second
+	verifyInitialBackoff    = 1 * time.Second
+	verifyMaxBackoff        = 15 * time.Second
+	verifyBackoffMultiplier = 2
+)
+
+// verifyInstall polls the ups web ui until it serves the new cert (the first
+// cert of nmcCertPem) or host.verifyTimeout passes. The web ui not serving the
+// new cert yet, or being unreachable (e.g., while it restarts), is retried
+// with backoff. Each attempt is logged.
+func (app *app) verifyInstall(ctx context.Context, scope outputScope, host installHost, nmcCertPem []byte) error {
+	timeout := host.verifyTimeout
+	if timeout <= 0 {
+		timeout = verifyDefaultTimeout
+	}
+
+	app.stdLogger.Printf("%s: attempting to verify certificate install (timeout: %s)...", scope.logPrefix, timeout)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	backoff := verifyInitialBackoff
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		attemptCtx, attemptCancel := context.WithTimeout(ctx, verifyAttemptTimeout)
+		leafCert, err := fetchWebUILeaf(attemptCtx, host)
+		attemptCancel()
+
+		result := "unreachable"
+		message := ""
+		if err != nil {
+			message = err.Error()
+			lastErr = err
+		} else if !certPemLeafEqual(nmcCertPem, leafCert) {
+			result = "mismatch"
+			message = fmt.Sprintf("web ui serves %s (serial: %s)", leafCert.Subject, leafCert.SerialNumber)
+			lastErr = errVerifyMismatch
+		} else {
+			result = "verified"
+		}
+
+		app.emit(scope, "verify_attempt", "", message, map[string]any{"attempt": attempt, "result": result})
+		if result == "verified" {
+			app.stdLogger.Printf("%s: verify attempt %d: web ui serves the new cert", scope.logPrefix, attempt)
+			return nil
+		}
+		app.stdLogger.Printf("%s: verify attempt %d: %s (%s)", scope.logPrefix, attempt, result, message)
+
+		// wait and try again (unless the next attempt would be after the timeout)
+		deadline, _ := ctx.Deadline()
+		if time.Until(deadline) <= backoff {
+			break
+		}
+
+		err = sleepContext(ctx, backoff)
+		if errors.Is(err, context.Canceled) {
+			// interrupted, not timed out
+			return withExitCode(exitCodeInterrupted, fmt.Errorf("web ui cert verification interrupted (%w)", err))
+		} else if err != nil {
+			break
+		}
+
+		backoff = min(backoff*verifyBackoffMultiplier, verifyMaxBackoff)
+	}
+
+	// mismatch is reported as is, anything else as not verified in time
+	if errors.Is(lastErr, errVerifyMismatch) {
+		return lastErr
+	}
+
+	return fmt.Errorf("web ui cert could not be verified within %s (%w)", timeout, lastErr)
+}
+
+// fetchWebUILeaf connects to the ups web ui and returns the leaf cert it
+// serves
+func fetchWebUILeaf(ctx context.Context, host installHost) (*x509.Certificate, error) {
+	var dialer apcssh.Dialer = &net.Dialer{}
+	if host.dialer != nil {
+		dialer = host.dialer
+	}
+
+	rawConn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host.hostname, strconv.Itoa(host.webUISSLPort)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial webui (%s)", err)
+	}
+
+	conn := tls.Client(rawConn, &tls.Config{
+		ServerName:         host.hostname,
+		InsecureSkipVerify: true,
+	})
+	defer conn.Close()
+
+	err = conn.HandshakeContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial webui (%s)", err)
+	}
+
+	// get top cert
+	peerCerts := conn.ConnectionState().PeerCertificates
+	if len(peerCerts) == 0 {
+		return nil, errors.New("failed to get web ui leaf cert")
+	}
+
+	return peerCerts[0], nil
+}
+
+// certPemLeafEqual returns true if cert is the first cert of certPem
+func certPemLeafEqual(certPem []byte, cert *x509.Certificate) bool {
+	// convert pem to DER for comparison (leaf is first)
+	pemBlock, _ := pem.Decode(certPem)
+
+	return pemBlock != nil && bytes.Equal(cert.Raw, pemBlock.Bytes)
+}
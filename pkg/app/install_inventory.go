@@ -0,0 +1,133 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// inventoryHost is a host in an install-all inventory file; unset options use
+// the value of the command's flag
+type inventoryHost struct {
+	Hostname       string  `yaml:"hostname" toml:"hostname"`
+	SSHPort        *int    `yaml:"sshport" toml:"sshport"`
+	Fingerprint    *string `yaml:"fingerprint" toml:"fingerprint"`
+	Username       *string `yaml:"username" toml:"username"`
+	Password       *string `yaml:"password" toml:"password"`
+	SSHKeyFile     *string `yaml:"sshkeyfile" toml:"sshkeyfile"`
+	SSHAgent       *bool   `yaml:"sshagent" toml:"sshagent"`
+	RestartWebUI   *bool   `yaml:"restartwebui" toml:"restartwebui"`
+	WebUISSLPort   *int    `yaml:"sslport" toml:"sslport"`
+	SkipVerify     *bool   `yaml:"skipverify" toml:"skipverify"`
+	InsecureCipher *bool   `yaml:"insecurecipher" toml:"insecurecipher"`
+}
+
+// inventory is the content of an install-all inventory file
+type inventory struct {
+	Hosts []inventoryHost `yaml:"hosts" toml:"hosts"`
+}
+
+// installHost returns the inventory host as an installHost, using defaults
+// for any option the inventory host does not specify
+func (invHost *inventoryHost) installHost(defaults installHost) installHost {
+	host := defaults
+	host.hostname = invHost.Hostname
+
+	if invHost.SSHPort != nil {
+		host.sshPort = *invHost.SSHPort
+	}
+	if invHost.Fingerprint != nil {
+		host.fingerprint = *invHost.Fingerprint
+	}
+	if invHost.Username != nil {
+		host.username = *invHost.Username
+	}
+	if invHost.Password != nil {
+		host.password = *invHost.Password
+	}
+	if invHost.SSHKeyFile != nil {
+		host.sshKeyFile = *invHost.SSHKeyFile
+	}
+	if invHost.SSHAgent != nil {
+		host.sshAgent = *invHost.SSHAgent
+	}
+	if invHost.RestartWebUI != nil {
+		host.restartWebUI = *invHost.RestartWebUI
+	}
+	if invHost.WebUISSLPort != nil {
+		host.webUISSLPort = *invHost.WebUISSLPort
+	}
+	if invHost.SkipVerify != nil {
+		host.skipVerify = *invHost.SkipVerify
+	}
+	if invHost.InsecureCipher != nil {
+		host.insecureCipher = *invHost.InsecureCipher
+	}
+
+	return host
+}
+
+// name returns the name of the host for logging (the port is only included
+// if it is not the default)
+func (host *installHost) name() string {
+	if host.sshPort == 22 {
+		return host.hostname
+	}
+
+	return host.hostname + ":" + strconv.Itoa(host.sshPort)
+}
+
+// readInventory reads a yaml or toml inventory file and returns its hosts
+// with unset options taken from defaults; every host is validated
+func readInventory(path string, defaults installHost) ([]installHost, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := inventory{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, &inv)
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&inv)
+	default:
+		return nil, errors.New("inventory file name must end in .yaml, .yml, or .toml")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(inv.Hosts) == 0 {
+		return nil, errors.New("inventory contains no hosts")
+	}
+
+	hosts := []installHost{}
+	seen := map[string]struct{}{}
+	for i := range inv.Hosts {
+		host := inv.Hosts[i].installHost(defaults)
+
+		err = host.validate()
+		if err != nil {
+			return nil, fmt.Errorf("host %d (%s): %w", i+1, host.hostname, err)
+		}
+
+		if _, ok := seen[host.name()]; ok {
+			return nil, fmt.Errorf("host %d (%s): listed more than once", i+1, host.name())
+		}
+		seen[host.name()] = struct{}{}
+
+		hosts = append(hosts, host)
+	}
+
+	return hosts, nil
+}
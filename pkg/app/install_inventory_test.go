@@ -0,0 +1,125 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testInventoryDefaults are the flag defaults used to read the test
+// inventories
+var testInventoryDefaults = installHost{
+	sshPort:      22,
+	fingerprint:  "abc123",
+	username:     "apc",
+	password:     "secret",
+	webUISSLPort: 443,
+}
+
+// testReadInventory writes content to an inventory file named fileName and
+// reads it with testInventoryDefaults
+func testReadInventory(t *testing.T, fileName, content string) ([]installHost, error) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), fileName)
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return readInventory(path, testInventoryDefaults)
+}
+
+func TestReadInventory(t *testing.T) {
+	yamlInventory := `
+hosts:
+  - hostname: ups1.example.com
+  - hostname: ups2.example.com
+    sshport: 2222
+    username: admin
+    sslport: 8443
+    restartwebui: true
+  - hostname: ups1.example.com
+    sshport: 2222
+`
+	tomlInventory := `
+[[hosts]]
+hostname = "ups1.example.com"
+
+[[hosts]]
+hostname = "ups2.example.com"
+sshport = 2222
+username = "admin"
+sslport = 8443
+restartwebui = true
+
+[[hosts]]
+hostname = "ups1.example.com"
+sshport = 2222
+`
+
+	for fileName, content := range map[string]string{"devices.yaml": yamlInventory, "devices.toml": tomlInventory} {
+		hosts, err := testReadInventory(t, fileName, content)
+		if err != nil {
+			t.Errorf("%s: read failed (%s)", fileName, err)
+			continue
+		}
+
+		wantNames := []string{"ups1.example.com", "ups2.example.com:2222", "ups1.example.com:2222"}
+		if len(hosts) != len(wantNames) {
+			t.Errorf("%s: read %d hosts (expected %d)", fileName, len(hosts), len(wantNames))
+			continue
+		}
+		for i, host := range hosts {
+			if host.name() != wantNames[i] {
+				t.Errorf("%s: host %d is %s (expected %s)", fileName, i+1, host.name(), wantNames[i])
+			}
+		}
+
+		// unset options are the defaults
+		if hosts[0].username != "apc" || hosts[0].password != "secret" || hosts[0].fingerprint != "abc123" ||
+			hosts[0].webUISSLPort != 443 || hosts[0].restartWebUI {
+			t.Errorf("%s: host 1 did not get the defaults (%+v)", fileName, hosts[0])
+		}
+
+		// set options replace the defaults (only for that host)
+		if hosts[1].username != "admin" || hosts[1].password != "secret" || hosts[1].webUISSLPort != 8443 || !hosts[1].restartWebUI {
+			t.Errorf("%s: host 2 options did not replace the defaults (%+v)", fileName, hosts[1])
+		}
+		if hosts[2].username != "apc" || hosts[2].webUISSLPort != 443 || hosts[2].restartWebUI {
+			t.Errorf("%s: host 2 options leaked into host 3 (%+v)", fileName, hosts[2])
+		}
+	}
+}
+
+func TestReadInventoryErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		content  string
+		wantErr  string
+	}{
+		{"yaml duplicate host", "devices.yaml", "hosts:\n  - hostname: ups1\n  - hostname: ups2\n  - hostname: ups1\n", "host 3 (ups1): listed more than once"},
+		{"yaml duplicate host and port", "devices.yaml", "hosts:\n  - hostname: ups1\n    sshport: 2222\n  - hostname: ups1\n    sshport: 2222\n", "host 2 (ups1:2222): listed more than once"},
+		{"toml duplicate host", "devices.toml", "[[hosts]]\nhostname = \"ups1\"\n\n[[hosts]]\nhostname = \"ups1\"\n", "host 2 (ups1): listed more than once"},
+		{"yaml unknown host key", "devices.yaml", "hosts:\n  - hostname: ups1\n    user: apc\n", "field user not found"},
+		{"yaml unknown top level key", "devices.yaml", "hosts:\n  - hostname: ups1\ndefaults:\n  username: apc\n", "field defaults not found"},
+		{"toml unknown host key", "devices.toml", "[[hosts]]\nhostname = \"ups1\"\nuser = \"apc\"\n", "strict mode"},
+		{"yaml wrong type", "devices.yaml", "hosts:\n  - hostname: ups1\n    sshport: twenty-two\n", "cannot unmarshal"},
+		{"toml in yaml file", "devices.yaml", "[[hosts]]\nhostname = \"ups1\"\n", "yaml: unmarshal errors"},
+		{"yaml in toml file", "devices.toml", "hosts:\n  - hostname: ups1\n", "toml: expected character ="},
+		{"bad extension", "devices.json", `{"hosts": [{"hostname": "ups1"}]}`, "inventory file name must end in .yaml, .yml, or .toml"},
+		{"no hosts", "devices.yaml", "hosts: []\n", "inventory contains no hosts"},
+		{"empty file", "devices.toml", "", "inventory contains no hosts"},
+		{"missing hostname", "devices.yaml", "hosts:\n  - hostname: ups1\n  - sshport: 2222\n", "host 2 (): apc host not specified"},
+		{"host invalid", "devices.yaml", "hosts:\n  - hostname: ups1\n    username: \"\"\n", "host 1 (ups1): username not specified"},
+	}
+
+	for _, tt := range tests {
+		_, err := testReadInventory(t, tt.fileName, tt.content)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error containing %q (%v)", tt.name, tt.wantErr, err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	multiHostDefaultParallel = 4
+	multiHostDefaultTimeout  = 5 * time.Minute
+)
+
+// hostResult is the outcome of a command on one host
+type hostResult struct {
+	err      error
+	exitCode int
+	duration time.Duration
+}
+
+// multiHostOpts returns the parallel and timeout values (or their defaults if
+// unset) and errors if they are not valid
+func multiHostOpts(cmdName string, parallelFlag *int, timeoutFlag *time.Duration) (parallel int, timeout time.Duration, err error) {
+	parallel = multiHostDefaultParallel
+	if parallelFlag != nil {
+		parallel = *parallelFlag
+	}
+	if parallel < 1 {
+		return 0, 0, withExitCode(exitCodeConfig, fmt.Errorf("%s: failed, parallel must be at least 1", cmdName))
+	}
+
+	timeout = multiHostDefaultTimeout
+	if timeoutFlag != nil {
+		timeout = *timeoutFlag
+	}
+	if timeout <= 0 {
+		return 0, 0, withExitCode(exitCodeConfig, fmt.Errorf("%s: failed, timeout must be greater than 0", cmdName))
+	}
+
+	return parallel, timeout, nil
+}
+
+// runOnHosts runs fn for each host, at most parallel at a time, and aborts
+// each host after timeout. Errors are logged as they happen and a host_result
+// event is emitted for each host. The results are in the same order as hosts.
+func (app *app) runOnHosts(cmdCtx context.Context, cmdName string, hosts []installHost, parallel int, timeout time.Duration,
+	fn func(ctx context.Context, scope outputScope, host installHost) error) []hostResult {
+	results := make([]hostResult, len(hosts))
+	sem := make(chan struct{}, parallel)
+	wg := sync.WaitGroup{}
+
+	for i := range hosts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			scope := newOutputScope(cmdName).forHost(hosts[i].name(), true)
+
+			// interrupted while waiting for a slot
+			if cmdCtx.Err() != nil {
+				results[i] = hostResult{
+					err:      fmt.Errorf("not started (%w)", cmdCtx.Err()),
+					exitCode: exitCodeInterrupted,
+				}
+				app.emit(scope, "host_result", "", results[i].err.Error(), map[string]any{
+					"ok":        false,
+					"exit_code": results[i].exitCode,
+					"seconds":   0.0,
+				})
+				return
+			}
+
+			start := time.Now()
+			deadline := start.Add(timeout)
+			ctx, cancel := context.WithDeadline(cmdCtx, deadline)
+			defer cancel()
+
+			err := fn(ctx, scope, hosts[i])
+			code := errExitCode(err)
+			if err != nil {
+				// the connection deadline can trigger slightly before ctx's
+				if !time.Now().Before(deadline) {
+					err = fmt.Errorf("%w (timed out after %s)", err, timeout)
+				}
+
+				app.errLogger.Print(err)
+
+				// summary already includes the host
+				err = errors.New(strings.TrimPrefix(err.Error(), scope.logPrefix+": "))
+			}
+
+			results[i] = hostResult{
+				err:      err,
+				exitCode: code,
+				duration: time.Since(start).Round(time.Second),
+			}
+
+			message := ""
+			if err != nil {
+				message = err.Error()
+			}
+			app.emit(scope, "host_result", "", message, map[string]any{
+				"ok":        err == nil,
+				"exit_code": code,
+				"seconds":   results[i].duration.Seconds(),
+			})
+		}(i)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// logHostsSummary logs the result of each host and returns the number of
+// hosts that failed
+func (app *app) logHostsSummary(cmdName string, hosts []installHost, results []hostResult) (failed int) {
+	app.stdLogger.Printf("%s: summary:", cmdName)
+	for i := range hosts {
+		if results[i].err != nil {
+			failed++
+			app.stdLogger.Printf("%s:   FAILED  %s (%s, exit code %d): %s", cmdName, hosts[i].name(), results[i].duration, results[i].exitCode, results[i].err)
+		} else {
+			app.stdLogger.Printf("%s:   ok      %s (%s)", cmdName, hosts[i].name(), results[i].duration)
+		}
+	}
+
+	return failed
+}
@@ -0,0 +1,193 @@
+package app
+
+import (
+	"apc-p15-tool/pkg/nmclint"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// output formats
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+// exit codes (documented in the README; do not change existing values)
+const (
+	exitCodeOK          = 0
+	exitCodeError       = 1   // any error not covered by a more specific code
+	exitCodeConfig      = 2   // invalid flags, options, key, or cert
+	exitCodeConnect     = 3   // ssh connection or authentication failed
+	exitCodeFingerprint = 4   // ssh server fingerprint mismatch
+	exitCodeInstall     = 5   // install (or webui restart) failed
+	exitCodeVerify      = 6   // web ui does not serve the new cert (or could not be checked)
+	exitCodeHostsFailed = 7   // install-all (or probe of an inventory) failed on one or more hosts
+	exitCodeLint        = 8   // compatibility warnings or errors (lint or --fail-on-warning)
+	exitCodeInterrupted = 130 // interrupted (e.g., ctrl-c) before the command finished
+)
+
+// exitError is an error with the exit code the app should exit with
+type exitError struct {
+	code int
+	err  error
+}
+
+// withExitCode returns err with the specified exit code (nil if err is nil);
+// if err already has an exit code, that code is kept
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	exitErr := &exitError{}
+	if errors.As(err, &exitErr) {
+		return err
+	}
+
+	return &exitError{code: code, err: err}
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// errExitCode returns the exit code for err
+func errExitCode(err error) int {
+	if err == nil {
+		return exitCodeOK
+	}
+
+	exitErr := &exitError{}
+	if errors.As(err, &exitErr) {
+		return exitErr.code
+	}
+
+	if errors.Is(err, ErrExtraArgs) {
+		return exitCodeConfig
+	}
+
+	return exitCodeError
+}
+
+// outputEvent is a structured event that is written to stdout (as one json
+// object per line) when json output is enabled
+type outputEvent struct {
+	Time    time.Time      `json:"time"`
+	Command string         `json:"command,omitempty"`
+	Host    string         `json:"host,omitempty"`
+	Event   string         `json:"event"`
+	Code    string         `json:"code,omitempty"`
+	Message string         `json:"message,omitempty"`
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+// eventWriter writes output events as json lines; it is safe for concurrent
+// use
+type eventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// newEventWriter creates an eventWriter that writes to w
+func newEventWriter(w io.Writer) *eventWriter {
+	return &eventWriter{enc: json.NewEncoder(w)}
+}
+
+// write writes the event (encoding errors are ignored as there is nowhere
+// better to report them)
+func (ew *eventWriter) write(event outputEvent) {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+
+	_ = ew.enc.Encode(event)
+}
+
+// outputScope is the command (and host) that log messages and events are for
+type outputScope struct {
+	cmdName string
+	host    string
+	// prefix of text log messages and errors (e.g., "install" or
+	// "install-all: ups1.example.com")
+	logPrefix string
+}
+
+// newOutputScope returns the scope of the specified command
+func newOutputScope(cmdName string) outputScope {
+	return outputScope{
+		cmdName:   cmdName,
+		logPrefix: cmdName,
+	}
+}
+
+// forHost returns the scope for host; if inLogPrefix, the host is also added
+// to the log prefix (i.e., when logging for multiple hosts)
+func (scope outputScope) forHost(host string, inLogPrefix bool) outputScope {
+	scope.host = host
+	if inLogPrefix {
+		scope.logPrefix = scope.cmdName + ": " + host
+	}
+
+	return scope
+}
+
+// emit writes an event if json output is enabled
+func (app *app) emit(scope outputScope, event, code, message string, data map[string]any) {
+	if app.events == nil {
+		return
+	}
+
+	app.events.write(outputEvent{
+		Time:    time.Now(),
+		Command: scope.cmdName,
+		Host:    scope.host,
+		Event:   event,
+		Code:    code,
+		Message: message,
+		Data:    data,
+	})
+}
+
+// warn logs a WARNING message and emits a warning event with a stable code
+// (e.g., "key-type-nmc2-unsupported")
+func (app *app) warn(scope outputScope, code, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	app.stdLogger.Printf("WARNING: %s: %s", scope.logPrefix, message)
+	app.emit(scope, "warning", code, message, nil)
+}
+
+// findingData returns the event data of a compatibility finding
+func findingData(finding nmclint.Finding) map[string]any {
+	data := map[string]any{
+		"severity": finding.Severity.String(),
+		"target":   finding.Target.String(),
+	}
+	if !finding.Target.MinFirmware.IsZero() {
+		data["min_firmware"] = finding.Target.MinFirmware.String()
+	}
+	if !finding.Target.MaxFirmware.IsZero() {
+		data["max_firmware"] = finding.Target.MaxFirmware.String()
+	}
+
+	return data
+}
+
+// logFinding logs a compatibility finding (as a note if info, otherwise as a
+// WARNING) and emits a matching event
+func (app *app) logFinding(scope outputScope, finding nmclint.Finding) {
+	if finding.Severity == nmclint.SeverityInfo {
+		app.stdLogger.Printf("%s: note: %s", scope.logPrefix, finding.Message)
+		app.emit(scope, "info", finding.ID, finding.Message, findingData(finding))
+		return
+	}
+
+	app.stdLogger.Printf("WARNING: %s: %s", scope.logPrefix, finding.Message)
+	app.emit(scope, "warning", finding.ID, finding.Message, findingData(finding))
+}
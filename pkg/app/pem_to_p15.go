@@ -1,73 +1,100 @@
 package app
 
 import (
+	"apc-p15-tool/pkg/nmclint"
 	"apc-p15-tool/pkg/pkcs15"
 	"crypto/x509"
-	"encoding/asn1"
+	"errors"
 	"fmt"
-	"slices"
+	"os"
 	"time"
 )
 
-// list of keys supported by the NMC2
-var nmc2SupportedKeyTypes = []pkcs15.KeyType{
-	pkcs15.KeyTypeRSA1024,
-	pkcs15.KeyTypeRSA2048,
-	pkcs15.KeyTypeRSA3072, // officially not supported but works
+// pemToAPCP15Opts are the options for pemToAPCP15
+type pemToAPCP15Opts struct {
+	// parse the generated file(s) back and verify them
+	selfCheck bool
+	// verify the cert chain against caFilePath (or the system roots if empty)
+	verifyChain bool
+	caFilePath  string
+	// return the cert's chain (found in the cert pem) with the nmc cert pem
+	fullChain bool
+	// fail if there are compatibility findings of warning (or error) severity
+	failOnWarning bool
 }
 
-// known good signing algorithms
-var knownSupportedNMC2SigningAlgs = []x509.SignatureAlgorithm{
-	x509.SHA256WithRSA,
-}
-
-var knownSupportedNMC3SigningAlgs = append(knownSupportedNMC2SigningAlgs, []x509.SignatureAlgorithm{
-	x509.ECDSAWithSHA384,
-}...)
-
-// known supported cert extensions
-var knownSupportedCriticalOIDs = []asn1.ObjectIdentifier{
-	{2, 5, 29, 15}, // keyUsage
-	{2, 5, 29, 19}, // basicConstraints
-	{2, 5, 29, 17}, // subjectAltName
-}
-
-var knownSupportedOIDs = append(knownSupportedCriticalOIDs, []asn1.ObjectIdentifier{
-	{2, 5, 29, 37},                     // extKeyUsage
-	{2, 5, 29, 14},                     // subjectKeyIdentifier
-	{2, 5, 29, 35},                     // authorityKeyIdentifier
-	{1, 3, 6, 1, 5, 5, 7, 1, 1},        // authorityInfoAccess
-	{2, 5, 29, 32},                     // certificatePolicies
-	{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}, // googleSignedCertificateTimestamp
-	{2, 5, 29, 31},                     // cRLDistributionPoints
-}...)
-
 // pemToAPCP15 reads the specified pem files and returns the apc p15 file(s). If the
 // key type of the key is not supported by NMC2, the combined key+cert file is not
 // generated and nil is returned instead for that file. If the key IS supported by
-// NMC2, the key+cert file is generated and the proper header is prepended.
-func (app *app) pemToAPCP15(keyPem, certPem []byte, parentCmdName string) (keyFile []byte, apcKeyCertFile []byte, err error) {
+// NMC2, the key+cert file is generated and the proper header is prepended. If
+// opts.selfCheck is true, the generated file(s) are parsed back and verified before
+// they are returned. The cert pem is a fullchain pem, the leaf cert is the one that
+// matches the key. The leaf (followed by its chain if opts.fullChain is true) is
+// returned as nmcCertPem, for devices that install the cert pem directly.
+func (app *app) pemToAPCP15(keyPem, certPem []byte, opts pemToAPCP15Opts, parentCmdName string) (keyFile, apcKeyCertFile, nmcCertPem []byte, err error) {
 	app.stdLogger.Printf("%s: making apc p15 file(s) content from pem", parentCmdName)
+	scope := newOutputScope(parentCmdName)
 
 	// make p15 struct
 	p15, err := pkcs15.ParsePEMToPKCS15(keyPem, certPem)
 	if err != nil {
-		return nil, nil, fmt.Errorf("%s: failed to parse pem files (%w)", parentCmdName, err)
+		return nil, nil, nil, fmt.Errorf("%s: failed to parse pem files (%w)", parentCmdName, err)
 	}
 
 	app.stdLogger.Printf("%s: successfully parsed pem files", parentCmdName)
+	app.emit(scope, "parse", "", "", map[string]any{
+		"key_type":            p15.KeyType().String(),
+		"nmc2_key_type":       nmclint.KeyTypeSupported(nmclint.DeviceNMC2, p15.KeyType()),
+		"subject":             p15.Cert.Subject.String(),
+		"issuer":              p15.Cert.Issuer.String(),
+		"serial":              p15.Cert.SerialNumber.String(),
+		"not_before":          p15.Cert.NotBefore,
+		"not_after":           p15.Cert.NotAfter,
+		"signature_algorithm": p15.Cert.SignatureAlgorithm.String(),
+		"dns_names":           p15.Cert.DNSNames,
+		"chain_certs":         len(p15.Chain),
+	})
+
+	// report chain found in cert pem
+	app.stdLogger.Printf("%s: leaf certificate: %s (issuer: %s)", parentCmdName, p15.Cert.Subject, p15.Cert.Issuer)
+	if len(p15.Chain) == 0 {
+		app.stdLogger.Printf("%s: no chain certificates found with the leaf certificate", parentCmdName)
+	}
+	for _, chainCert := range p15.Chain {
+		app.stdLogger.Printf("%s: chain certificate: %s (issuer: %s, expires: %s)", parentCmdName, chainCert.Subject, chainCert.Issuer, chainCert.NotAfter.Local().Format(timeLoggingFormat))
+	}
+
+	// verify chain
+	if opts.verifyChain {
+		err = verifyCertChain(p15.Cert, p15.Chain, opts.caFilePath)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s: failed to verify certificate chain (%w)", parentCmdName, err)
+		}
+
+		app.stdLogger.Printf("%s: certificate chain verified", parentCmdName)
+	}
+
+	// nmc cert pem
+	if opts.fullChain {
+		nmcCertPem, err = p15.ToPemCertChain()
+	} else {
+		nmcCertPem, err = p15.ToPemCert()
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%s: failed to make nmc cert pem (%w)", parentCmdName, err)
+	}
 
 	// make key file (always)
 	keyFile, err = p15.ToP15Key()
 	if err != nil {
-		return nil, nil, fmt.Errorf("%s: failed to make p15 key file (%w)", parentCmdName, err)
+		return nil, nil, nil, fmt.Errorf("%s: failed to make p15 key file (%w)", parentCmdName, err)
 	}
 
 	app.stdLogger.Printf("%s: successfully generated p15 key file content", parentCmdName)
 
 	// check key type for compat with NMC2
 	nmc2KeyType := false
-	if slices.Contains(nmc2SupportedKeyTypes, p15.KeyType()) {
+	if nmclint.KeyTypeSupported(nmclint.DeviceNMC2, p15.KeyType()) {
 		nmc2KeyType = true
 
 		app.stdLogger.Printf("%s: key type is supported by NMC2, generating p15 key+cert file content...", parentCmdName)
@@ -75,96 +102,107 @@ func (app *app) pemToAPCP15(keyPem, certPem []byte, parentCmdName string) (keyFi
 		// make file bytes
 		keyCertFile, err := p15.ToP15KeyCert()
 		if err != nil {
-			return nil, nil, fmt.Errorf("%s: failed to make p15 key+cert file content (%w)", parentCmdName, err)
+			return nil, nil, nil, fmt.Errorf("%s: failed to make p15 key+cert file content (%w)", parentCmdName, err)
 		}
 
 		// make header for file bytes
 		apcHeader, err := makeFileHeader(keyCertFile)
 		if err != nil {
-			return nil, nil, fmt.Errorf("%s: failed to make p15 key+cert file header (%w)", parentCmdName, err)
+			return nil, nil, nil, fmt.Errorf("%s: failed to make p15 key+cert file header (%w)", parentCmdName, err)
 		}
 
 		// combine header with file
 		apcKeyCertFile = append(apcHeader, keyCertFile...)
 	}
 
-	// check various parts of cert and log compatibility warnings
-	warned := false
+	// self check (read generated file(s) back and verify them)
+	if opts.selfCheck {
+		err = p15.VerifyP15KeyFile(keyFile)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s: self-check of generated p15 key file failed (%w)", parentCmdName, err)
+		}
 
-	// key not supported for NMC2
-	if !nmc2KeyType {
-		app.stdLogger.Printf("WARNING: %s: key type is %s and is not supported by NMC2.", parentCmdName, p15.KeyType().String())
-		warned = true
-	}
+		if len(apcKeyCertFile) > 0 {
+			err = verifyFileHeader(apcKeyCertFile)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("%s: self-check of generated p15 key+cert file failed (%w)", parentCmdName, err)
+			}
 
-	// signature algorithm (see: https://github.com/gregtwallace/apc-p15-tool/issues/18)
-	if !nmc2KeyType {
-		// definitely not for NMC2
-		if !slices.Contains(knownSupportedNMC3SigningAlgs, p15.Cert.SignatureAlgorithm) {
-			app.stdLogger.Printf("WARNING: %s: Certificate signing algorithm is %s and it is not known if NMC3 supports this algorithm.", parentCmdName, p15.Cert.SignatureAlgorithm.String())
-			warned = true
-		}
-	} else {
-		// could be for either NMC2 or NMC3
-		if !slices.Contains(knownSupportedNMC2SigningAlgs, p15.Cert.SignatureAlgorithm) {
-			if !slices.Contains(knownSupportedNMC3SigningAlgs, p15.Cert.SignatureAlgorithm) {
-				// not in NMC2 or NMC3 list
-				app.stdLogger.Printf("WARNING: %s: Certificate signing algorithm is %s and is not supported by NMC2. It is also not known if NMC3 supports this algorithm.", parentCmdName, p15.Cert.SignatureAlgorithm.String())
-			} else {
-				// not in NMC2 list, but is in NMC3 list
-				app.stdLogger.Printf("WARNING: %s: Certificate signing algorithm is %s and it does not support NMC2.", parentCmdName, p15.Cert.SignatureAlgorithm.String())
+			err = p15.VerifyP15KeyCertFile(apcKeyCertFile[apcHeaderLen:])
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("%s: self-check of generated p15 key+cert file failed (%w)", parentCmdName, err)
 			}
-			warned = true
 		}
-	}
 
-	// check validity dates
-	if time.Now().Before(p15.Cert.NotBefore) {
-		app.stdLogger.Printf("WARNING: %s: Current time (%s) is before certificate's NotBefore time (%s).",
-			parentCmdName, time.Now().Local().Format(timeLoggingFormat), p15.Cert.NotBefore.Local().Format(timeLoggingFormat))
-		warned = true
-	}
-
-	if time.Now().After(p15.Cert.NotAfter) {
-		app.stdLogger.Printf("WARNING: %s: Current time (%s) is after certificate's NotAfter time (%s).",
-			parentCmdName, time.Now().Local().Format(timeLoggingFormat), p15.Cert.NotAfter.Local().Format(timeLoggingFormat))
-		warned = true
+		app.stdLogger.Printf("%s: self-check of generated p15 file(s) passed", parentCmdName)
+	} else {
+		app.warn(scope, "selfcheck-disabled", "self-check of generated p15 file(s) is disabled (--no-selfcheck)")
 	}
 
-	// check extensions against known working extensions
-	for _, extension := range p15.Cert.Extensions {
-		// critical or not?
-		okOIDs := knownSupportedCriticalOIDs
-		criticalLogMsg := "Critical "
-		if !extension.Critical {
-			okOIDs = knownSupportedOIDs
-			criticalLogMsg = ""
-		}
-
-		// validate OIDs
-		ok := false
-		for _, okOID := range okOIDs {
-			if okOID.Equal(extension.Id) {
-				ok = true
-				break
-			}
+	// check cert compatibility and log findings
+	findings := nmclint.Lint(&nmclint.Input{Cert: p15.Cert, Now: time.Now()}, nmclint.DeviceAny)
+	warned := false
+	failOnWarning := false
+	for _, finding := range findings {
+		// the nmc2 key+cert file is not generated for other key types, so the
+		// key type is the only nmc2 finding that is logged (and it is not a
+		// reason to fail as the file is only used by nmc3)
+		nmc2Only := !nmc2KeyType && finding.Target.Device == nmclint.DeviceNMC2
+		if nmc2Only && finding.ID != "key-type-nmc2-unsupported" {
+			continue
 		}
 
-		if !ok {
-			app.stdLogger.Printf("WARNING: %s: %sExtension %s may not be supported by NMC.", parentCmdName, criticalLogMsg, extension.Id.String())
+		app.logFinding(scope, finding)
+		if finding.Severity >= nmclint.SeverityWarning {
+			warned = true
+			failOnWarning = failOnWarning || (opts.failOnWarning && !nmc2Only)
 		}
 	}
 
 	// log a message about possible failure
 	if warned {
-		app.stdLogger.Printf("WARNING: %s: Possible certificate compatibility issues were detected. If the resulting p15 file "+
+		app.warn(scope, "compatibility-issues", "Possible certificate compatibility issues were detected. If the resulting p15 file "+
 			"does not work with your NMC (e.g., a self-signed certificate is regenerated after you try to install the p15), "+
-			"modify your certificate to resolve the warnings and try again.", parentCmdName)
+			"modify your certificate to resolve the warnings and try again.")
+	}
+
+	if failOnWarning {
+		return nil, nil, nil, withExitCode(exitCodeLint, fmt.Errorf("%s: failed, compatibility warnings were found (--fail-on-warning)", parentCmdName))
 	}
 
 	// end compatibility warnings
 
 	app.stdLogger.Printf("%s: apc p15 file(s) data succesfully generated", parentCmdName)
 
-	return keyFile, apcKeyCertFile, nil
+	return keyFile, apcKeyCertFile, nmcCertPem, nil
+}
+
+// verifyCertChain verifies cert is valid for server auth and chains to a root
+// in caFilePath (pem bundle) or, if caFilePath is empty, a system root. chain is
+// used as intermediates.
+func verifyCertChain(cert *x509.Certificate, chain []*x509.Certificate, caFilePath string) error {
+	verifyOpts := x509.VerifyOptions{
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	for _, chainCert := range chain {
+		verifyOpts.Intermediates.AddCert(chainCert)
+	}
+
+	// roots (nil uses system roots)
+	if caFilePath != "" {
+		caPem, err := os.ReadFile(caFilePath)
+		if err != nil {
+			return fmt.Errorf("failed to read ca file (%w)", err)
+		}
+
+		verifyOpts.Roots = x509.NewCertPool()
+		if !verifyOpts.Roots.AppendCertsFromPEM(caPem) {
+			return errors.New("ca file does not contain any pem certificates")
+		}
+	}
+
+	_, err := cert.Verify(verifyOpts)
+	return err
 }
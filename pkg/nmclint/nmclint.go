@@ -0,0 +1,241 @@
+package nmclint
+
+import (
+	"apc-p15-tool/pkg/pkcs15"
+	"crypto/x509"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Severity is how likely a finding is to cause the NMC to reject the cert
+type Severity int
+
+const (
+	// informational, the cert is expected to work
+	SeverityInfo Severity = iota
+	// the cert may not work
+	SeverityWarning
+	// the cert is not expected to work
+	SeverityError
+)
+
+// String returns the severity in a log friendly string format.
+func (severity Severity) String() string {
+	switch severity {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+
+	default:
+	}
+
+	return "unknown"
+}
+
+// Device is a network management card generation
+type Device int
+
+const (
+	// applies to (or lint for) all devices
+	DeviceAny Device = iota
+	DeviceNMC2
+	DeviceNMC3
+)
+
+// String returns the device in a log friendly string format.
+func (device Device) String() string {
+	switch device {
+	case DeviceAny:
+		return "any"
+	case DeviceNMC2:
+		return "nmc2"
+	case DeviceNMC3:
+		return "nmc3"
+
+	default:
+	}
+
+	return "unknown"
+}
+
+// FirmwareVersion is an NMC (AOS) firmware version, e.g. v2.5.0.8 is
+// {2, 5, 0, 8} and v6.9.6 is {6, 9, 6, 0}
+type FirmwareVersion [4]int
+
+// ParseFirmwareVersion parses a firmware version such as "v2.5.0.8" or
+// "6.9.6" (the v prefix is optional)
+func ParseFirmwareVersion(s string) (FirmwareVersion, error) {
+	version := FirmwareVersion{}
+
+	parts := strings.Split(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "v"), ".")
+	if len(parts) > len(version) {
+		return FirmwareVersion{}, fmt.Errorf("nmclint: firmware version %q has more than %d parts", s, len(version))
+	}
+
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return FirmwareVersion{}, fmt.Errorf("nmclint: firmware version %q is not valid", s)
+		}
+		version[i] = n
+	}
+
+	return version, nil
+}
+
+// IsZero returns true if the version is not set
+func (version FirmwareVersion) IsZero() bool {
+	return version == FirmwareVersion{}
+}
+
+// Compare returns -1, 0, or +1 depending on whether version is older than,
+// the same as, or newer than other
+func (version FirmwareVersion) Compare(other FirmwareVersion) int {
+	return slices.Compare(version[:], other[:])
+}
+
+// String returns the version in a log friendly string format (e.g., v2.5.0.8
+// or v6.9.6).
+func (version FirmwareVersion) String() string {
+	parts := []string{}
+	for _, n := range version {
+		parts = append(parts, strconv.Itoa(n))
+	}
+
+	// NMC2 versions have 3 parts
+	if version[3] == 0 {
+		parts = parts[:3]
+	}
+
+	return "v" + strings.Join(parts, ".")
+}
+
+// Target is the device (and firmware versions, if only some are affected) that
+// a finding applies to
+type Target struct {
+	Device Device
+	// oldest and newest firmware the finding applies to (zero for no limit)
+	MinFirmware FirmwareVersion
+	MaxFirmware FirmwareVersion
+}
+
+// Includes returns true if the finding applies to device running firmware. A
+// zero firmware (unknown) is always included, as is DeviceAny on either side.
+func (target Target) Includes(device Device, firmware FirmwareVersion) bool {
+	if device != DeviceAny && target.Device != DeviceAny && target.Device != device {
+		return false
+	}
+
+	if firmware.IsZero() {
+		return true
+	}
+	if !target.MinFirmware.IsZero() && firmware.Compare(target.MinFirmware) < 0 {
+		return false
+	}
+	if !target.MaxFirmware.IsZero() && firmware.Compare(target.MaxFirmware) > 0 {
+		return false
+	}
+
+	return true
+}
+
+// String returns the target in a log friendly string format.
+func (target Target) String() string {
+	switch {
+	case target.MinFirmware.IsZero() && target.MaxFirmware.IsZero():
+		return target.Device.String()
+	case target.MaxFirmware.IsZero():
+		return target.Device.String() + " (firmware " + target.MinFirmware.String() + " and newer)"
+	case target.MinFirmware.IsZero():
+		return target.Device.String() + " (firmware " + target.MaxFirmware.String() + " and older)"
+
+	default:
+	}
+
+	return target.Device.String() + " (firmware " + target.MinFirmware.String() + " to " + target.MaxFirmware.String() + ")"
+}
+
+// Finding is a result of a rule
+type Finding struct {
+	// ID of the rule (set by Lint)
+	ID       string
+	Severity Severity
+	Target   Target
+	Message  string
+}
+
+// Input is what the rules check
+type Input struct {
+	Cert *x509.Certificate
+	// time to check the cert's validity against
+	Now time.Time
+}
+
+// Rule checks one aspect of the input and returns any findings
+type Rule struct {
+	ID          string
+	Description string
+	Check       func(in *Input) []Finding
+}
+
+// Lint runs all rules on in and returns the findings that apply to device
+// (all findings if device is DeviceAny)
+func Lint(in *Input, device Device) []Finding {
+	return LintRules(Rules, in, device)
+}
+
+// LintRules runs the specified rules on in and returns the findings that apply
+// to device (all findings if device is DeviceAny)
+func LintRules(rules []Rule, in *Input, device Device) []Finding {
+	findings := []Finding{}
+	for _, rule := range rules {
+		for _, finding := range rule.Check(in) {
+			finding.ID = rule.ID
+			if !finding.Target.Includes(device, FirmwareVersion{}) {
+				continue
+			}
+
+			findings = append(findings, finding)
+		}
+	}
+
+	return findings
+}
+
+// MaxSeverity returns the highest severity of findings (and false if there are
+// no findings)
+func MaxSeverity(findings []Finding) (Severity, bool) {
+	if len(findings) == 0 {
+		return SeverityInfo, false
+	}
+
+	max := SeverityInfo
+	for _, finding := range findings {
+		if finding.Severity > max {
+			max = finding.Severity
+		}
+	}
+
+	return max, true
+}
+
+// KeyTypeSupported returns true if device supports the key type (for NMC3,
+// some key types require newer firmware)
+func KeyTypeSupported(device Device, keyType pkcs15.KeyType) bool {
+	switch device {
+	case DeviceNMC2:
+		return slices.Contains(NMC2KeyTypes, keyType)
+	case DeviceNMC3:
+		return slices.Contains(NMC3KeyTypes, keyType)
+
+	default:
+	}
+
+	return false
+}
@@ -0,0 +1,199 @@
+package nmclint
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testInput returns an input with a cert for the public key of key that is
+// currently valid
+func testInput(t *testing.T, key crypto.Signer, sigAlg x509.SignatureAlgorithm) *Input {
+	t.Helper()
+
+	now := time.Now()
+	return &Input{
+		Cert: &x509.Certificate{
+			PublicKey:          key.Public(),
+			SignatureAlgorithm: sigAlg,
+			NotBefore:          now.Add(-time.Hour),
+			NotAfter:           now.Add(time.Hour),
+		},
+		Now: now,
+	}
+}
+
+// findingIDs returns the IDs of findings
+func findingIDs(findings []Finding) []string {
+	ids := []string{}
+	for _, finding := range findings {
+		ids = append(ids, finding.ID)
+	}
+
+	return ids
+}
+
+func TestLint(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		in     *Input
+		device Device
+		want   []string
+	}{
+		{"rsa sha256 any", testInput(t, rsaKey, x509.SHA256WithRSA), DeviceAny, []string{}},
+		{"rsa sha512 nmc2", testInput(t, rsaKey, x509.SHA512WithRSA), DeviceNMC2, []string{"sig-alg-nmc2-unsupported"}},
+		{"rsa sha512 nmc3", testInput(t, rsaKey, x509.SHA512WithRSA), DeviceNMC3, []string{"sig-alg-nmc3-unknown"}},
+		{"ec nmc2", testInput(t, ecKey, x509.ECDSAWithSHA384), DeviceNMC2, []string{"key-type-nmc2-unsupported", "sig-alg-nmc2-unsupported"}},
+		{"ec nmc3", testInput(t, ecKey, x509.ECDSAWithSHA384), DeviceNMC3, []string{"key-type-nmc3-firmware"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findingIDs(Lint(tt.in, tt.device))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Lint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLintValidityAndExtensions(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := testInput(t, rsaKey, x509.SHA256WithRSA)
+	in.Now = in.Cert.NotAfter.Add(time.Minute)
+	in.Cert.Extensions = []pkix.Extension{
+		{Id: asn1.ObjectIdentifier{2, 5, 29, 15}, Critical: true},
+		{Id: asn1.ObjectIdentifier{2, 5, 29, 37}, Critical: true},
+		{Id: asn1.ObjectIdentifier{1, 2, 3, 4}},
+	}
+
+	findings := Lint(in, DeviceNMC3)
+	want := []string{"cert-expired", "critical-extension-unknown", "extension-unknown"}
+	if got := findingIDs(findings); !slices.Equal(got, want) {
+		t.Fatalf("Lint() = %v, want %v", got, want)
+	}
+
+	// an unknown non-critical extension is only a note
+	if findings[2].Severity != SeverityInfo {
+		t.Errorf("extension-unknown severity is %s (expected %s)", findings[2].Severity, SeverityInfo)
+	}
+
+	maxSeverity, found := MaxSeverity(findings)
+	if !found || maxSeverity != SeverityError {
+		t.Errorf("MaxSeverity() = %s, %t, want %s, true", maxSeverity, found, SeverityError)
+	}
+
+	if _, found := MaxSeverity(nil); found {
+		t.Error("MaxSeverity(nil) found a severity")
+	}
+}
+
+func TestParseFirmwareVersion(t *testing.T) {
+	tests := map[string]FirmwareVersion{
+		"v2.5.0.8": {2, 5, 0, 8},
+		"V6.9.6":   {6, 9, 6, 0},
+		" 1.4 ":    {1, 4, 0, 0},
+		"7":        {7, 0, 0, 0},
+	}
+
+	for s, want := range tests {
+		got, err := ParseFirmwareVersion(s)
+		if err != nil {
+			t.Errorf("%q: parse failed (%s)", s, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: parsed %v (expected %v)", s, got, want)
+		}
+	}
+
+	for _, s := range []string{"", "v", "v1.2.3.4.5", "v1..2", "v1.-2", "v1.2b", "sumx v2.5"} {
+		if _, err := ParseFirmwareVersion(s); err == nil {
+			t.Errorf("%q: expected parse error", s)
+		}
+	}
+}
+
+func TestFirmwareVersionString(t *testing.T) {
+	tests := map[FirmwareVersion]string{
+		{2, 5, 0, 8}: "v2.5.0.8",
+		{6, 9, 6, 0}: "v6.9.6",
+		{2, 0, 0, 0}: "v2.0.0",
+	}
+
+	for version, want := range tests {
+		if got := version.String(); got != want {
+			t.Errorf("%v: String() = %q (expected %q)", [4]int(version), got, want)
+		}
+	}
+}
+
+func TestTargetIncludes(t *testing.T) {
+	v1 := FirmwareVersion{1, 4, 2, 1}
+	v2 := FirmwareVersion{2, 0, 0, 0}
+	v3 := FirmwareVersion{2, 5, 0, 8}
+
+	tests := []struct {
+		name     string
+		target   Target
+		device   Device
+		firmware FirmwareVersion
+		want     bool
+	}{
+		{"any target", Target{Device: DeviceAny}, DeviceNMC2, v1, true},
+		{"any device", Target{Device: DeviceNMC2}, DeviceAny, FirmwareVersion{}, true},
+		{"other device", Target{Device: DeviceNMC2}, DeviceNMC3, FirmwareVersion{}, false},
+		{"unknown firmware", Target{Device: DeviceNMC3, MinFirmware: v2}, DeviceNMC3, FirmwareVersion{}, true},
+		{"below min", Target{Device: DeviceNMC3, MinFirmware: v2}, DeviceNMC3, v1, false},
+		{"at min", Target{Device: DeviceNMC3, MinFirmware: v2}, DeviceNMC3, v2, true},
+		{"above max", Target{Device: DeviceNMC3, MaxFirmware: v2}, DeviceNMC3, v3, false},
+		{"at max", Target{Device: DeviceNMC3, MaxFirmware: v2}, DeviceNMC3, v2, true},
+		{"in range", Target{Device: DeviceNMC3, MinFirmware: v1, MaxFirmware: v3}, DeviceNMC3, v2, true},
+		{"in range other device", Target{Device: DeviceNMC3, MinFirmware: v1, MaxFirmware: v3}, DeviceNMC2, v2, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.target.Includes(tt.device, tt.firmware); got != tt.want {
+			t.Errorf("%s: Includes() = %t (expected %t)", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTargetString(t *testing.T) {
+	v1 := FirmwareVersion{1, 4, 2, 1}
+	v2 := FirmwareVersion{6, 9, 6, 0}
+
+	tests := map[string]Target{
+		"nmc3":                               {Device: DeviceNMC3},
+		"nmc3 (firmware v1.4.2.1 and newer)": {Device: DeviceNMC3, MinFirmware: v1},
+		"nmc2 (firmware v6.9.6 and older)":   {Device: DeviceNMC2, MaxFirmware: v2},
+		"any (firmware v1.4.2.1 to v6.9.6)":  {Device: DeviceAny, MinFirmware: v1, MaxFirmware: v2},
+	}
+
+	for want, target := range tests {
+		if got := target.String(); got != want {
+			t.Errorf("String() = %q (expected %q)", got, want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package nmclint
+
+import (
+	"apc-p15-tool/pkg/pkcs15"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// list of keys supported by the NMC2
+var NMC2KeyTypes = []pkcs15.KeyType{
+	pkcs15.KeyTypeRSA1024,
+	pkcs15.KeyTypeRSA2048,
+	pkcs15.KeyTypeRSA3072, // officially not supported but works
+}
+
+// list of keys supported by the NMC3 (requires newer firmware for some types)
+var NMC3KeyTypes = []pkcs15.KeyType{
+	pkcs15.KeyTypeRSA1024,
+	pkcs15.KeyTypeRSA2048,
+	pkcs15.KeyTypeRSA3072,
+	pkcs15.KeyTypeRSA4096,
+	pkcs15.KeyTypeECP256,
+	pkcs15.KeyTypeECP384,
+	pkcs15.KeyTypeECP521,
+}
+
+// known good signing algorithms
+var NMC2SigningAlgs = []x509.SignatureAlgorithm{
+	x509.SHA256WithRSA,
+}
+
+var NMC3SigningAlgs = append(slices.Clone(NMC2SigningAlgs), []x509.SignatureAlgorithm{
+	x509.ECDSAWithSHA384,
+}...)
+
+// known supported cert extensions
+var SupportedCriticalExtensions = []asn1.ObjectIdentifier{
+	{2, 5, 29, 15}, // keyUsage
+	{2, 5, 29, 19}, // basicConstraints
+	{2, 5, 29, 17}, // subjectAltName
+}
+
+var SupportedExtensions = append(slices.Clone(SupportedCriticalExtensions), []asn1.ObjectIdentifier{
+	{2, 5, 29, 37},                     // extKeyUsage
+	{2, 5, 29, 14},                     // subjectKeyIdentifier
+	{2, 5, 29, 35},                     // authorityKeyIdentifier
+	{1, 3, 6, 1, 5, 5, 7, 1, 1},        // authorityInfoAccess
+	{2, 5, 29, 32},                     // certificatePolicies
+	{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}, // googleSignedCertificateTimestamp
+	{2, 5, 29, 31},                     // cRLDistributionPoints
+}...)
+
+// time format used in messages
+const timeMessageFormat = time.RFC1123Z
+
+// Rules are the default rules (see: https://github.com/gregtwallace/apc-p15-tool/issues/18
+// for signing algorithms)
+var Rules = []Rule{
+	{
+		ID:          "key-type-nmc2-unsupported",
+		Description: "the key type is not supported by NMC2",
+		Check: func(in *Input) []Finding {
+			keyType := pkcs15.PublicKeyType(in.Cert.PublicKey)
+			if KeyTypeSupported(DeviceNMC2, keyType) {
+				return nil
+			}
+
+			return []Finding{{
+				Severity: SeverityError,
+				Target:   Target{Device: DeviceNMC2},
+				Message:  fmt.Sprintf("key type is %s and is not supported by NMC2.", keyType),
+			}}
+		},
+	},
+	{
+		ID:          "key-type-nmc3-unsupported",
+		Description: "the key type is not supported by NMC3",
+		Check: func(in *Input) []Finding {
+			keyType := pkcs15.PublicKeyType(in.Cert.PublicKey)
+			if KeyTypeSupported(DeviceNMC3, keyType) {
+				return nil
+			}
+
+			return []Finding{{
+				Severity: SeverityError,
+				Target:   Target{Device: DeviceNMC3},
+				Message:  fmt.Sprintf("key type is %s and is not supported by NMC3.", keyType),
+			}}
+		},
+	},
+	{
+		ID:          "key-type-nmc3-firmware",
+		Description: "the key type is only supported by newer NMC3 firmware",
+		Check: func(in *Input) []Finding {
+			keyType := pkcs15.PublicKeyType(in.Cert.PublicKey)
+			if KeyTypeSupported(DeviceNMC2, keyType) || !KeyTypeSupported(DeviceNMC3, keyType) {
+				return nil
+			}
+
+			// the first firmware version with the ssl command is not known, so
+			// the target has no firmware range
+			return []Finding{{
+				Severity: SeverityInfo,
+				Target:   Target{Device: DeviceNMC3},
+				Message:  fmt.Sprintf("key type is %s and requires NMC3 firmware that has the ssl command.", keyType),
+			}}
+		},
+	},
+	{
+		ID:          "sig-alg-nmc2-unsupported",
+		Description: "the certificate signing algorithm is not supported by NMC2",
+		Check: func(in *Input) []Finding {
+			if slices.Contains(NMC2SigningAlgs, in.Cert.SignatureAlgorithm) {
+				return nil
+			}
+
+			return []Finding{{
+				Severity: SeverityError,
+				Target:   Target{Device: DeviceNMC2},
+				Message:  fmt.Sprintf("Certificate signing algorithm is %s and it does not support NMC2.", in.Cert.SignatureAlgorithm),
+			}}
+		},
+	},
+	{
+		ID:          "sig-alg-nmc3-unknown",
+		Description: "it is not known if NMC3 supports the certificate signing algorithm",
+		Check: func(in *Input) []Finding {
+			if slices.Contains(NMC3SigningAlgs, in.Cert.SignatureAlgorithm) {
+				return nil
+			}
+
+			return []Finding{{
+				Severity: SeverityWarning,
+				Target:   Target{Device: DeviceNMC3},
+				Message:  fmt.Sprintf("Certificate signing algorithm is %s and it is not known if NMC3 supports this algorithm.", in.Cert.SignatureAlgorithm),
+			}}
+		},
+	},
+	{
+		ID:          "cert-not-yet-valid",
+		Description: "the certificate is not valid yet",
+		Check: func(in *Input) []Finding {
+			if !in.Now.Before(in.Cert.NotBefore) {
+				return nil
+			}
+
+			return []Finding{{
+				Severity: SeverityWarning,
+				Target:   Target{Device: DeviceAny},
+				Message: fmt.Sprintf("Current time (%s) is before certificate's NotBefore time (%s).",
+					in.Now.Local().Format(timeMessageFormat), in.Cert.NotBefore.Local().Format(timeMessageFormat)),
+			}}
+		},
+	},
+	{
+		ID:          "cert-expired",
+		Description: "the certificate is expired",
+		Check: func(in *Input) []Finding {
+			if !in.Now.After(in.Cert.NotAfter) {
+				return nil
+			}
+
+			return []Finding{{
+				Severity: SeverityError,
+				Target:   Target{Device: DeviceAny},
+				Message: fmt.Sprintf("Current time (%s) is after certificate's NotAfter time (%s).",
+					in.Now.Local().Format(timeMessageFormat), in.Cert.NotAfter.Local().Format(timeMessageFormat)),
+			}}
+		},
+	},
+	{
+		ID:          "critical-extension-unknown",
+		Description: "the certificate has a critical extension that may not be supported",
+		Check: func(in *Input) []Finding {
+			findings := []Finding{}
+			for _, extension := range in.Cert.Extensions {
+				if !extension.Critical || oidIn(SupportedCriticalExtensions, extension.Id) {
+					continue
+				}
+
+				findings = append(findings, Finding{
+					Severity: SeverityWarning,
+					Target:   Target{Device: DeviceAny},
+					Message:  fmt.Sprintf("Critical Extension %s may not be supported by NMC.", extension.Id),
+				})
+			}
+
+			return findings
+		},
+	},
+	{
+		ID:          "extension-unknown",
+		Description: "the certificate has an extension that may not be supported",
+		Check: func(in *Input) []Finding {
+			findings := []Finding{}
+			for _, extension := range in.Cert.Extensions {
+				if extension.Critical || oidIn(SupportedExtensions, extension.Id) {
+					continue
+				}
+
+				// NMCs are not known to reject a cert for a non-critical
+				// extension, so this is only a note
+				findings = append(findings, Finding{
+					Severity: SeverityInfo,
+					Target:   Target{Device: DeviceAny},
+					Message:  fmt.Sprintf("Extension %s may not be supported by NMC.", extension.Id),
+				})
+			}
+
+			return findings
+		},
+	},
+}
+
+// oidIn returns true if oid is in oids
+func oidIn(oids []asn1.ObjectIdentifier, oid asn1.ObjectIdentifier) bool {
+	return slices.ContainsFunc(oids, oid.Equal)
+}
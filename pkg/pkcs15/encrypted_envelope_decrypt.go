@@ -0,0 +1,498 @@
+package pkcs15
+
+import (
+	"apc-p15-tool/pkg/tools"
+	"apc-p15-tool/pkg/tools/asn1obj"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	errEnvelopeBadStructure = errors.New("pkcs15: envelope: unexpected structure")
+	errEnvelopeBadCEK       = errors.New("pkcs15: envelope: failed to unwrap content encryption key (wrong password or corrupt file?)")
+	errEnvelopeBadMAC       = errors.New("pkcs15: envelope: mac verification failed")
+	errEnvelopeBadContent   = errors.New("pkcs15: envelope: failed to decrypt content")
+	errPBKDF2Iterations     = errors.New("pkcs15: pbkdf2 iteration count is too high")
+)
+
+// pbkdf2MaxIterations is the highest pbkdf2 iteration count accepted from a
+// file; it is well above what apc (5,000) and openssl (2,048) use, but stops
+// a crafted file from hanging the tool in key derivation
+const pbkdf2MaxIterations = 10_000_000
+
+// authEnvelopedData holds the values of a password protected (pwri)
+// AuthEnvelopedData, as parsed from the envelope bytes
+type authEnvelopedData struct {
+	// keyDerivationAlgorithm (pbkdf2) params
+	kdfSalt       []byte
+	kdfIterations int
+	kdfKeyLength  int // 0 if not specified
+	kdfPRF        asn1.ObjectIdentifier
+
+	// keyEncryptionAlgorithm (pwriKEK) params
+	kekAlg       asn1.ObjectIdentifier
+	kekIV        []byte
+	encryptedCEK []byte
+
+	// EncryptedContentInfo
+	contentAlg       asn1.ObjectIdentifier
+	contentAlgObj    []byte // the full algorithm object, as it is covered by the MAC
+	contentEncAlg    asn1.ObjectIdentifier
+	contentEncIV     []byte
+	macAlg           asn1.ObjectIdentifier
+	encryptedContent []byte
+
+	mac []byte
+}
+
+// hmacHashFunc returns the hash function for the specified HMAC algorithm
+func hmacHashFunc(oid asn1.ObjectIdentifier) (func() hash.Hash, error) {
+	switch {
+	case oid.Equal(asn1obj.OIDhmacWithSHA1):
+		return sha1.New, nil
+	case oid.Equal(asn1obj.OIDhmacWithSHA256):
+		return sha256.New, nil
+	case oid.Equal(asn1obj.OIDhmacWithSHA384):
+		return sha512.New384, nil
+	case oid.Equal(asn1obj.OIDhmacWithSHA512):
+		return sha512.New, nil
+
+	default:
+	}
+
+	return nil, fmt.Errorf("pkcs15: envelope: unsupported hmac algorithm %s", oid)
+}
+
+// cbcKeyLength returns the key length for the specified CBC encryption
+// algorithm
+func cbcKeyLength(oid asn1.ObjectIdentifier) (int, error) {
+	switch {
+	case oid.Equal(asn1obj.OIDdesEDE3CBC):
+		return 24, nil
+	case oid.Equal(asn1obj.OIDaes128CBC):
+		return 16, nil
+	case oid.Equal(asn1obj.OIDaes192CBC):
+		return 24, nil
+	case oid.Equal(asn1obj.OIDaes256CBC):
+		return 32, nil
+
+	default:
+	}
+
+	return 0, fmt.Errorf("pkcs15: envelope: unsupported encryption algorithm %s", oid)
+}
+
+// newCBCBlockCipher returns the block cipher for the specified CBC encryption
+// algorithm and key
+func newCBCBlockCipher(oid asn1.ObjectIdentifier, key []byte) (cipher.Block, error) {
+	if oid.Equal(asn1obj.OIDdesEDE3CBC) {
+		return des.NewTripleDESCipher(key)
+	}
+
+	return aes.NewCipher(key)
+}
+
+// parseOID parses node as an OBJECT IDENTIFIER
+func parseOID(node *asn1obj.Node) (asn1.ObjectIdentifier, error) {
+	oid, err := node.AsOID()
+	if err != nil {
+		return nil, errEnvelopeBadStructure
+	}
+
+	return oid, nil
+}
+
+// parseCBCAlgorithm parses a CBC encryption AlgorithmIdentifier and returns
+// the algorithm and its IV
+func parseCBCAlgorithm(algId *asn1obj.Node) (asn1.ObjectIdentifier, []byte, error) {
+	if len(algId.Children) != 2 {
+		return nil, nil, errEnvelopeBadStructure
+	}
+
+	oid, err := parseOID(algId.Children[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// verify alg is supported
+	_, err = cbcKeyLength(oid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	iv, err := algId.Children[1].AsOctetString()
+	if err != nil || !algId.Children[1].Is(asn1.ClassUniversal, asn1.TagOctetString) {
+		return nil, nil, errEnvelopeBadStructure
+	}
+
+	return oid, iv, nil
+}
+
+// parsePBKDF2Params parses PBKDF2-params and returns the salt, iteration
+// count, key length (0 if not specified), and prf
+func parsePBKDF2Params(params *asn1obj.Node) ([]byte, int, int, asn1.ObjectIdentifier, error) {
+	kdfParams := params.Children
+	if !params.Is(asn1.ClassUniversal, asn1.TagSequence) || len(kdfParams) < 2 {
+		return nil, 0, 0, nil, errEnvelopeBadStructure
+	}
+
+	// salt (only specified, not otherSource)
+	if !kdfParams[0].Is(asn1.ClassUniversal, asn1.TagOctetString) {
+		return nil, 0, 0, nil, errEnvelopeBadStructure
+	}
+	salt := kdfParams[0].Value
+
+	// iterationCount
+	iterations, err := kdfParams[1].AsInt()
+	if err != nil || iterations <= 0 {
+		return nil, 0, 0, nil, errEnvelopeBadStructure
+	}
+	if iterations > pbkdf2MaxIterations {
+		return nil, 0, 0, nil, fmt.Errorf("%w (%d, max %d)", errPBKDF2Iterations, iterations, pbkdf2MaxIterations)
+	}
+
+	// keyLength OPTIONAL and prf DEFAULT hmacWithSHA1
+	keyLength := 0
+	prf := asn1obj.OIDhmacWithSHA1
+	for _, kdfParam := range kdfParams[2:] {
+		switch {
+		case kdfParam.Is(asn1.ClassUniversal, asn1.TagInteger):
+			keyLength, err = kdfParam.AsInt()
+			if err != nil {
+				return nil, 0, 0, nil, errEnvelopeBadStructure
+			}
+
+		case kdfParam.Is(asn1.ClassUniversal, asn1.TagSequence):
+			if len(kdfParam.Children) < 1 {
+				return nil, 0, 0, nil, errEnvelopeBadStructure
+			}
+			prf, err = parseOID(kdfParam.Children[0])
+			if err != nil {
+				return nil, 0, 0, nil, err
+			}
+
+		default:
+			return nil, 0, 0, nil, errEnvelopeBadStructure
+		}
+	}
+
+	_, err = hmacHashFunc(prf)
+	if err != nil {
+		return nil, 0, 0, nil, err
+	}
+
+	return salt, iterations, keyLength, prf, nil
+}
+
+// parseAuthEnvelopedData parses the values of an AuthEnvelopedData that uses
+// a password recipient (pwri)
+func parseAuthEnvelopedData(envelope []byte) (*authEnvelopedData, error) {
+	env := &authEnvelopedData{}
+
+	// AuthEnvelopedData Type
+	envElements, err := asn1obj.DecodeAll(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs15: envelope: failed to parse (%w)", err)
+	}
+	if len(envElements) != 4 {
+		// originatorInfo and authAttrs are not used by APC and are not supported
+		return nil, errEnvelopeBadStructure
+	}
+
+	// RecipientInfos -> pwri [3] PasswordRecipientinfo
+	if !envElements[1].Is(asn1.ClassUniversal, asn1.TagSet) {
+		return nil, errEnvelopeBadStructure
+	}
+	pwri, found := envElements[1].Child(asn1.ClassContextSpecific, 3)
+	if !found {
+		return nil, errors.New("pkcs15: envelope: password recipient info not found")
+	}
+	if len(pwri.Children) != 4 {
+		return nil, errEnvelopeBadStructure
+	}
+
+	// keyDerivationAlgorithm [0]
+	kdfAlg := pwri.Children[1]
+	if len(kdfAlg.Children) != 2 {
+		return nil, errEnvelopeBadStructure
+	}
+	kdfAlgOID, err := parseOID(kdfAlg.Children[0])
+	if err != nil {
+		return nil, err
+	}
+	if !kdfAlgOID.Equal(asn1obj.OIDpkcs5PBKDF2) {
+		return nil, fmt.Errorf("pkcs15: envelope: unsupported key derivation algorithm %s", kdfAlgOID)
+	}
+
+	// PBKDF2-params
+	env.kdfSalt, env.kdfIterations, env.kdfKeyLength, env.kdfPRF, err = parsePBKDF2Params(kdfAlg.Children[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// keyEncryptionAlgorithm (for CEK)
+	kekAlg := pwri.Children[2]
+	if len(kekAlg.Children) != 2 {
+		return nil, errEnvelopeBadStructure
+	}
+	kekAlgOID, err := parseOID(kekAlg.Children[0])
+	if err != nil {
+		return nil, err
+	}
+	if !kekAlgOID.Equal(asn1obj.OIDpwriKEK) {
+		return nil, fmt.Errorf("pkcs15: envelope: unsupported key encryption algorithm %s", kekAlgOID)
+	}
+	env.kekAlg, env.kekIV, err = parseCBCAlgorithm(kekAlg.Children[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// EncryptedKey
+	if !pwri.Children[3].Is(asn1.ClassUniversal, asn1.TagOctetString) {
+		return nil, errEnvelopeBadStructure
+	}
+	env.encryptedCEK = pwri.Children[3].Value
+
+	// EncryptedContentInfo
+	if !envElements[2].Is(asn1.ClassUniversal, asn1.TagSequence) || len(envElements[2].Children) != 3 {
+		return nil, errEnvelopeBadStructure
+	}
+	encContentInfo := envElements[2].Children
+	contentType, err := parseOID(encContentInfo[0])
+	if err != nil {
+		return nil, err
+	}
+	if !contentType.Equal(asn1obj.OIDpkcs7Data) {
+		return nil, fmt.Errorf("pkcs15: envelope: unsupported content type %s", contentType)
+	}
+
+	// content encryption alg OBJ (authEnc)
+	env.contentAlgObj = encContentInfo[1].Raw
+	contentAlg := encContentInfo[1].Children
+	if len(contentAlg) != 2 {
+		return nil, errEnvelopeBadStructure
+	}
+	env.contentAlg, err = parseOID(contentAlg[0])
+	if err != nil {
+		return nil, err
+	}
+	if !env.contentAlg.Equal(asn1obj.OIDauthEnc128) && !env.contentAlg.Equal(asn1obj.OIDauthEnc256) {
+		return nil, fmt.Errorf("pkcs15: envelope: unsupported content encryption algorithm %s", env.contentAlg)
+	}
+
+	// authEnc params (prfAlgorithm [0] is not supported, it is always the default)
+	contentAlgParams := contentAlg[1].Children
+	if len(contentAlgParams) != 2 {
+		return nil, errEnvelopeBadStructure
+	}
+	env.contentEncAlg, env.contentEncIV, err = parseCBCAlgorithm(contentAlgParams[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(contentAlgParams[1].Children) < 1 {
+		return nil, errEnvelopeBadStructure
+	}
+	env.macAlg, err = parseOID(contentAlgParams[1].Children[0])
+	if err != nil {
+		return nil, err
+	}
+	_, err = hmacHashFunc(env.macAlg)
+	if err != nil {
+		return nil, err
+	}
+
+	// [0] IMPLICIT EncryptedContent
+	if !encContentInfo[2].Is(asn1.ClassContextSpecific, 0) || encContentInfo[2].Constructed {
+		return nil, errEnvelopeBadStructure
+	}
+	env.encryptedContent = encContentInfo[2].Value
+
+	// MAC
+	if !envElements[3].Is(asn1.ClassUniversal, asn1.TagOctetString) {
+		return nil, errEnvelopeBadStructure
+	}
+	env.mac = envElements[3].Value
+
+	return env, nil
+}
+
+// unwrapCEK derives the KEK from the password and uses it to unwrap the
+// content encryption key, see: rfc3211 2.3.2
+func (env *authEnvelopedData) unwrapCEK(password []byte) ([]byte, error) {
+	// kek
+	kekSize, err := cbcKeyLength(env.kekAlg)
+	if err != nil {
+		return nil, err
+	}
+	if env.kdfKeyLength != 0 && env.kdfKeyLength != kekSize {
+		return nil, errEnvelopeBadStructure
+	}
+
+	kekHash, err := hmacHashFunc(env.kdfPRF)
+	if err != nil {
+		return nil, err
+	}
+
+	kek := pbkdf2.Key(password, env.kdfSalt, env.kdfIterations, kekSize, kekHash)
+
+	cekCipher, err := newCBCBlockCipher(env.kekAlg, kek)
+	if err != nil {
+		return nil, err
+	}
+
+	blockSize := cekCipher.BlockSize()
+	if len(env.kekIV) != blockSize || len(env.encryptedCEK) < 2*blockSize || len(env.encryptedCEK)%blockSize != 0 {
+		return nil, errEnvelopeBadCEK
+	}
+
+	// decrypt last block using n-1 block as IV, which results in the IV for
+	// the outer layer of encryption
+	n := len(env.encryptedCEK)
+	outerIV := make([]byte, blockSize)
+	cipher.NewCBCDecrypter(cekCipher, env.encryptedCEK[n-2*blockSize:n-blockSize]).
+		CryptBlocks(outerIV, env.encryptedCEK[n-blockSize:])
+
+	// strip outer layer
+	encryptedCEKOnly1Rd := make([]byte, n)
+	cipher.NewCBCDecrypter(cekCipher, outerIV).CryptBlocks(encryptedCEKOnly1Rd, env.encryptedCEK)
+
+	// strip inner layer (using the original IV)
+	wrappedCEK := make([]byte, n)
+	cipher.NewCBCDecrypter(cekCipher, env.kekIV).CryptBlocks(wrappedCEK, encryptedCEKOnly1Rd)
+
+	// LEN + Check Val [3] + CEK (+ padding)
+	cekLen := int(wrappedCEK[0])
+	if cekLen < 3 || 4+cekLen > n {
+		return nil, errEnvelopeBadCEK
+	}
+	cek := wrappedCEK[4 : 4+cekLen]
+
+	if !tools.IsBitwiseCompliment(wrappedCEK[1:4], cek[:3]) {
+		return nil, errEnvelopeBadCEK
+	}
+
+	return cek, nil
+}
+
+// decrypt unwraps the CEK, verifies the MAC, and then returns the decrypted
+// envelope content
+func (env *authEnvelopedData) decrypt(password []byte) ([]byte, error) {
+	cek, err := env.unwrapCEK(password)
+	if err != nil {
+		return nil, err
+	}
+
+	// verify MAC before doing anything with the content
+	macHash, err := hmacHashFunc(env.macAlg)
+	if err != nil {
+		return nil, err
+	}
+	macKey := pbkdf2.Key(cek, []byte("authentication"), 1, macHash().Size(), sha1.New)
+
+	macHasher := hmac.New(macHash, macKey)
+	// the data the MAC covers is the algId header bytes + encrypted data bytes
+	_, err = macHasher.Write(env.contentAlgObj)
+	if err != nil {
+		return nil, err
+	}
+	_, err = macHasher.Write(env.encryptedContent)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal(macHasher.Sum(nil), env.mac) {
+		return nil, errEnvelopeBadMAC
+	}
+
+	// content decryption
+	contentKeySize, err := cbcKeyLength(env.contentEncAlg)
+	if err != nil {
+		return nil, err
+	}
+
+	contentEncryptKey := pbkdf2.Key(cek, []byte("encryption"), 1, contentKeySize, sha1.New)
+	contentCipher, err := newCBCBlockCipher(env.contentEncAlg, contentEncryptKey)
+	if err != nil {
+		return nil, err
+	}
+
+	blockSize := contentCipher.BlockSize()
+	if len(env.contentEncIV) != blockSize || len(env.encryptedContent) == 0 || len(env.encryptedContent)%blockSize != 0 {
+		return nil, errEnvelopeBadContent
+	}
+
+	content := make([]byte, len(env.encryptedContent))
+	cipher.NewCBCDecrypter(contentCipher, env.contentEncIV).CryptBlocks(content, env.encryptedContent)
+
+	// remove padding, see: https://datatracker.ietf.org/doc/html/rfc3852 6.3
+	contentPadLen := int(content[len(content)-1])
+	if contentPadLen == 0 || contentPadLen > blockSize {
+		return nil, errEnvelopeBadContent
+	}
+	for _, b := range content[len(content)-contentPadLen:] {
+		if int(b) != contentPadLen {
+			return nil, errEnvelopeBadContent
+		}
+	}
+
+	return content[:len(content)-contentPadLen], nil
+}
+
+// DecryptKeyEnvelope decrypts a password protected AuthEnvelopedData
+// (envelope) that contains a private key. The key derivation (salt,
+// iterations, and prf), key wrap, content encryption, and MAC algorithms are
+// all read from the envelope. The MAC is verified before the content is
+// decrypted. The public key is required since the envelope only contains the
+// private values of the key.
+func DecryptKeyEnvelope(envelope []byte, password string, publicKey crypto.PublicKey) (crypto.PrivateKey, error) {
+	env, err := parseAuthEnvelopedData(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	privKeyObj, err := env.decrypt([]byte(password))
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePrivateKeyObject(privKeyObj, publicKey)
+}
+
+// VerifyKeyEnvelope decrypts p15's encrypted envelope and verifies the
+// private key inside of the envelope matches p15's private key.
+func (p15 *pkcs15KeyCert) VerifyKeyEnvelope() error {
+	// encrypted envelope is required
+	err := p15.computeEncryptedKeyEnvelope()
+	if err != nil {
+		return err
+	}
+
+	signer, ok := p15.key.(crypto.Signer)
+	if !ok {
+		return errKeyWrongType
+	}
+
+	envKey, err := DecryptKeyEnvelope(p15.envelopedPrivateKey, apcKEKPassword, signer.Public())
+	if err != nil {
+		return err
+	}
+
+	if !privateKeysEqual(p15.key, envKey) {
+		return errors.New("pkcs15: envelope: decrypted private key does not match")
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package pkcs15
+
+import (
+	"apc-p15-tool/pkg/tools/asn1obj"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// envelope encrypt -> decrypt should return the original key
+func TestKeyEnvelopeRoundTrip(t *testing.T) {
+	for name, key := range testKeys(t) {
+		keyPem, certPem := testKeyCertPem(t, key)
+
+		p15, err := ParsePEMToPKCS15(keyPem, certPem)
+		if err != nil {
+			t.Fatalf("%s: failed to parse pem (%s)", name, err)
+		}
+
+		err = p15.VerifyKeyEnvelope()
+		if err != nil {
+			t.Errorf("%s: envelope verification failed (%s)", name, err)
+		}
+
+		// wrong password
+		_, err = DecryptKeyEnvelope(p15.envelopedPrivateKey, "wrong", key.Public())
+		if !errors.Is(err, errEnvelopeBadCEK) {
+			t.Errorf("%s: expected cek error for wrong password but got: %v", name, err)
+		}
+
+		// modified mac
+		badMac := append([]byte{}, p15.envelopedPrivateKey...)
+		badMac[len(badMac)-1] ^= 0x01
+		_, err = DecryptKeyEnvelope(badMac, apcKEKPassword, key.Public())
+		if !errors.Is(err, errEnvelopeBadMAC) {
+			t.Errorf("%s: expected mac error for modified mac but got: %v", name, err)
+		}
+
+		// modified content (last byte of content is 2 bytes before the mac
+		// OCTET STRING header and value)
+		badContent := append([]byte{}, p15.envelopedPrivateKey...)
+		badContent[len(badContent)-32-2-1] ^= 0x01
+		_, err = DecryptKeyEnvelope(badContent, apcKEKPassword, key.Public())
+		if !errors.Is(err, errEnvelopeBadMAC) {
+			t.Errorf("%s: expected mac error for modified content but got: %v", name, err)
+		}
+	}
+}
+
+// pbkdf2 params with a huge iteration count must be rejected (not derived)
+func TestParsePBKDF2ParamsIterations(t *testing.T) {
+	tests := []struct {
+		iterations int64
+		wantErr    error
+	}{
+		{iterations: 5000},
+		{iterations: pbkdf2MaxIterations},
+		{iterations: 0, wantErr: errEnvelopeBadStructure},
+		{iterations: pbkdf2MaxIterations + 1, wantErr: errPBKDF2Iterations},
+		{iterations: 1<<31 - 1, wantErr: errPBKDF2Iterations},
+	}
+
+	for _, test := range tests {
+		params, err := asn1obj.Decode(asn1obj.Sequence([][]byte{
+			asn1obj.OctetString([]byte("salt1234")),
+			asn1obj.Integer(big.NewInt(test.iterations)),
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, iterations, _, _, err := parsePBKDF2Params(params)
+		if test.wantErr != nil {
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("%d: expected error %v but got: %v", test.iterations, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || int64(iterations) != test.iterations {
+			t.Errorf("%d: unexpected result %d (%v)", test.iterations, iterations, err)
+		}
+	}
+}
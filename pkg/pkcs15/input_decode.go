@@ -0,0 +1,197 @@
+package pkcs15
+
+import (
+	"apc-p15-tool/pkg/tools/asn1obj"
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"strings"
+)
+
+var (
+	errInputFormatUnknown = errors.New("pkcs15: input: could not detect format (expected pem, der, or base64)")
+	errInputNotBase64     = errors.New("pkcs15: input: failed to decode base64")
+	errInputDerKey        = errors.New("pkcs15: input: der is not a supported private key (PKCS8, PKCS1, SEC1, or encrypted PKCS8)")
+	errInputDerCert       = errors.New("pkcs15: input: der is not a certificate")
+)
+
+// InputFormat is the encoding of a key or cert input
+type InputFormat int
+
+const (
+	InputFormatAuto InputFormat = iota
+	InputFormatPEM
+	InputFormatDER
+	InputFormatBase64
+)
+
+// String returns the input format in a log friendly string format.
+func (format InputFormat) String() string {
+	switch format {
+	case InputFormatAuto:
+		return "auto"
+	case InputFormatPEM:
+		return "PEM"
+	case InputFormatDER:
+		return "DER"
+	case InputFormatBase64:
+		return "base64"
+
+	default:
+	}
+
+	return "unknown input format"
+}
+
+// inputBase64Decode decodes base64 that may contain whitespace (e.g., line
+// breaks) and may use either the standard or url alphabet, with or without
+// padding
+func inputBase64Decode(input []byte) ([]byte, error) {
+	s := strings.Join(strings.Fields(string(input)), "")
+	s = strings.TrimRight(s, "=")
+	s = strings.NewReplacer("-", "+", "_", "/").Replace(s)
+
+	decoded, err := base64.RawStdEncoding.DecodeString(s)
+	if err != nil || len(decoded) == 0 {
+		return nil, errInputNotBase64
+	}
+
+	return decoded, nil
+}
+
+// pemUnescapeNewlines replaces literal \n with newlines in pem that has no
+// actual newlines (e.g., pem that was put on one line in an env var)
+func pemUnescapeNewlines(input []byte) []byte {
+	if bytes.IndexByte(input, '\n') >= 0 {
+		return input
+	}
+
+	return bytes.ReplaceAll(input, []byte(`\n`), []byte("\n"))
+}
+
+// inputToDerOrPem decodes input in the specified format and returns either pem
+// (isPem true) or der
+func inputToDerOrPem(input []byte, format InputFormat) (out []byte, isPem bool, err error) {
+	switch format {
+	case InputFormatPEM:
+		return pemUnescapeNewlines(input), true, nil
+
+	case InputFormatDER:
+		return input, false, nil
+
+	case InputFormatBase64:
+		decoded, err := inputBase64Decode(input)
+		if err != nil {
+			return nil, false, err
+		}
+
+		// base64 of a pem file is still pem
+		if bytes.Contains(decoded, []byte("-----BEGIN ")) {
+			return decoded, true, nil
+		}
+
+		return decoded, false, nil
+
+	case InputFormatAuto:
+		if bytes.Contains(input, []byte("-----BEGIN ")) {
+			return pemUnescapeNewlines(input), true, nil
+		}
+
+		// der always starts with a SEQUENCE for keys and certs
+		if len(input) > 0 && input[0] == 0x30 {
+			_, err := asn1obj.DecodeAll(input)
+			if err == nil {
+				return input, false, nil
+			}
+		}
+
+		out, isPem, err = inputToDerOrPem(input, InputFormatBase64)
+		if err == nil {
+			return out, isPem, nil
+		}
+
+		// not canonical der, but not base64 either; let the parser decide
+		if len(input) > 0 && input[0] == 0x30 {
+			return input, false, nil
+		}
+
+		return nil, false, errInputFormatUnknown
+
+	default:
+	}
+
+	return nil, false, errInputFormatUnknown
+}
+
+// derKeyPemType returns the pem block type of a der private key
+func derKeyPemType(der []byte) (string, error) {
+	if _, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return "PRIVATE KEY", nil
+	}
+	if _, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return "RSA PRIVATE KEY", nil
+	}
+	if _, err := x509.ParseECPrivateKey(der); err == nil {
+		return "EC PRIVATE KEY", nil
+	}
+
+	// EncryptedPrivateKeyInfo ::= SEQUENCE { AlgorithmIdentifier, OCTET STRING }
+	node, err := asn1obj.Decode(der)
+	if err == nil && node.Is(asn1.ClassUniversal, asn1.TagSequence) && len(node.Children) == 2 &&
+		node.Children[0].Is(asn1.ClassUniversal, asn1.TagSequence) && len(node.Children[0].Children) > 0 &&
+		node.Children[0].Children[0].Is(asn1.ClassUniversal, asn1.TagOID) &&
+		node.Children[1].Is(asn1.ClassUniversal, asn1.TagOctetString) {
+		return "ENCRYPTED PRIVATE KEY", nil
+	}
+
+	return "", errInputDerKey
+}
+
+// KeyInputToPem returns the private key input (pem, der, or base64 of either)
+// in pem format. If format is InputFormatAuto, the format is detected. Pem
+// input is returned unchanged.
+func KeyInputToPem(input []byte, format InputFormat) ([]byte, error) {
+	out, isPem, err := inputToDerOrPem(input, format)
+	if err != nil {
+		return nil, err
+	}
+	if isPem {
+		return out, nil
+	}
+
+	blockType, err := derKeyPemType(out)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: out}), nil
+}
+
+// CertInputToPem returns the certificate input (pem, der, or base64 of
+// either) in pem format. Der input can contain multiple concatenated
+// certificates (e.g., a chain). If format is InputFormatAuto, the format is
+// detected. Pem input is returned unchanged.
+func CertInputToPem(input []byte, format InputFormat) ([]byte, error) {
+	out, isPem, err := inputToDerOrPem(input, format)
+	if err != nil {
+		return nil, err
+	}
+	if isPem {
+		return out, nil
+	}
+
+	certs, err := x509.ParseCertificates(out)
+	if err != nil || len(certs) == 0 {
+		return nil, errInputDerCert
+	}
+
+	certPem := []byte{}
+	for _, cert := range certs {
+		certPem = append(certPem, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+
+	return certPem, nil
+}
@@ -0,0 +1,151 @@
+package pkcs15
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testBase64Forms returns the forms of base64 that tooling might produce
+func testBase64Forms(data []byte) map[string][]byte {
+	std := base64.StdEncoding.EncodeToString(data)
+
+	// wrapped at 64 chars (like pem content)
+	wrapped := ""
+	for i := 0; i < len(std); i += 64 {
+		wrapped += std[i:min(i+64, len(std))] + "\n"
+	}
+
+	return map[string][]byte{
+		"base64":         []byte(std),
+		"base64 wrapped": []byte(wrapped),
+		"base64 url raw": []byte(base64.RawURLEncoding.EncodeToString(data)),
+	}
+}
+
+// every input form must decode to the same key and cert
+func TestInputToPem(t *testing.T) {
+	_, keyPem, certPem := testKeyCert(t)
+	keyBlock, _ := pem.Decode(keyPem)
+	certBlock, _ := pem.Decode(certPem)
+
+	// key
+	keyInputs := map[string][]byte{
+		"pem":           keyPem,
+		"der":           keyBlock.Bytes,
+		"base64 of pem": []byte(base64.StdEncoding.EncodeToString(keyPem)),
+		"one line pem":  bytes.ReplaceAll(keyPem, []byte("\n"), []byte(`\n`)),
+	}
+	for form, input := range testBase64Forms(keyBlock.Bytes) {
+		keyInputs[form] = input
+	}
+
+	for form, input := range keyInputs {
+		got, err := KeyInputToPem(input, InputFormatAuto)
+		if err != nil {
+			t.Errorf("key %s: KeyInputToPem failed (%s)", form, err)
+			continue
+		}
+		if !bytes.Equal(got, keyPem) {
+			t.Errorf("key %s: KeyInputToPem returned different key", form)
+		}
+	}
+
+	// cert
+	certInputs := map[string][]byte{
+		"pem": certPem,
+		"der": certBlock.Bytes,
+	}
+	for form, input := range testBase64Forms(certBlock.Bytes) {
+		certInputs[form] = input
+	}
+
+	for form, input := range certInputs {
+		got, err := CertInputToPem(input, InputFormatAuto)
+		if err != nil {
+			t.Errorf("cert %s: CertInputToPem failed (%s)", form, err)
+			continue
+		}
+		if !bytes.Equal(got, certPem) {
+			t.Errorf("cert %s: CertInputToPem returned different cert", form)
+		}
+	}
+}
+
+// edge cases: der chains, explicit formats that do not match the input,
+// certs given as keys, and garbage
+func TestInputToPemErrors(t *testing.T) {
+	_, keyPem, certPem := testKeyCert(t)
+	keyBlock, _ := pem.Decode(keyPem)
+	certBlock, _ := pem.Decode(certPem)
+
+	chain, err := CertInputToPem(append(append([]byte{}, certBlock.Bytes...), certBlock.Bytes...), InputFormatDER)
+	if err != nil || !bytes.Equal(chain, append(append([]byte{}, certPem...), certPem...)) {
+		t.Errorf("cert der chain: CertInputToPem did not return both certs (%v)", err)
+	}
+
+	tests := []struct {
+		name    string
+		input   []byte
+		format  InputFormat
+		cert    bool
+		wantErr error
+	}{
+		{name: "pem key as der", input: keyPem, format: InputFormatDER, wantErr: errInputDerKey},
+		{name: "der key as base64", input: keyBlock.Bytes, format: InputFormatBase64, wantErr: errInputNotBase64},
+		{name: "cert der as key", input: certBlock.Bytes, format: InputFormatAuto, wantErr: errInputDerKey},
+		{name: "key der as cert", input: keyBlock.Bytes, format: InputFormatAuto, cert: true, wantErr: errInputDerCert},
+		{name: "garbage key", input: []byte(strings.Repeat("not a key! ", 10)), format: InputFormatAuto, wantErr: errInputFormatUnknown},
+		{name: "empty cert", input: []byte{}, format: InputFormatAuto, cert: true, wantErr: errInputFormatUnknown},
+	}
+
+	for _, test := range tests {
+		if test.cert {
+			_, err = CertInputToPem(test.input, test.format)
+		} else {
+			_, err = KeyInputToPem(test.input, test.format)
+		}
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: expected error %v but got: %v", test.name, test.wantErr, err)
+		}
+	}
+}
+
+// each der private key encoding must get the matching pem block type
+func TestDerKeyPemType(t *testing.T) {
+	keys := testKeys(t)
+	rsaKey := keys["rsa"].(*rsa.PrivateKey)
+	ecKey := keys["ecdsa"].(*ecdsa.PrivateKey)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		der      []byte
+		wantType string
+	}{
+		"pkcs8":           {der: pkcs8, wantType: "PRIVATE KEY"},
+		"pkcs1":           {der: x509.MarshalPKCS1PrivateKey(rsaKey), wantType: "RSA PRIVATE KEY"},
+		"sec1":            {der: sec1, wantType: "EC PRIVATE KEY"},
+		"encrypted pkcs8": {der: testEncryptPKCS8(t, pkcs8, []byte("secret")), wantType: "ENCRYPTED PRIVATE KEY"},
+	}
+
+	for name, test := range tests {
+		gotType, err := derKeyPemType(test.der)
+		if err != nil || gotType != test.wantType {
+			t.Errorf("%s: expected %s but got %s (%v)", name, test.wantType, gotType, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package pkcs15
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"time"
+)
+
+// GenerateKey generates a new private key of the specified type and returns
+// a pkcs15 struct that contains only the key (Cert is nil). The key can be
+// written out using ToPemKey and ToP15Key.
+func GenerateKey(keyType KeyType) (*pkcs15KeyCert, error) {
+	var key crypto.PrivateKey
+	var err error
+
+	switch keyType {
+	case KeyTypeRSA1024:
+		key, err = rsa.GenerateKey(rand.Reader, 1024)
+	case KeyTypeRSA2048:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case KeyTypeRSA3072:
+		key, err = rsa.GenerateKey(rand.Reader, 3072)
+	case KeyTypeRSA4096:
+		key, err = rsa.GenerateKey(rand.Reader, 4096)
+
+	case KeyTypeECP256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeECP384:
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyTypeECP521:
+		key, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+
+	default:
+		return nil, errKeyWrongType
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pkcs15: failed to generate %s key (%w)", keyType, err)
+	}
+
+	// create p15 struct
+	p15 := &pkcs15KeyCert{
+		key:        key,
+		keyCreated: time.Now(),
+	}
+
+	// pre-calculate encrypted envelope
+	err = p15.computeEncryptedKeyEnvelope()
+	if err != nil {
+		return nil, err
+	}
+
+	return p15, nil
+}
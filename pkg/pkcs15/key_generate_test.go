@@ -0,0 +1,40 @@
+package pkcs15
+
+import (
+	"testing"
+)
+
+// generated keys should be the requested type and should round trip through
+// the p15 key file (which doesn't need a cert)
+func TestGenerateKey(t *testing.T) {
+	for _, keyType := range []KeyType{KeyTypeRSA2048, KeyTypeECP256, KeyTypeECP384, KeyTypeECP521} {
+		p15, err := GenerateKey(keyType)
+		if err != nil {
+			t.Fatalf("%s: failed to generate key (%s)", keyType, err)
+		}
+
+		if p15.KeyType() != keyType {
+			t.Errorf("%s: generated key is %s", keyType, p15.KeyType())
+		}
+
+		keyFile, err := p15.ToP15Key()
+		if err != nil {
+			t.Fatalf("%s: failed to make key file (%s)", keyType, err)
+		}
+
+		err = p15.VerifyP15KeyFile(keyFile)
+		if err != nil {
+			t.Errorf("%s: key file verification failed (%s)", keyType, err)
+		}
+
+		_, err = p15.ToP15KeyCert()
+		if err == nil {
+			t.Errorf("%s: expected error making key+cert file without a cert", keyType)
+		}
+	}
+
+	_, err := GenerateKey(KeyTypeUnknown)
+	if err == nil {
+		t.Errorf("expected error generating unknown key type")
+	}
+}
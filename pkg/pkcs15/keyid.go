@@ -2,20 +2,57 @@ package pkcs15
 
 import (
 	"apc-p15-tool/pkg/tools/asn1obj"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/x509"
 	"encoding/binary"
 	"math/big"
+	"time"
 )
 
+// subjectPublicKeyInfo returns the SubjectPublicKeyInfo SEQUENCE of the key;
+// it is taken from the cert if there is one, otherwise it is marshalled from
+// the key
+func (p15 *pkcs15KeyCert) subjectPublicKeyInfo() []byte {
+	if p15.Cert != nil {
+		return p15.Cert.RawSubjectPublicKeyInfo
+	}
+
+	signer, ok := p15.key.(crypto.Signer)
+	if !ok {
+		panic("subject public key info for key is unexpected and unsupported")
+	}
+
+	spki, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		panic(err)
+	}
+
+	return spki
+}
+
+// keyCreatedTime returns the time the key was created (for key id 9)
+func (p15 *pkcs15KeyCert) keyCreatedTime() time.Time {
+	// NOTE: use cert validity start as proxy for key creation since key pem
+	// doesn't actually contain a created at time -- in reality notBefore tends
+	// to be ~ 1 hour ish BEFORE the cert was even created. Key would also
+	// obviously have to be created prior to the cert creation.
+	if p15.Cert != nil {
+		return p15.Cert.NotBefore
+	}
+
+	return p15.keyCreated
+}
+
 // keyId returns the keyId for the overall key object
 func (p15 *pkcs15KeyCert) keyId() []byte {
 	// object to hash is just the RawSubjectPublicKeyInfo
 
 	// SHA-1 Hash
 	hasher := sha1.New()
-	_, err := hasher.Write(p15.Cert.RawSubjectPublicKeyInfo)
+	_, err := hasher.Write(p15.subjectPublicKeyInfo())
 	if err != nil {
 		panic(err)
 	}
@@ -163,13 +200,9 @@ func (p15 *pkcs15KeyCert) keyIdInt9() []byte {
 	publicKeyPacket = append(publicKeyPacket, byte(4))
 
 	// A four-octet number denoting the time that the key was created.
-	// NOTE: use cert validity start as proxy for key creation since key pem
-	// doesn't actually contain a created at time -- in reality notBefore tends
-	// to be ~ 1 hour ish BEFORE the cert was even created. Key would also
-	// obviously have to be created prior to the cert creation.
-	time := make([]byte, 4)
-	binary.BigEndian.PutUint32(time, uint32(p15.Cert.NotBefore.Unix()))
-	publicKeyPacket = append(publicKeyPacket, time...)
+	created := make([]byte, 4)
+	binary.BigEndian.PutUint32(created, uint32(p15.keyCreatedTime().Unix()))
+	publicKeyPacket = append(publicKeyPacket, created...)
 
 	// the next part is key type specific
 	switch privKey := p15.key.(type) {
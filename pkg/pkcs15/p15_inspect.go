@@ -0,0 +1,361 @@
+package pkcs15
+
+import (
+	"apc-p15-tool/pkg/tools/asn1obj"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// P15ObjectType is the type of a PKCS#15 object (this is the tag number used
+// for the object type in PKCS15Objects)
+type P15ObjectType int
+
+const (
+	P15ObjectTypePrivateKey  P15ObjectType = 0
+	P15ObjectTypePublicKey   P15ObjectType = 1
+	P15ObjectTypeCertificate P15ObjectType = 4
+)
+
+// String returns the object type in a log friendly string format.
+func (objType P15ObjectType) String() string {
+	switch objType {
+	case P15ObjectTypePrivateKey:
+		return "private key"
+	case P15ObjectTypePublicKey:
+		return "public key"
+	case P15ObjectTypeCertificate:
+		return "certificate"
+
+	default:
+	}
+
+	return "unknown object type"
+}
+
+// P15KeyID is one of the additional key identifiers of a p15 object (a
+// PKCS#15 CredentialIdentifier)
+type P15KeyID struct {
+	IDType int
+	Value  []byte
+}
+
+// String returns the key id's type in a log friendly string format.
+func (keyId P15KeyID) String() string {
+	switch keyId.IDType {
+	case 1:
+		return "issuerAndSerialNumber"
+	case 2:
+		return "subjectKeyId"
+	case 3:
+		return "issuerAndSerialNumberHash"
+	case 4:
+		return "subjectKeyHash"
+	case 5:
+		return "issuerKeyHash"
+	case 6:
+		return "issuerNameHash"
+	case 7:
+		return "subjectNameHash"
+	case 8:
+		return "pgp2KeyId"
+	case 9:
+		return "openPGPKeyId"
+
+	default:
+	}
+
+	return "unknown key id type"
+}
+
+// P15EnvelopeInfo describes the algorithms and parameters of a private key's
+// encrypted envelope
+type P15EnvelopeInfo struct {
+	KDFPRF        asn1.ObjectIdentifier
+	KDFSalt       []byte
+	KDFIterations int
+	KDFKeyLength  int
+
+	KEKAlgorithm asn1.ObjectIdentifier
+
+	ContentAlgorithm           asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm asn1.ObjectIdentifier
+	MACAlgorithm               asn1.ObjectIdentifier
+
+	EncryptedKeyLength     int
+	EncryptedContentLength int
+}
+
+// P15Object describes one object (key or cert) in a p15 file; fields that
+// are not present in the object are left as their zero value
+type P15Object struct {
+	Type  P15ObjectType
+	Label string
+
+	ID          []byte
+	KeyIDs      []P15KeyID
+	Usage       *asn1.BitString
+	AccessFlags *asn1.BitString
+	StartDate   time.Time
+	EndDate     time.Time
+
+	// private key
+	Envelope *P15EnvelopeInfo
+
+	// public key
+	PublicKey crypto.PublicKey
+
+	// certificate
+	Cert *x509.Certificate
+}
+
+// P15Info describes the content of a p15 file
+type P15Info struct {
+	Version int
+	Objects []P15Object
+
+	// DecryptErr is the result of trying to decrypt the private key and
+	// match it to the file's public key or cert (nil if all was okay)
+	DecryptErr error
+}
+
+// p15KeyUsageFlags and p15AccessFlags are the names of the bits in the
+// PKCS#15 KeyUsageFlags and KeyAccessFlags BIT STRINGs
+var (
+	p15KeyUsageFlags = []string{"encrypt", "decrypt", "sign", "signRecover", "wrap", "unwrap", "verify", "verifyRecover", "derive", "nonRepudiation"}
+	p15AccessFlags   = []string{"sensitive", "extractable", "alwaysSensitive", "neverExtractable", "local"}
+)
+
+// bitStringNames returns the names of the bits that are set in bits
+func bitStringNames(bits *asn1.BitString, names []string) []string {
+	set := []string{}
+	if bits == nil {
+		return set
+	}
+
+	for i := 0; i < bits.BitLength; i++ {
+		if bits.At(i) == 0 {
+			continue
+		}
+
+		if i < len(names) {
+			set = append(set, names[i])
+		} else {
+			set = append(set, fmt.Sprintf("bit%d", i))
+		}
+	}
+
+	return set
+}
+
+// UsageNames returns the names of the key usage flags that are set
+func (obj *P15Object) UsageNames() []string {
+	return bitStringNames(obj.Usage, p15KeyUsageFlags)
+}
+
+// AccessFlagNames returns the names of the access flags that are set
+func (obj *P15Object) AccessFlagNames() []string {
+	return bitStringNames(obj.AccessFlags, p15AccessFlags)
+}
+
+// parseP15KeyIDs parses a SEQUENCE OF CredentialIdentifier
+func parseP15KeyIDs(idSeqs *asn1obj.Node) ([]P15KeyID, error) {
+	keyIds := []P15KeyID{}
+	for _, idSeq := range idSeqs.Children {
+		if len(idSeq.Children) != 2 {
+			return nil, errP15BadStructure
+		}
+
+		keyId := P15KeyID{}
+		var err error
+		keyId.IDType, err = idSeq.Children[0].AsInt()
+		if err != nil {
+			return nil, errP15BadStructure
+		}
+		keyId.Value = idSeq.Children[1].Value
+
+		keyIds = append(keyIds, keyId)
+	}
+
+	return keyIds, nil
+}
+
+// inspectP15Object parses the attributes of a p15 object
+func inspectP15Object(objType P15ObjectType, obj *asn1obj.Node) (*P15Object, error) {
+	info := &P15Object{
+		Type: objType,
+	}
+
+	if len(obj.Children) < 2 {
+		return nil, errP15BadStructure
+	}
+
+	// commonObjectAttributes
+	label, found := obj.Children[0].Child(asn1.ClassUniversal, asn1.TagUTF8String)
+	if found {
+		var err error
+		info.Label, err = label.AsUTF8String()
+		if err != nil {
+			return nil, errP15BadStructure
+		}
+	}
+
+	// classAttributes (CommonKeyAttributes or CommonCertificateAttributes)
+	bitStrings := []*asn1.BitString{}
+	for _, attr := range obj.Children[1].Children {
+		switch {
+		case attr.Is(asn1.ClassUniversal, asn1.TagOctetString) && info.ID == nil:
+			info.ID = attr.Value
+
+		case attr.Is(asn1.ClassUniversal, asn1.TagBitString):
+			bits, err := attr.AsBitString()
+			if err != nil {
+				return nil, errP15BadStructure
+			}
+			bitStrings = append(bitStrings, &bits)
+
+		case attr.Is(asn1.ClassUniversal, asn1.TagGeneralizedTime):
+			var err error
+			info.StartDate, err = attr.AsGeneralizedTime()
+			if err != nil {
+				return nil, fmt.Errorf("pkcs15: p15 inspect: failed to parse start date (%w)", err)
+			}
+
+		// key endDate [0] / cert endDate [4]
+		case attr.Class == asn1.ClassContextSpecific && !attr.Constructed && (attr.Tag == 0 || attr.Tag == 4):
+			var err error
+			info.EndDate, err = attr.AsGeneralizedTime()
+			if err != nil {
+				return nil, fmt.Errorf("pkcs15: p15 inspect: failed to parse end date (%w)", err)
+			}
+
+		// cert identifiers [2]
+		case attr.Is(asn1.ClassContextSpecific, 2) && attr.Constructed:
+			var err error
+			info.KeyIDs, err = parseP15KeyIDs(attr)
+			if err != nil {
+				return nil, err
+			}
+
+		default:
+		}
+	}
+
+	// key usage and access flags (key objects only)
+	if len(bitStrings) > 0 {
+		info.Usage = bitStrings[0]
+	}
+	if len(bitStrings) > 1 {
+		info.AccessFlags = bitStrings[1]
+	}
+
+	// subClassAttributes [0] (key file key objects contain key ids here)
+	for _, subClassAttributes := range obj.Children[2:] {
+		if !subClassAttributes.Is(asn1.ClassContextSpecific, 0) {
+			continue
+		}
+
+		commonPrivKeyAttributes, err := p15Child(subClassAttributes, asn1.ClassUniversal, asn1.TagSequence)
+		if err != nil {
+			return nil, err
+		}
+
+		keyIds, found := commonPrivKeyAttributes.Child(asn1.ClassContextSpecific, 0)
+		if found && keyIds.Constructed {
+			info.KeyIDs, err = parseP15KeyIDs(keyIds)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		break
+	}
+
+	// typeAttributes
+	var err error
+	switch objType {
+	case P15ObjectTypePrivateKey:
+		envelope, err := p15PrivateKeyEnvelope(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		env, err := parseAuthEnvelopedData(envelope.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		info.Envelope = &P15EnvelopeInfo{
+			KDFPRF:                     env.kdfPRF,
+			KDFSalt:                    env.kdfSalt,
+			KDFIterations:              env.kdfIterations,
+			KDFKeyLength:               env.kdfKeyLength,
+			KEKAlgorithm:               env.kekAlg,
+			ContentAlgorithm:           env.contentAlg,
+			ContentEncryptionAlgorithm: env.contentEncAlg,
+			MACAlgorithm:               env.macAlg,
+			EncryptedKeyLength:         len(env.encryptedCEK),
+			EncryptedContentLength:     len(env.encryptedContent),
+		}
+
+	case P15ObjectTypePublicKey:
+		info.PublicKey, err = parseP15PublicKeyObject(obj)
+		if err != nil {
+			return nil, err
+		}
+
+	case P15ObjectTypeCertificate:
+		info.Cert, err = parseP15CertObject(obj)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+	}
+
+	return info, nil
+}
+
+// InspectP15 parses the provided p15 file (without the APC header) and
+// returns a description of its content. Unlike ParseP15ToPKCS15, a failure to
+// decrypt the private key is not an error; it is instead reported in the
+// returned info's DecryptErr.
+func InspectP15(p15File []byte) (*P15Info, error) {
+	version, objects, err := parseP15Content(p15File)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &P15Info{
+		Version: version,
+		Objects: []P15Object{},
+	}
+
+	for _, objType := range []P15ObjectType{P15ObjectTypePrivateKey, P15ObjectTypePublicKey, P15ObjectTypeCertificate} {
+		objs, err := p15ObjectsOfType(objects, int(objType))
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range objs {
+			obj, err := inspectP15Object(objType, objs[i])
+			if err != nil {
+				return nil, fmt.Errorf("pkcs15: p15 inspect: failed to parse %s object (%w)", objType, err)
+			}
+
+			info.Objects = append(info.Objects, *obj)
+		}
+	}
+
+	if len(info.Objects) == 0 {
+		return nil, errors.New("pkcs15: p15 inspect: file does not contain any supported objects")
+	}
+
+	// try to decrypt
+	_, info.DecryptErr = ParseP15ToPKCS15(p15File)
+
+	return info, nil
+}
@@ -0,0 +1,120 @@
+package pkcs15
+
+import (
+	"errors"
+	"testing"
+)
+
+// testInspectObjects returns the private key, public key, and cert objects of
+// info (nil if not present)
+func testInspectObjects(info *P15Info) (privKeyObj, pubKeyObj, certObj *P15Object) {
+	for i := range info.Objects {
+		switch info.Objects[i].Type {
+		case P15ObjectTypePrivateKey:
+			privKeyObj = &info.Objects[i]
+		case P15ObjectTypePublicKey:
+			pubKeyObj = &info.Objects[i]
+		case P15ObjectTypeCertificate:
+			certObj = &info.Objects[i]
+		}
+	}
+
+	return privKeyObj, pubKeyObj, certObj
+}
+
+// inspecting a key+cert file should describe its key and cert objects and
+// report that the key decrypts
+func TestInspectP15(t *testing.T) {
+	_, keyPem, certPem := testKeyCert(t)
+
+	p15, err := ParsePEMToPKCS15(keyPem, certPem)
+	if err != nil {
+		t.Fatalf("failed to parse pem (%s)", err)
+	}
+
+	keyCertFile, err := p15.ToP15KeyCert()
+	if err != nil {
+		t.Fatalf("failed to make key+cert file (%s)", err)
+	}
+
+	info, err := InspectP15(keyCertFile)
+	if err != nil {
+		t.Fatalf("failed to inspect p15 (%s)", err)
+	}
+
+	if info.DecryptErr != nil {
+		t.Errorf("unexpected decrypt error (%s)", info.DecryptErr)
+	}
+
+	privKeyObj, _, certObj := testInspectObjects(info)
+
+	if privKeyObj == nil || privKeyObj.Envelope == nil {
+		t.Fatal("private key object or envelope missing")
+	}
+	if privKeyObj.Envelope.KDFIterations != apcKEKIterations {
+		t.Errorf("unexpected kdf iterations %d", privKeyObj.Envelope.KDFIterations)
+	}
+	if len(privKeyObj.UsageNames()) == 0 || len(privKeyObj.AccessFlagNames()) == 0 {
+		t.Error("private key usage or access flags missing")
+	}
+
+	if certObj == nil || certObj.Cert == nil || !certObj.Cert.Equal(p15.Cert) {
+		t.Fatal("certificate object missing or does not match")
+	}
+	if len(certObj.KeyIDs) == 0 {
+		t.Error("certificate key ids missing")
+	}
+	if !certObj.EndDate.Equal(p15.Cert.NotAfter) {
+		t.Errorf("certificate end date %s does not match %s", certObj.EndDate, p15.Cert.NotAfter)
+	}
+}
+
+// a key file has no cert object, and a damaged envelope is reported in
+// DecryptErr without failing the inspection
+func TestInspectP15KeyOnlyAndBadEnvelope(t *testing.T) {
+	_, keyPem, certPem := testKeyCert(t)
+
+	p15, err := ParsePEMToPKCS15(keyPem, certPem)
+	if err != nil {
+		t.Fatalf("failed to parse pem (%s)", err)
+	}
+
+	// key only
+	keyFile, err := p15.ToP15Key()
+	if err != nil {
+		t.Fatalf("failed to make key file (%s)", err)
+	}
+
+	info, err := InspectP15(keyFile)
+	if err != nil {
+		t.Fatalf("failed to inspect key file (%s)", err)
+	}
+	privKeyObj, _, certObj := testInspectObjects(info)
+	if privKeyObj == nil || certObj != nil {
+		t.Errorf("key file should have a private key object and no certificate object")
+	}
+	if info.DecryptErr != nil {
+		t.Errorf("key file: unexpected decrypt error (%s)", info.DecryptErr)
+	}
+
+	// modified mac (the last byte of the envelope)
+	p15.envelopedPrivateKey[len(p15.envelopedPrivateKey)-1] ^= 0x01
+	badFile, err := p15.ToP15KeyCert()
+	if err != nil {
+		t.Fatalf("failed to make key+cert file (%s)", err)
+	}
+
+	info, err = InspectP15(badFile)
+	if err != nil {
+		t.Fatalf("bad envelope should still inspect but got: %s", err)
+	}
+	if !errors.Is(info.DecryptErr, errEnvelopeBadMAC) {
+		t.Errorf("expected mac error in DecryptErr but got: %v", info.DecryptErr)
+	}
+
+	// not a p15 file
+	_, err = InspectP15(keyPem)
+	if err == nil {
+		t.Error("inspect of pem expected error but got none")
+	}
+}
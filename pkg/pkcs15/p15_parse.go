@@ -0,0 +1,315 @@
+package pkcs15
+
+import (
+	"apc-p15-tool/pkg/tools/asn1obj"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+var (
+	errP15BadStructure    = errors.New("pkcs15: p15 parse: unexpected file structure")
+	errP15WrongContent    = errors.New("pkcs15: p15 parse: content type is not pkcs15content")
+	errP15NoPrivateKey    = errors.New("pkcs15: p15 parse: no private key object found")
+	errP15NoPublicKey     = errors.New("pkcs15: p15 parse: no public key or certificate found (cannot reconstruct private key)")
+	errP15KeyCertMismatch = errors.New("pkcs15: p15 parse: private key does not match certificate")
+)
+
+// p15Child returns the first child of node with the specified class and tag,
+// or errP15BadStructure if there is no such child
+func p15Child(node *asn1obj.Node, class int, tag int) (*asn1obj.Node, error) {
+	child, found := node.Child(class, tag)
+	if !found {
+		return nil, errP15BadStructure
+	}
+
+	return child, nil
+}
+
+// ParseP15ToPKCS15 parses the provided p15 file (without the APC header) to a
+// pkcs15 struct. Both the key (e.g., apctool.key.p15) and key+cert (e.g.,
+// apctool.p15) formats are supported. The private key is decrypted from the
+// file's encrypted envelope. If the file does not contain a certificate, Cert
+// will be nil.
+func ParseP15ToPKCS15(p15File []byte) (*pkcs15KeyCert, error) {
+	_, objects, err := parseP15Content(p15File)
+	if err != nil {
+		return nil, err
+	}
+
+	// [0] private keys (required)
+	privKeys, err := p15ObjectsOfType(objects, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(privKeys) <= 0 {
+		return nil, errP15NoPrivateKey
+	}
+
+	// [4] certificates (optional)
+	var cert *x509.Certificate
+	certObjs, err := p15ObjectsOfType(objects, 4)
+	if err != nil {
+		return nil, err
+	}
+	if len(certObjs) > 0 {
+		cert, err = parseP15CertObject(certObjs[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// public key is needed to reconstruct the private key; prefer the cert
+	// but fallback to the [1] public key object (key file does not include
+	// the cert)
+	var publicKey crypto.PublicKey
+	if cert != nil {
+		publicKey = cert.PublicKey
+	} else {
+		pubKeys, err := p15ObjectsOfType(objects, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(pubKeys) <= 0 {
+			return nil, errP15NoPublicKey
+		}
+
+		publicKey, err = parseP15PublicKeyObject(pubKeys[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// decrypt private key
+	envelope, err := p15PrivateKeyEnvelope(privKeys[0])
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := DecryptKeyEnvelope(envelope.Value, apcKEKPassword, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// if there is a cert, make sure the key actually belongs to it
+	if cert != nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errKeyWrongType
+		}
+
+		pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !pub.Equal(cert.PublicKey) {
+			return nil, errP15KeyCertMismatch
+		}
+	}
+
+	p15 := &pkcs15KeyCert{
+		Cert:                cert,
+		key:                 key,
+		envelopedPrivateKey: envelope.Value,
+	}
+
+	// verify the key type is one this tool supports
+	if p15.KeyType() == KeyTypeUnknown {
+		return nil, errKeyWrongType
+	}
+
+	return p15, nil
+}
+
+// parseP15Content parses the ContentInfo of a p15 file and returns the
+// pkcs15 version and the PKCS15Objects
+func parseP15Content(p15File []byte) (version int, objects *asn1obj.Node, err error) {
+	// ContentInfo
+	contentInfo, err := asn1obj.Decode(p15File)
+	if err != nil {
+		return 0, nil, fmt.Errorf("pkcs15: p15 parse: failed to parse content info (%w)", err)
+	}
+
+	if !contentInfo.Is(asn1.ClassUniversal, asn1.TagSequence) || len(contentInfo.Children) != 2 {
+		return 0, nil, errP15BadStructure
+	}
+
+	// contentType: pkcs15content
+	contentType, err := contentInfo.Children[0].AsOID()
+	if err != nil {
+		return 0, nil, errP15BadStructure
+	}
+	if !contentType.Equal(asn1obj.OIDPkscs15Content) {
+		return 0, nil, errP15WrongContent
+	}
+
+	// content -> [0] -> SEQUENCE { version, SEQUENCE { objects } }
+	content := contentInfo.Children[1]
+	if !content.Is(asn1.ClassContextSpecific, 0) || !content.Constructed {
+		return 0, nil, errP15BadStructure
+	}
+
+	tokenInfo, err := p15Child(content, asn1.ClassUniversal, asn1.TagSequence)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(tokenInfo.Children) != 2 {
+		return 0, nil, errP15BadStructure
+	}
+
+	version, err = tokenInfo.Children[0].AsInt()
+	if err != nil {
+		return 0, nil, errP15BadStructure
+	}
+
+	objects = tokenInfo.Children[1]
+	if !objects.Is(asn1.ClassUniversal, asn1.TagSequence) {
+		return 0, nil, errP15BadStructure
+	}
+
+	return version, objects, nil
+}
+
+// p15ObjectsOfType returns the objects from the PKCS15Objects choice with the
+// specified tag (e.g., [0] privateKeys, [1] publicKeys, [4] certificates). If
+// the type is not present in the file, an empty slice is returned.
+func p15ObjectsOfType(objects *asn1obj.Node, tag int) ([]*asn1obj.Node, error) {
+	pathOrObjects, found := objects.Child(asn1.ClassContextSpecific, tag)
+	if !found {
+		return []*asn1obj.Node{}, nil
+	}
+
+	// PathOrObjects - only [0] objects is supported (not a path)
+	objs, err := p15Child(pathOrObjects, asn1.ClassContextSpecific, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return objs.Children, nil
+}
+
+// p15TypeAttributes returns the typeAttributes ([1]) SEQUENCE of a p15 object
+func p15TypeAttributes(obj *asn1obj.Node) (*asn1obj.Node, error) {
+	typeAttributes, err := p15Child(obj, asn1.ClassContextSpecific, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return p15Child(typeAttributes, asn1.ClassUniversal, asn1.TagSequence)
+}
+
+// p15PrivateKeyEnvelope returns the AuthEnvelopedData content of a private
+// key object
+func p15PrivateKeyEnvelope(privKeyObj *asn1obj.Node) (*asn1obj.Node, error) {
+	typeAttributes, err := p15TypeAttributes(privKeyObj)
+	if err != nil {
+		return nil, err
+	}
+
+	// AuthEnvelopedData Type ([4])
+	envelope, found := typeAttributes.Child(asn1.ClassContextSpecific, 4)
+	if !found || !envelope.Constructed {
+		return nil, errors.New("pkcs15: p15 parse: private key is not in an authenticated envelope")
+	}
+
+	return envelope, nil
+}
+
+// parseP15CertObject returns the x509 certificate contained in a p15 cert
+// object
+func parseP15CertObject(certObj *asn1obj.Node) (*x509.Certificate, error) {
+	typeAttributes, err := p15TypeAttributes(certObj)
+	if err != nil {
+		return nil, err
+	}
+
+	// direct value [0]
+	certValue, err := p15Child(typeAttributes, asn1.ClassContextSpecific, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(certValue.Value)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs15: p15 parse: failed to parse certificate (%w)", err)
+	}
+
+	return cert, nil
+}
+
+// parseP15PublicKeyObject returns the public key contained in a p15 public
+// key object
+func parseP15PublicKeyObject(pubKeyObj *asn1obj.Node) (crypto.PublicKey, error) {
+	typeAttributes, err := p15TypeAttributes(pubKeyObj)
+	if err != nil {
+		return nil, err
+	}
+
+	// direct value [0]
+	pubKeyValue, err := p15Child(typeAttributes, asn1.ClassContextSpecific, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pubKeyValue.Children) != 1 {
+		return nil, errP15BadStructure
+	}
+
+	// RSA key uses an implicit [1] SubjectPublicKeyInfo, EC key uses a
+	// regular SubjectPublicKeyInfo SEQUENCE
+	var spki []byte
+	spkiNode := pubKeyValue.Children[0]
+	switch {
+	case spkiNode.Is(asn1.ClassUniversal, asn1.TagSequence):
+		spki = spkiNode.Raw
+
+	case spkiNode.Is(asn1.ClassContextSpecific, 1):
+		spki = asn1obj.Sequence([][]byte{spkiNode.Value})
+
+	default:
+		return nil, errP15BadStructure
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(spki)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs15: p15 parse: failed to parse public key (%w)", err)
+	}
+
+	return publicKey, nil
+}
+
+// VerifyP15KeyFile parses keyFile (a p15 key file, e.g., one made by ToP15Key)
+// and returns an error if it does not decrypt to p15's private key.
+func (p15 *pkcs15KeyCert) VerifyP15KeyFile(keyFile []byte) error {
+	return p15.verifyP15File(keyFile, false)
+}
+
+// VerifyP15KeyCertFile parses keyCertFile (a p15 key+cert file without the APC
+// header, e.g., one made by ToP15KeyCert) and returns an error if it does not
+// decrypt to p15's private key or if its certificate does not match p15's.
+func (p15 *pkcs15KeyCert) VerifyP15KeyCertFile(keyCertFile []byte) error {
+	return p15.verifyP15File(keyCertFile, true)
+}
+
+// verifyP15File parses p15File and verifies the key (and, if certRequired, the
+// cert) contained in it match p15
+func (p15 *pkcs15KeyCert) verifyP15File(p15File []byte, certRequired bool) error {
+	parsed, err := ParseP15ToPKCS15(p15File)
+	if err != nil {
+		return err
+	}
+
+	if !privateKeysEqual(p15.key, parsed.key) {
+		return errors.New("pkcs15: p15 verify: private key in file does not match")
+	}
+
+	if certRequired {
+		if parsed.Cert == nil {
+			return errors.New("pkcs15: p15 verify: certificate missing from file")
+		}
+
+		if p15.Cert == nil || !p15.Cert.Equal(parsed.Cert) {
+			return errors.New("pkcs15: p15 verify: certificate in file does not match")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package pkcs15
+
+import (
+	"crypto"
+	"testing"
+)
+
+// p15 files created by this tool should parse back to the same key and cert
+func TestParseP15ToPKCS15(t *testing.T) {
+	for name, key := range testKeys(t) {
+		keyPem, certPem := testKeyCertPem(t, key)
+
+		p15, err := ParsePEMToPKCS15(keyPem, certPem)
+		if err != nil {
+			t.Fatalf("%s: failed to parse pem (%s)", name, err)
+		}
+
+		keyFile, err := p15.ToP15Key()
+		if err != nil {
+			t.Fatalf("%s: failed to make key file (%s)", name, err)
+		}
+
+		keyCertFile, err := p15.ToP15KeyCert()
+		if err != nil {
+			t.Fatalf("%s: failed to make key+cert file (%s)", name, err)
+		}
+
+		for fileName, file := range map[string][]byte{"key": keyFile, "key+cert": keyCertFile} {
+			parsed, err := ParseP15ToPKCS15(file)
+			if err != nil {
+				t.Errorf("%s: %s: failed to parse p15 (%s)", name, fileName, err)
+				continue
+			}
+
+			parsedKey, ok := parsed.key.(interface{ Equal(crypto.PrivateKey) bool })
+			if !ok || !parsedKey.Equal(key) {
+				t.Errorf("%s: %s: parsed key does not match", name, fileName)
+			}
+
+			if fileName == "key+cert" && (parsed.Cert == nil || !parsed.Cert.Equal(p15.Cert)) {
+				t.Errorf("%s: %s: parsed cert does not match", name, fileName)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package pkcs15
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+)
+
+var errCertMissing = errors.New("pkcs15: certificate is not present")
+
+// KeyPemFormat is the format used when converting the private key to pem
+type KeyPemFormat int
+
+const (
+	KeyPemFormatPKCS8 KeyPemFormat = iota
+	KeyPemFormatPKCS1
+	KeyPemFormatSEC1
+)
+
+// String returns the key pem format in a log friendly string format.
+func (format KeyPemFormat) String() string {
+	switch format {
+	case KeyPemFormatPKCS8:
+		return "PKCS8"
+	case KeyPemFormatPKCS1:
+		return "PKCS1"
+	case KeyPemFormatSEC1:
+		return "SEC1"
+
+	default:
+	}
+
+	return "unknown key pem format"
+}
+
+// ToPemKey returns the private key in pem format. PKCS1 is only valid for RSA
+// keys and SEC1 is only valid for ECDSA keys.
+func (p15 *pkcs15KeyCert) ToPemKey(format KeyPemFormat) ([]byte, error) {
+	var block *pem.Block
+
+	switch format {
+	case KeyPemFormatPKCS8:
+		der, err := x509.MarshalPKCS8PrivateKey(p15.key)
+		if err != nil {
+			return nil, err
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+
+	case KeyPemFormatPKCS1:
+		rsaKey, ok := p15.key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("pkcs15: pkcs1 pem format requires an rsa key")
+		}
+		block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}
+
+	case KeyPemFormatSEC1:
+		ecKey, ok := p15.key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("pkcs15: sec1 pem format requires an ecdsa key")
+		}
+		der, err := x509.MarshalECPrivateKey(ecKey)
+		if err != nil {
+			return nil, err
+		}
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+
+	default:
+		return nil, errors.New("pkcs15: unsupported key pem format")
+	}
+
+	return pem.EncodeToMemory(block), nil
+}
+
+// ToPemCert returns the certificate in pem format
+func (p15 *pkcs15KeyCert) ToPemCert() ([]byte, error) {
+	if p15.Cert == nil {
+		return nil, errCertMissing
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p15.Cert.Raw}), nil
+}
+
+// ToPemCertChain returns the certificate followed by its chain (if any) in
+// pem format
+func (p15 *pkcs15KeyCert) ToPemCertChain() ([]byte, error) {
+	if p15.Cert == nil {
+		return nil, errCertMissing
+	}
+
+	certChainPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p15.Cert.Raw})
+	for _, cert := range p15.Chain {
+		certChainPem = append(certChainPem, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+
+	return certChainPem, nil
+}
@@ -1,10 +1,10 @@
 package pkcs15
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
-	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
@@ -21,6 +21,7 @@ var (
 
 	errPemCertBadBlock      = errors.New("pkcs15: pem cert: failed to decode pem block")
 	errPemCertFailedToParse = errors.New("pkcs15: pem cert: failed to parse cert")
+	errPemCertNoKeyMatch    = errors.New("pkcs15: pem cert: no certificate in the pem matches the key")
 )
 
 var (
@@ -38,6 +39,11 @@ func pemKeyDecode(keyPem []byte) (crypto.PrivateKey, error) {
 		return nil, errPemKeyBadBlock
 	}
 
+	// encrypted keys must be decrypted first (see DecryptPemKey)
+	if isEncryptedPemKeyBlock(pemBlock) {
+		return nil, errPemKeyEncrypted
+	}
+
 	// parsing depends on block type
 	var privateKey crypto.PrivateKey
 
@@ -124,27 +130,70 @@ func pemKeyDecode(keyPem []byte) (crypto.PrivateKey, error) {
 	return privateKey, nil
 }
 
-// pemCertDecode attempts to decode a pem encoded byte slice and then attempts
-// to parse a certificate from it. The certificate is also check against the
-// key that is passed in to verify the key matches the certificate.
-func pemCertDecode(certPem, keyPem []byte) (*x509.Certificate, error) {
-	// verify key and cert make a valid key pair
-	_, err := tls.X509KeyPair(certPem, keyPem)
-	if err != nil {
-		return nil, err
+// pemCertDecode attempts to decode a pem encoded byte slice that contains one
+// or more certificates (e.g., a fullchain file) and returns the certificate
+// that matches the key (the leaf), regardless of its position in the pem. The
+// issuer chain of the leaf, as found in the pem, is also returned in order
+// (issuer first); certificates that are not part of the leaf's chain are
+// ignored.
+func pemCertDecode(certPem []byte, key crypto.PrivateKey) (*x509.Certificate, []*x509.Certificate, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, errKeyWrongType
 	}
+	publicKey, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return nil, nil, errKeyWrongType
+	}
+
+	// parse all certs
+	certs := []*x509.Certificate{}
+	for rest := certPem; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		// skip anything that isn't a cert (e.g., a key in a combined file)
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
 
-	// discard rest, apc tool only bundles end cert
-	block, _ := pem.Decode(certPem)
-	if block == nil || block.Type != "CERTIFICATE" {
-		return nil, errPemCertBadBlock
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, errPemCertFailedToParse
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, nil, errPemCertBadBlock
 	}
 
-	// Get the cert struct
-	cert, err := x509.ParseCertificate(block.Bytes)
-	if err != nil {
-		return nil, errPemCertFailedToParse
+	// find the leaf (cert that matches the key)
+	leafIndex := slices.IndexFunc(certs, func(cert *x509.Certificate) bool {
+		return publicKey.Equal(cert.PublicKey)
+	})
+	if leafIndex < 0 {
+		return nil, nil, errPemCertNoKeyMatch
+	}
+	leaf := certs[leafIndex]
+	others := slices.Delete(certs, leafIndex, leafIndex+1)
+
+	// follow the issuers of the leaf
+	chain := []*x509.Certificate{}
+	for current := leaf; !bytes.Equal(current.RawIssuer, current.RawSubject); {
+		issuerIndex := slices.IndexFunc(others, func(cert *x509.Certificate) bool {
+			return bytes.Equal(cert.RawSubject, current.RawIssuer) && current.CheckSignatureFrom(cert) == nil
+		})
+		if issuerIndex < 0 {
+			break
+		}
+
+		current = others[issuerIndex]
+		chain = append(chain, current)
+		others = slices.Delete(others, issuerIndex, issuerIndex+1)
 	}
 
-	return cert, nil
+	return leaf, chain, nil
 }
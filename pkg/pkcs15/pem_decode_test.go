@@ -0,0 +1,116 @@
+package pkcs15
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testIssueCert creates a cert for key signed by parent (self-signed if nil)
+func testIssueCert(t *testing.T, cn string, isCA bool, key crypto.Signer, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent = template
+		parentKey = key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+// the leaf must be found by key and its chain must be ordered, regardless of
+// the order of the pem
+func TestPemCertDecodeChain(t *testing.T) {
+	newKey := func() crypto.Signer {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	rootKey, intKey, leafKey, otherKey := newKey(), newKey(), newKey(), newKey()
+	root := testIssueCert(t, "Root", true, rootKey, nil, nil)
+	intermediate := testIssueCert(t, "Intermediate", true, intKey, root, rootKey)
+	leaf := testIssueCert(t, "ups.example.com", false, leafKey, intermediate, intKey)
+	other := testIssueCert(t, "Other", true, otherKey, nil, nil)
+
+	certPem := []byte{}
+	for _, cert := range []*x509.Certificate{root, other, intermediate, leaf} {
+		certPem = append(certPem, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+
+	gotLeaf, gotChain, err := pemCertDecode(certPem, leafKey)
+	if err != nil {
+		t.Fatalf("pemCertDecode failed (%s)", err)
+	}
+
+	if !gotLeaf.Equal(leaf) {
+		t.Errorf("pemCertDecode returned '%s' as leaf", gotLeaf.Subject.CommonName)
+	}
+	if len(gotChain) != 2 || !gotChain[0].Equal(intermediate) || !gotChain[1].Equal(root) {
+		t.Errorf("pemCertDecode returned unexpected chain (%d certs)", len(gotChain))
+	}
+
+	// leaf first and only leaf + chain in pem chain output
+	keyDer, err := x509.MarshalPKCS8PrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+
+	p15, err := ParsePEMToPKCS15(keyPem, certPem)
+	if err != nil {
+		t.Fatalf("ParsePEMToPKCS15 failed (%s)", err)
+	}
+
+	chainPem, err := p15.ToPemCertChain()
+	if err != nil {
+		t.Fatalf("ToPemCertChain failed (%s)", err)
+	}
+
+	expectedPem := []byte{}
+	for _, cert := range []*x509.Certificate{leaf, intermediate, root} {
+		expectedPem = append(expectedPem, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	if !bytes.Equal(chainPem, expectedPem) {
+		t.Errorf("ToPemCertChain returned unexpected pem")
+	}
+
+	// no matching cert
+	_, _, err = pemCertDecode(certPem, otherKey)
+	if err != nil {
+		t.Errorf("pemCertDecode with other's key failed (%s)", err)
+	}
+	_, _, err = pemCertDecode(certPem, newKey())
+	if !errors.Is(err, errPemCertNoKeyMatch) {
+		t.Errorf("pemCertDecode with unrelated key expected no match error but got: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package pkcs15
+
+import (
+	"apc-p15-tool/pkg/tools/asn1obj"
+	"crypto/cipher"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	errPemKeyEncrypted        = errors.New("pkcs15: pem key: key is encrypted (a key password is required)")
+	errPemKeyBadPassword      = errors.New("pkcs15: pem key: failed to decrypt key (wrong password?)")
+	errPemKeyEncBadStructure  = errors.New("pkcs15: pem key: unexpected encrypted key structure")
+	errPemKeyEncNotPBES2      = errors.New("pkcs15: pem key: unsupported key encryption (only PBES2 is supported)")
+	errPemKeyEncUnsupportedKD = errors.New("pkcs15: pem key: unsupported key derivation function (only PBKDF2 is supported)")
+)
+
+// isEncryptedPemKeyBlock returns true if the block is an encrypted PKCS8 key or
+// a legacy (OpenSSL Proc-Type) encrypted key
+func isEncryptedPemKeyBlock(block *pem.Block) bool {
+	//lint:ignore SA1019 legacy encrypted keys are intentionally supported as input
+	return block.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(block)
+}
+
+// decryptPKCS8 decrypts a PKCS#8 EncryptedPrivateKeyInfo that uses PBES2
+// (PBKDF2 with a CBC cipher) and returns the DER of the PrivateKeyInfo
+func decryptPKCS8(encryptedKeyInfo []byte, password []byte) ([]byte, error) {
+	root, err := asn1obj.Decode(encryptedKeyInfo)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs15: pem key: failed to decode encrypted key (%w)", err)
+	}
+	if !root.Is(asn1.ClassUniversal, asn1.TagSequence) || len(root.Children) != 2 {
+		return nil, errPemKeyEncBadStructure
+	}
+
+	// encryptionAlgorithm (PBES2)
+	encAlg := root.Children[0]
+	if len(encAlg.Children) != 2 {
+		return nil, errPemKeyEncBadStructure
+	}
+	encAlgOID, err := encAlg.Children[0].AsOID()
+	if err != nil {
+		return nil, errPemKeyEncBadStructure
+	}
+	if !encAlgOID.Equal(asn1obj.OIDpkcs5PBES2) {
+		return nil, errPemKeyEncNotPBES2
+	}
+
+	// PBES2-params
+	pbes2Params := encAlg.Children[1]
+	if len(pbes2Params.Children) != 2 {
+		return nil, errPemKeyEncBadStructure
+	}
+
+	// keyDerivationFunc (PBKDF2)
+	kdfAlg := pbes2Params.Children[0]
+	if len(kdfAlg.Children) != 2 {
+		return nil, errPemKeyEncBadStructure
+	}
+	kdfAlgOID, err := kdfAlg.Children[0].AsOID()
+	if err != nil {
+		return nil, errPemKeyEncBadStructure
+	}
+	if !kdfAlgOID.Equal(asn1obj.OIDpkcs5PBKDF2) {
+		return nil, errPemKeyEncUnsupportedKD
+	}
+
+	salt, iterations, keyLength, prf, err := parsePBKDF2Params(kdfAlg.Children[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// encryptionScheme (CBC)
+	encScheme, iv, err := parseCBCAlgorithm(pbes2Params.Children[1])
+	if err != nil {
+		return nil, err
+	}
+
+	// encryptedData
+	if !root.Children[1].Is(asn1.ClassUniversal, asn1.TagOctetString) {
+		return nil, errPemKeyEncBadStructure
+	}
+	encryptedData := root.Children[1].Value
+
+	// derive key
+	encKeySize, err := cbcKeyLength(encScheme)
+	if err != nil {
+		return nil, err
+	}
+	if keyLength != 0 && keyLength != encKeySize {
+		return nil, errPemKeyEncBadStructure
+	}
+
+	prfHash, err := hmacHashFunc(prf)
+	if err != nil {
+		return nil, err
+	}
+
+	encKey := pbkdf2.Key(password, salt, iterations, encKeySize, prfHash)
+
+	// decrypt
+	blockCipher, err := newCBCBlockCipher(encScheme, encKey)
+	if err != nil {
+		return nil, err
+	}
+
+	blockSize := blockCipher.BlockSize()
+	if len(iv) != blockSize || len(encryptedData) == 0 || len(encryptedData)%blockSize != 0 {
+		return nil, errPemKeyEncBadStructure
+	}
+
+	keyInfo := make([]byte, len(encryptedData))
+	cipher.NewCBCDecrypter(blockCipher, iv).CryptBlocks(keyInfo, encryptedData)
+
+	// remove padding (a wrong password almost always results in bad padding)
+	padLen := int(keyInfo[len(keyInfo)-1])
+	if padLen == 0 || padLen > blockSize {
+		return nil, errPemKeyBadPassword
+	}
+	for _, b := range keyInfo[len(keyInfo)-padLen:] {
+		if int(b) != padLen {
+			return nil, errPemKeyBadPassword
+		}
+	}
+	keyInfo = keyInfo[:len(keyInfo)-padLen]
+
+	// confirm the result is a PrivateKeyInfo (padding can be valid by chance)
+	_, err = x509.ParsePKCS8PrivateKey(keyInfo)
+	if err != nil {
+		return nil, errPemKeyBadPassword
+	}
+
+	return keyInfo, nil
+}
+
+// DecryptPemKey decrypts an encrypted pem private key and returns the key in
+// unencrypted pem format. Both PKCS#8 encrypted keys (ENCRYPTED PRIVATE KEY,
+// PBES2 with PBKDF2 and an AES or 3DES CBC cipher) and legacy OpenSSL encrypted
+// keys (Proc-Type: 4,ENCRYPTED) are supported. If keyPem is not encrypted, it
+// is returned unchanged. The decrypted key is only kept in memory.
+func DecryptPemKey(keyPem []byte, password []byte) ([]byte, error) {
+	block, _ := pem.Decode(keyPem)
+	if block == nil {
+		return nil, errPemKeyBadBlock
+	}
+
+	if !isEncryptedPemKeyBlock(block) {
+		return keyPem, nil
+	}
+
+	// PKCS8
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		keyInfo, err := decryptPKCS8(block.Bytes, password)
+		if err != nil {
+			return nil, err
+		}
+
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyInfo}), nil
+	}
+
+	// legacy
+	//lint:ignore SA1019 legacy encrypted keys are intentionally supported as input
+	keyDer, err := x509.DecryptPEMBlock(block, password)
+	if err != nil {
+		return nil, errPemKeyBadPassword
+	}
+
+	// confirm the result parses (padding can be valid by chance)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		_, err = x509.ParsePKCS1PrivateKey(keyDer)
+	case "EC PRIVATE KEY":
+		_, err = x509.ParseECPrivateKey(keyDer)
+	default:
+		_, err = x509.ParsePKCS8PrivateKey(keyDer)
+	}
+	if err != nil {
+		return nil, errPemKeyBadPassword
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: keyDer}), nil
+}
@@ -0,0 +1,132 @@
+package pkcs15
+
+import (
+	"apc-p15-tool/pkg/tools/asn1obj"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// testEncryptPKCS8 encrypts a PrivateKeyInfo the same way `openssl pkcs8
+// -topk8 -v2 aes-256-cbc -v2prf hmacWithSHA256` does
+func testEncryptPKCS8(t *testing.T, keyInfo, password []byte) []byte {
+	t.Helper()
+
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	_, _ = rand.Read(salt)
+	_, _ = rand.Read(iv)
+	iterations := 2048
+
+	key := pbkdf2.Key(password, salt, iterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	padLen := aes.BlockSize - len(keyInfo)%aes.BlockSize
+	padded := append(append([]byte{}, keyInfo...), bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, padded)
+
+	null := []byte{asn1.TagNull, 0x00}
+
+	return asn1obj.Sequence([][]byte{
+		asn1obj.Sequence([][]byte{
+			asn1obj.ObjectIdentifier(asn1obj.OIDpkcs5PBES2),
+			asn1obj.Sequence([][]byte{
+				asn1obj.Sequence([][]byte{
+					asn1obj.ObjectIdentifier(asn1obj.OIDpkcs5PBKDF2),
+					asn1obj.Sequence([][]byte{
+						asn1obj.OctetString(salt),
+						asn1obj.Integer(big.NewInt(int64(iterations))),
+						asn1obj.Sequence([][]byte{asn1obj.ObjectIdentifier(asn1obj.OIDhmacWithSHA256), null}),
+					}),
+				}),
+				asn1obj.Sequence([][]byte{
+					asn1obj.ObjectIdentifier(asn1obj.OIDaes256CBC),
+					asn1obj.OctetString(iv),
+				}),
+			}),
+		}),
+		asn1obj.OctetString(encrypted),
+	})
+}
+
+// encrypted keys should decrypt to the original key and then parse
+func TestDecryptPemKey(t *testing.T) {
+	password := []byte("escrow secret")
+
+	for name, key := range testKeys(t) {
+		keyPem, certPem := testKeyCertPem(t, key)
+		keyBlock, _ := pem.Decode(keyPem)
+
+		// unencrypted key must decode as is and be passed through unchanged
+		_, err := pemKeyDecode(keyPem)
+		if err != nil {
+			t.Fatalf("%s: unencrypted key failed to decode (%s)", name, err)
+		}
+		got, err := DecryptPemKey(keyPem, password)
+		if err != nil || !bytes.Equal(got, keyPem) {
+			t.Errorf("%s: DecryptPemKey of unencrypted key did not return key unchanged (%v)", name, err)
+		}
+
+		// pkcs8
+		encPem := pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: testEncryptPKCS8(t, keyBlock.Bytes, password)})
+
+		// legacy
+		var legacyDer []byte
+		var legacyType string
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			legacyType = "RSA PRIVATE KEY"
+			legacyDer = x509.MarshalPKCS1PrivateKey(key)
+		case *ecdsa.PrivateKey:
+			legacyType = "EC PRIVATE KEY"
+			legacyDer, err = x509.MarshalECPrivateKey(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		//lint:ignore SA1019 legacy encryption is needed to test legacy decryption
+		legacyBlock, err := x509.EncryptPEMBlock(rand.Reader, legacyType, legacyDer, password, x509.PEMCipherAES256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		legacyPem := pem.EncodeToMemory(legacyBlock)
+
+		for format, encryptedPem := range map[string][]byte{"pkcs8": encPem, "legacy": legacyPem} {
+			_, err = pemKeyDecode(encryptedPem)
+			if !errors.Is(err, errPemKeyEncrypted) {
+				t.Errorf("%s %s: decode of encrypted key expected encrypted error but got: %v", name, format, err)
+			}
+
+			decryptedPem, err := DecryptPemKey(encryptedPem, password)
+			if err != nil {
+				t.Fatalf("%s %s: DecryptPemKey failed (%s)", name, format, err)
+			}
+
+			_, err = ParsePEMToPKCS15(decryptedPem, certPem)
+			if err != nil {
+				t.Errorf("%s %s: decrypted key failed to parse (%s)", name, format, err)
+			}
+
+			_, err = DecryptPemKey(encryptedPem, []byte("wrong"))
+			if !errors.Is(err, errPemKeyBadPassword) {
+				t.Errorf("%s %s: DecryptPemKey with wrong password expected bad password error but got: %v", name, format, err)
+			}
+		}
+	}
+}
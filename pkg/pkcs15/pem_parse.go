@@ -5,15 +5,23 @@ import (
 	"crypto/ecdsa"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/pem"
+	"time"
 )
 
 // pkcs15KeyCert holds the data for a key and certificate pair; it provides
 // various methods to transform pkcs15 data
 type pkcs15KeyCert struct {
 	Cert *x509.Certificate
-	key  crypto.PrivateKey
+	// Chain is the issuer chain of Cert (issuer first), if it was included
+	// with the cert (e.g., a fullchain pem); it is not part of the p15
+	Chain []*x509.Certificate
+	key   crypto.PrivateKey
 	// store the encrypted enveloped Private Key for re-use
 	envelopedPrivateKey []byte
+	// time the key was created; only used if there is no Cert (otherwise
+	// Cert.NotBefore is used as a proxy)
+	keyCreated time.Time
 }
 
 // KeyType is used by consumers to check for compatibility
@@ -59,8 +67,18 @@ func (keyType KeyType) String() string {
 
 // KeyType returns the private key type
 func (p15 *pkcs15KeyCert) KeyType() KeyType {
-	switch pKey := p15.key.(type) {
-	case *rsa.PrivateKey:
+	signer, ok := p15.key.(crypto.Signer)
+	if !ok {
+		return KeyTypeUnknown
+	}
+
+	return PublicKeyType(signer.Public())
+}
+
+// PublicKeyType returns the type of the specified public key
+func PublicKeyType(publicKey crypto.PublicKey) KeyType {
+	switch pKey := publicKey.(type) {
+	case *rsa.PublicKey:
 		switch pKey.N.BitLen() {
 		case 1024:
 			return KeyTypeRSA1024
@@ -74,7 +92,7 @@ func (p15 *pkcs15KeyCert) KeyType() KeyType {
 		default:
 		}
 
-	case *ecdsa.PrivateKey:
+	case *ecdsa.PublicKey:
 		switch pKey.Curve.Params().Name {
 		case "P-256":
 			return KeyTypeECP256
@@ -92,6 +110,16 @@ func (p15 *pkcs15KeyCert) KeyType() KeyType {
 	return KeyTypeUnknown
 }
 
+// PublicKey returns the public key of p15's private key
+func (p15 *pkcs15KeyCert) PublicKey() crypto.PublicKey {
+	signer, ok := p15.key.(crypto.Signer)
+	if !ok {
+		return nil
+	}
+
+	return signer.Public()
+}
+
 // ParsePEMToPKCS15 parses the provide pem files to a pkcs15 struct; it also does some
 // basic sanity check; if any of this fails, an error is returned
 func ParsePEMToPKCS15(keyPem, certPem []byte) (*pkcs15KeyCert, error) {
@@ -101,16 +129,17 @@ func ParsePEMToPKCS15(keyPem, certPem []byte) (*pkcs15KeyCert, error) {
 		return nil, err
 	}
 
-	// decode / check cert
-	cert, err := pemCertDecode(certPem, keyPem)
+	// decode / check cert (and find its chain)
+	cert, chain, err := pemCertDecode(certPem, key)
 	if err != nil {
 		return nil, err
 	}
 
 	// create p15 struct
 	p15 := &pkcs15KeyCert{
-		key:  key,
-		Cert: cert,
+		key:   key,
+		Cert:  cert,
+		Chain: chain,
 	}
 
 	// pre-calculate encrypted envelope
@@ -121,3 +150,26 @@ func ParsePEMToPKCS15(keyPem, certPem []byte) (*pkcs15KeyCert, error) {
 
 	return p15, nil
 }
+
+// ParseKeyToPKCS15 parses a private key without a certificate. keyFile can be
+// either a pem key or a p15 key file (e.g., apctool.key.p15 from this tool or
+// APC's wizard, without the APC header). If a p15 file that also contains a
+// certificate is provided, the certificate is kept.
+func ParseKeyToPKCS15(keyFile []byte) (*pkcs15KeyCert, error) {
+	// not pem, try p15
+	pemBlock, _ := pem.Decode(keyFile)
+	if pemBlock == nil {
+		return ParseP15ToPKCS15(keyFile)
+	}
+
+	key, err := pemKeyDecode(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	p15 := &pkcs15KeyCert{
+		key: key,
+	}
+
+	return p15, nil
+}
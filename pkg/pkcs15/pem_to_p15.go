@@ -16,6 +16,11 @@ const (
 // toP15KeyCert creates a P15 file with both the private key and certificate, mirroring the
 // final p15 file an APC UPS expects (though without the header)
 func (p15 *pkcs15KeyCert) ToP15KeyCert() (keyCert []byte, err error) {
+	// cert is required
+	if p15.Cert == nil {
+		return nil, errCertMissing
+	}
+
 	// encrypted envelope is required
 	err = p15.computeEncryptedKeyEnvelope()
 	if err != nil {
@@ -161,7 +166,7 @@ func (p15 *pkcs15KeyCert) ToP15KeyCert() (keyCert []byte, err error) {
 
 // toP15Key creates a P15 file with just the private key, mirroring the p15 format
 // the APC tool uses when generating a new private key (Note: no header is used on
-// this file)
+// this file). The cert is not required for this file.
 func (p15 *pkcs15KeyCert) ToP15Key() (key []byte, err error) {
 	// encrypted envelope is required
 	err = p15.computeEncryptedKeyEnvelope()
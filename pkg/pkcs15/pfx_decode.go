@@ -0,0 +1,61 @@
+package pkcs15
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var errPfxNoMatchingCert = errors.New("pkcs15: pfx: no certificate in the pfx matches the private key")
+
+// PFXToPem decodes a PKCS#12 (pfx) file and returns its private key (in PKCS8
+// pem format) and certificates (in pem format). The first certificate is the
+// one whose public key matches the private key, regardless of its position in
+// the pfx; the pfx's other (ca) certificates follow it so the chain can be
+// verified and optionally installed. The returned pem can be passed to
+// ParsePEMToPKCS15.
+func PFXToPem(pfxData []byte, password string) (keyPem, certPem []byte, err error) {
+	key, firstCert, otherCerts, err := pkcs12.DecodeChain(pfxData, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pkcs15: pfx: failed to decode (%w)", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, errKeyWrongType
+	}
+
+	publicKey, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return nil, nil, errKeyWrongType
+	}
+
+	// find the cert that goes with the key
+	certs := append([]*x509.Certificate{firstCert}, otherCerts...)
+	leafIndex := slices.IndexFunc(certs, func(cert *x509.Certificate) bool {
+		return publicKey.Equal(cert.PublicKey)
+	})
+	if leafIndex < 0 {
+		return nil, nil, errPfxNoMatchingCert
+	}
+	leaf := certs[leafIndex]
+	others := slices.Delete(certs, leafIndex, leafIndex+1)
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pkcs15: pfx: failed to marshal key (%w)", err)
+	}
+
+	keyPem = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer})
+	certPem = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+	for _, cert := range others {
+		certPem = append(certPem, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+
+	return keyPem, certPem, nil
+}
@@ -0,0 +1,137 @@
+package pkcs15
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// testParseCertPem parses the first cert in certPem
+func testParseCertPem(t *testing.T, certPem []byte) *x509.Certificate {
+	t.Helper()
+
+	block, _ := pem.Decode(certPem)
+	if block == nil {
+		t.Fatal("cert pem block missing")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+// the leaf cert must be picked by matching the key, not by its position
+func TestPFXToPem(t *testing.T) {
+	// an unrelated cert to put in front of the leaf
+	_, _, otherCertPem := testKeyCert(t)
+	otherCert := testParseCertPem(t, otherCertPem)
+
+	key, _, certPem := testKeyCert(t)
+	cert := testParseCertPem(t, certPem)
+
+	for name, encoder := range map[string]*pkcs12.Encoder{"modern": pkcs12.Modern, "legacy": pkcs12.LegacyRC2} {
+		pfx, err := encoder.Encode(key, otherCert, []*x509.Certificate{cert}, "secret")
+		if err != nil {
+			t.Fatalf("%s: failed to encode pfx (%s)", name, err)
+		}
+
+		gotKeyPem, gotCertPem, err := PFXToPem(pfx, "secret")
+		if err != nil {
+			t.Fatalf("%s: PFXToPem failed (%s)", name, err)
+		}
+
+		// leaf first, then the others
+		if !bytes.Equal(gotCertPem, append(append([]byte{}, certPem...), otherCertPem...)) {
+			t.Errorf("%s: PFXToPem did not return the cert matching the key first", name)
+		}
+
+		_, err = ParsePEMToPKCS15(gotKeyPem, gotCertPem)
+		if err != nil {
+			t.Errorf("%s: pfx pem failed to parse (%s)", name, err)
+		}
+
+		// wrong password
+		_, _, err = PFXToPem(pfx, "wrong")
+		if err == nil {
+			t.Errorf("%s: PFXToPem with wrong password expected error but got none", name)
+		}
+	}
+
+	// no matching cert
+	pfx, err := pkcs12.Modern.Encode(key, otherCert, nil, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = PFXToPem(pfx, "secret")
+	if err != errPfxNoMatchingCert {
+		t.Errorf("PFXToPem without matching cert expected no matching cert error but got: %v", err)
+	}
+}
+
+// the ca certs of a pfx must be kept as the leaf's chain
+func TestPFXToPemChain(t *testing.T) {
+	caP15, err := GenerateKey(KeyTypeECP256)
+	if err != nil {
+		t.Fatalf("failed to generate ca key (%s)", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Lab CA"},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(48 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caCertPem, err := caP15.SignCertificate(caTemplate, nil, caP15.PublicKey())
+	if err != nil {
+		t.Fatalf("failed to make ca cert (%s)", err)
+	}
+	caCert := testParseCertPem(t, caCertPem)
+
+	key, keyPem, _ := testKeyCert(t)
+	p15, err := ParseKeyToPKCS15(keyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "ups.example.com"},
+		NotBefore:    time.Now().Add(-1 * time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	leafPem, err := caP15.SignCertificate(leafTemplate, caCert, p15.PublicKey())
+	if err != nil {
+		t.Fatalf("failed to make leaf cert (%s)", err)
+	}
+	leaf := testParseCertPem(t, leafPem)
+
+	pfx, err := pkcs12.Modern.Encode(key, leaf, []*x509.Certificate{caCert}, "secret")
+	if err != nil {
+		t.Fatalf("failed to encode pfx (%s)", err)
+	}
+
+	gotKeyPem, gotCertPem, err := PFXToPem(pfx, "secret")
+	if err != nil {
+		t.Fatalf("PFXToPem failed (%s)", err)
+	}
+
+	parsed, err := ParsePEMToPKCS15(gotKeyPem, gotCertPem)
+	if err != nil {
+		t.Fatalf("pfx pem failed to parse (%s)", err)
+	}
+	if !parsed.Cert.Equal(leaf) {
+		t.Error("parsed cert is not the leaf")
+	}
+	if len(parsed.Chain) != 1 || !parsed.Chain[0].Equal(caCert) {
+		t.Errorf("expected the ca cert as the chain but got %d cert(s)", len(parsed.Chain))
+	}
+}
@@ -2,8 +2,18 @@ package pkcs15
 
 import (
 	"apc-p15-tool/pkg/tools/asn1obj"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	errPrivKeyObjBad         = errors.New("pkcs15: private key: failed to parse private key object")
+	errPrivKeyPubKeyMismatch = errors.New("pkcs15: private key: private key does not match public key")
 )
 
 // privateKeyObject returns the ASN.1 representation of a private key
@@ -39,3 +49,138 @@ func (p15 *pkcs15KeyCert) privateKeyObject() []byte {
 
 	return privKeyObj
 }
+
+// parsePrivateKeyObject is the inverse of privateKeyObject. It parses the ASN.1
+// representation of a private key and uses the matching public key to rebuild
+// the complete private key.
+func parsePrivateKeyObject(privKeyObj []byte, publicKey crypto.PublicKey) (crypto.PrivateKey, error) {
+	switch pubKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		seq, err := asn1obj.Decode(privKeyObj)
+		if err != nil || !seq.Is(asn1.ClassUniversal, asn1.TagSequence) {
+			return nil, errPrivKeyObjBad
+		}
+
+		// values are IMPLICIT tagged integers [0] modulus, [1] publicExponent,
+		// [2] privateExponent, [3] P, [4] Q, [5] Dp, [6] Dq, [7] Qinv; this tool
+		// only writes 3 - 7 but other tools may include all of them
+		vals := map[int]*big.Int{}
+		for _, elem := range seq.Children {
+			if elem.Class != asn1.ClassContextSpecific {
+				return nil, errPrivKeyObjBad
+			}
+			vals[elem.Tag], err = elem.AsInteger()
+			if err != nil || vals[elem.Tag].Sign() <= 0 {
+				return nil, errPrivKeyObjBad
+			}
+		}
+
+		p, pOk := vals[3]
+		q, qOk := vals[4]
+		if !pOk || !qOk {
+			return nil, errPrivKeyObjBad
+		}
+
+		// modulus & exponents
+		n := new(big.Int).Mul(p, q)
+		if n.Cmp(pubKey.N) != 0 {
+			return nil, errPrivKeyPubKeyMismatch
+		}
+
+		d, dOk := vals[2]
+		if !dOk {
+			// d = e^-1 mod lcm(p-1, q-1)
+			one := big.NewInt(1)
+			pMinus1 := new(big.Int).Sub(p, one)
+			qMinus1 := new(big.Int).Sub(q, one)
+			gcd := new(big.Int).GCD(nil, nil, pMinus1, qMinus1)
+			lambda := new(big.Int).Div(new(big.Int).Mul(pMinus1, qMinus1), gcd)
+
+			d = new(big.Int).ModInverse(big.NewInt(int64(pubKey.E)), lambda)
+			if d == nil {
+				return nil, errPrivKeyObjBad
+			}
+		}
+
+		rsaKey := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{
+				N: n,
+				E: pubKey.E,
+			},
+			D:      d,
+			Primes: []*big.Int{p, q},
+		}
+
+		err = rsaKey.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("pkcs15: private key: failed sanity check (%s)", err)
+		}
+		rsaKey.Precompute()
+
+		return rsaKey, nil
+
+	case *ecdsa.PublicKey:
+		// Only private piece is the integer D
+		dNode, err := asn1obj.Decode(privKeyObj)
+		if err != nil || !dNode.Is(asn1.ClassUniversal, asn1.TagInteger) {
+			return nil, errPrivKeyObjBad
+		}
+
+		d, err := dNode.AsInteger()
+		if err != nil || d.Sign() <= 0 || d.BitLen() > pubKey.Curve.Params().BitSize {
+			return nil, errPrivKeyObjBad
+		}
+
+		ecKey, err := ecdsa.ParseRawPrivateKey(pubKey.Curve, d.FillBytes(make([]byte, (pubKey.Curve.Params().BitSize+7)/8)))
+		if err != nil {
+			return nil, fmt.Errorf("pkcs15: private key: failed to parse ecdsa key (%w)", err)
+		}
+
+		if !ecKey.PublicKey.Equal(pubKey) {
+			return nil, errPrivKeyPubKeyMismatch
+		}
+
+		return ecKey, nil
+
+	default:
+	}
+
+	return nil, errKeyWrongType
+}
+
+// privateKeysEqual returns true if both private keys are the same key. This is
+// used instead of the keys' Equal funcs since an RSA private exponent can be
+// calculated more than one way and still be valid for the same key.
+func privateKeysEqual(key1, key2 crypto.PrivateKey) bool {
+	switch k1 := key1.(type) {
+	case *rsa.PrivateKey:
+		k2, ok := key2.(*rsa.PrivateKey)
+		if !ok || !k1.PublicKey.Equal(&k2.PublicKey) || len(k1.Primes) != len(k2.Primes) {
+			return false
+		}
+
+		// primes can be in any order
+		for _, p1 := range k1.Primes {
+			found := false
+			for _, p2 := range k2.Primes {
+				if p1.Cmp(p2) == 0 {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+
+		return true
+
+	case *ecdsa.PrivateKey:
+		k2, ok := key2.(*ecdsa.PrivateKey)
+		return ok && k1.Equal(k2)
+
+	default:
+	}
+
+	return false
+}
@@ -0,0 +1,37 @@
+package pkcs15
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// ToPemCSR creates a PKCS#10 certificate signing request from template that
+// is signed by p15's private key and returns it in pem format
+func (p15 *pkcs15KeyCert) ToPemCSR(template *x509.CertificateRequest) ([]byte, error) {
+	csrDer, err := x509.CreateCertificateRequest(rand.Reader, template, p15.key)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs15: failed to create csr (%w)", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDer}), nil
+}
+
+// SignCertificate creates a certificate from template for publicKey that is
+// signed by p15's private key. If parent is nil, the certificate is
+// self-signed (publicKey must then be p15's public key). The certificate is
+// returned in pem format.
+func (p15 *pkcs15KeyCert) SignCertificate(template, parent *x509.Certificate, publicKey crypto.PublicKey) ([]byte, error) {
+	if parent == nil {
+		parent = template
+	}
+
+	certDer, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, p15.key)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs15: failed to create certificate (%w)", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDer}), nil
+}
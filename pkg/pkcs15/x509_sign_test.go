@@ -0,0 +1,189 @@
+package pkcs15
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// csr made from a pem key, a p15 key file, or a p15 key+cert file should be
+// signed by that key
+func TestToPemCSR(t *testing.T) {
+	key, keyPem, certPem := testKeyCert(t)
+
+	pemP15, err := ParseKeyToPKCS15(keyPem)
+	if err != nil {
+		t.Fatalf("failed to parse pem key (%s)", err)
+	}
+
+	keyCertP15, err := ParsePEMToPKCS15(keyPem, certPem)
+	if err != nil {
+		t.Fatalf("failed to parse pem (%s)", err)
+	}
+	keyFile, err := keyCertP15.ToP15Key()
+	if err != nil {
+		t.Fatalf("failed to make key file (%s)", err)
+	}
+	keyCertFile, err := keyCertP15.ToP15KeyCert()
+	if err != nil {
+		t.Fatalf("failed to make key+cert file (%s)", err)
+	}
+
+	sources := map[string]*pkcs15KeyCert{"pem": pemP15}
+	for source, file := range map[string][]byte{"p15 key": keyFile, "p15 key+cert": keyCertFile} {
+		sources[source], err = ParseKeyToPKCS15(file)
+		if err != nil {
+			t.Fatalf("%s: failed to parse p15 file (%s)", source, err)
+		}
+	}
+	if sources["p15 key+cert"].Cert == nil {
+		t.Error("p15 key+cert: cert was not kept")
+	}
+
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "ups.example.com"},
+		DNSNames: []string{"ups.example.com", "ups"},
+	}
+
+	for source, p15 := range sources {
+		csrPem, err := p15.ToPemCSR(template)
+		if err != nil {
+			t.Fatalf("%s: failed to make csr (%s)", source, err)
+		}
+
+		block, _ := pem.Decode(csrPem)
+		if block == nil || block.Type != "CERTIFICATE REQUEST" {
+			t.Fatalf("%s: csr pem block missing", source)
+		}
+
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			t.Fatalf("%s: failed to parse csr (%s)", source, err)
+		}
+
+		err = csr.CheckSignature()
+		if err != nil {
+			t.Errorf("%s: csr signature invalid (%s)", source, err)
+		}
+
+		pub, ok := csr.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !pub.Equal(key.Public()) {
+			t.Errorf("%s: csr public key does not match", source)
+		}
+
+		if len(csr.DNSNames) != 2 || csr.Subject.CommonName != "ups.example.com" {
+			t.Errorf("%s: csr subject or dns names wrong", source)
+		}
+	}
+}
+
+// certificates should be signed by the p15 key, either self-signed or by a ca
+func TestSignCertificate(t *testing.T) {
+	// ca
+	caP15, err := GenerateKey(KeyTypeECP384)
+	if err != nil {
+		t.Fatalf("failed to generate ca key (%s)", err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Lab CA"},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(48 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caCertPem, err := caP15.SignCertificate(caTemplate, nil, caP15.PublicKey())
+	if err != nil {
+		t.Fatalf("failed to make ca cert (%s)", err)
+	}
+	caBlock, _ := pem.Decode(caCertPem)
+	caCert, err := x509.ParseCertificate(caBlock.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse ca cert (%s)", err)
+	}
+
+	_, keyPem, _ := testKeyCert(t)
+	p15, err := ParseKeyToPKCS15(keyPem)
+	if err != nil {
+		t.Fatalf("failed to parse pem key (%s)", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "ups.example.com"},
+		DNSNames:     []string{"ups.example.com"},
+		NotBefore:    time.Now().Add(-1 * time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+
+	// self-signed
+	certPem, err := p15.SignCertificate(template, nil, p15.PublicKey())
+	if err != nil {
+		t.Fatalf("failed to self-sign (%s)", err)
+	}
+	_, err = ParsePEMToPKCS15(keyPem, certPem)
+	if err != nil {
+		t.Errorf("self-signed cert does not work with key (%s)", err)
+	}
+
+	// ca signed
+	certPem, err = caP15.SignCertificate(template, caCert, p15.PublicKey())
+	if err != nil {
+		t.Fatalf("failed to ca sign (%s)", err)
+	}
+	block, _ := pem.Decode(certPem)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse ca signed cert (%s)", err)
+	}
+	err = cert.CheckSignatureFrom(caCert)
+	if err != nil {
+		t.Errorf("ca signed cert signature invalid (%s)", err)
+	}
+	if cert.Issuer.CommonName != caCert.Subject.CommonName {
+		t.Errorf("ca signed cert issuer is %s", cert.Issuer.CommonName)
+	}
+	_, err = ParsePEMToPKCS15(keyPem, certPem)
+	if err != nil {
+		t.Errorf("ca signed cert does not work with key (%s)", err)
+	}
+
+	// unsupported public key
+	_, err = caP15.SignCertificate(template, caCert, "not a public key")
+	if err == nil {
+		t.Error("sign of unsupported public key expected error but got none")
+	}
+}
+
+// public keys of unsupported types and sizes are unknown
+func TestPublicKeyType(t *testing.T) {
+	keys := testKeys(t)
+
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		publicKey crypto.PublicKey
+		want      KeyType
+	}{
+		"rsa 2048": {publicKey: keys["rsa"].Public(), want: KeyTypeRSA2048},
+		"ec p-256": {publicKey: keys["ecdsa"].Public(), want: KeyTypeECP256},
+		"ed25519":  {publicKey: edPub, want: KeyTypeUnknown},
+		"nil":      {publicKey: nil, want: KeyTypeUnknown},
+	}
+
+	for name, test := range tests {
+		if got := PublicKeyType(test.publicKey); got != test.want {
+			t.Errorf("%s: expected %s but got %s", name, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package asn1obj
+
+import (
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// maxDecodeDepth limits the nesting of constructed values so a malicious input
+// can't exhaust the stack
+const maxDecodeDepth = 64
+
+var (
+	ErrTruncated    = errors.New("asn1obj: data truncated")
+	ErrNonCanonical = errors.New("asn1obj: data is not canonical DER")
+	ErrTrailingData = errors.New("asn1obj: trailing data")
+	ErrTooDeep      = errors.New("asn1obj: data is nested too deeply")
+	ErrWrongType    = errors.New("asn1obj: node is not the requested type")
+)
+
+// Node is one decoded ASN.1 value. Constructed nodes have their decoded
+// content in Children; primitive nodes only have Value.
+type Node struct {
+	Class       int
+	Tag         int
+	Constructed bool
+
+	// Raw is the complete encoding of the node (header and value)
+	Raw []byte
+	// Value is the content of the node (without the header)
+	Value []byte
+
+	Children []*Node
+}
+
+// Decode decodes der, which must contain exactly one DER encoded value, into
+// a tree of Nodes
+func Decode(der []byte) (*Node, error) {
+	node, rest, err := decodeNode(der, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, ErrTrailingData
+	}
+
+	return node, nil
+}
+
+// DecodeAll decodes all of the DER encoded values that are concatenated
+// together in der
+func DecodeAll(der []byte) ([]*Node, error) {
+	return decodeNodes(der, 0)
+}
+
+// decodeNodes decodes all concatenated values in der at the specified depth
+func decodeNodes(der []byte, depth int) ([]*Node, error) {
+	nodes := []*Node{}
+
+	for len(der) > 0 {
+		node, rest, err := decodeNode(der, depth)
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, node)
+		der = rest
+	}
+
+	return nodes, nil
+}
+
+// decodeNode decodes the first value in der and returns it along with the
+// remaining bytes
+func decodeNode(der []byte, depth int) (*Node, []byte, error) {
+	if depth > maxDecodeDepth {
+		return nil, nil, ErrTooDeep
+	}
+
+	node := &Node{}
+	pos := 0
+
+	// identifier
+	if len(der) < 2 {
+		return nil, nil, ErrTruncated
+	}
+	node.Class = int(der[0] >> 6)
+	node.Constructed = der[0]&0x20 != 0
+	node.Tag = int(der[0] & 0x1f)
+	pos++
+
+	// high tag number form
+	if node.Tag == 0x1f {
+		node.Tag = 0
+		for {
+			if pos >= len(der) {
+				return nil, nil, ErrTruncated
+			}
+			b := der[pos]
+			pos++
+
+			// leading 0x80 is a non-minimal encoding
+			if node.Tag == 0 && b == 0x80 {
+				return nil, nil, ErrNonCanonical
+			}
+			// limit to tag numbers that fit in an int31
+			if node.Tag >= 1<<24 {
+				return nil, nil, fmt.Errorf("asn1obj: tag number too large")
+			}
+
+			node.Tag = node.Tag<<7 | int(b&0x7f)
+			if b&0x80 == 0 {
+				break
+			}
+		}
+
+		// tag numbers less than 31 must use the low tag number form
+		if node.Tag < 0x1f {
+			return nil, nil, ErrNonCanonical
+		}
+	}
+
+	// length
+	if pos >= len(der) {
+		return nil, nil, ErrTruncated
+	}
+	length := int(der[pos])
+	pos++
+
+	if length&0x80 != 0 {
+		numBytes := length & 0x7f
+
+		// indefinite length is not allowed in DER
+		if numBytes == 0 {
+			return nil, nil, ErrNonCanonical
+		}
+		if numBytes > 4 {
+			return nil, nil, fmt.Errorf("asn1obj: length too large")
+		}
+		if pos+numBytes > len(der) {
+			return nil, nil, ErrTruncated
+		}
+
+		// no leading zeros allowed
+		if der[pos] == 0 {
+			return nil, nil, ErrNonCanonical
+		}
+
+		length = 0
+		for i := 0; i < numBytes; i++ {
+			length = length<<8 | int(der[pos])
+			pos++
+		}
+
+		// long form must only be used when the short form can't be
+		if length < 0x80 {
+			return nil, nil, ErrNonCanonical
+		}
+	}
+
+	if length > len(der)-pos {
+		return nil, nil, ErrTruncated
+	}
+
+	node.Raw = der[:pos+length]
+	node.Value = der[pos : pos+length]
+
+	err := node.checkUniversal()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// children
+	if node.Constructed {
+		node.Children, err = decodeNodes(node.Value, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return node, der[pos+length:], nil
+}
+
+// checkUniversal enforces the DER rules for universal types that can be
+// checked without fully decoding the value
+func (node *Node) checkUniversal() error {
+	if node.Class != asn1.ClassUniversal {
+		return nil
+	}
+
+	switch node.Tag {
+	// always constructed
+	case asn1.TagSequence, asn1.TagSet:
+		if !node.Constructed {
+			return ErrNonCanonical
+		}
+
+	// always primitive in DER
+	case 1, asn1.TagInteger, asn1.TagBitString, asn1.TagOctetString, 5, asn1.TagOID, asn1.TagEnum,
+		asn1.TagUTF8String, asn1.TagNumericString, asn1.TagPrintableString, asn1.TagT61String,
+		asn1.TagIA5String, asn1.TagUTCTime, asn1.TagGeneralizedTime, asn1.TagGeneralString, asn1.TagBMPString:
+		if node.Constructed {
+			return ErrNonCanonical
+		}
+
+	default:
+	}
+
+	switch node.Tag {
+	// BOOLEAN must be 0x00 or 0xFF
+	case 1:
+		if len(node.Value) != 1 || (node.Value[0] != 0x00 && node.Value[0] != 0xff) {
+			return ErrNonCanonical
+		}
+
+	// NULL must be empty
+	case 5:
+		if len(node.Value) != 0 {
+			return ErrNonCanonical
+		}
+
+	// INTEGER must be minimal
+	case asn1.TagInteger, asn1.TagEnum:
+		if len(node.Value) == 0 {
+			return ErrNonCanonical
+		}
+		if len(node.Value) > 1 &&
+			((node.Value[0] == 0x00 && node.Value[1]&0x80 == 0) ||
+				(node.Value[0] == 0xff && node.Value[1]&0x80 != 0)) {
+			return ErrNonCanonical
+		}
+
+	// BIT STRING padding bits must be 0
+	case asn1.TagBitString:
+		if len(node.Value) == 0 || node.Value[0] > 7 ||
+			(len(node.Value) == 1 && node.Value[0] != 0) {
+			return ErrNonCanonical
+		}
+		if node.Value[len(node.Value)-1]&(1<<node.Value[0]-1) != 0 {
+			return ErrNonCanonical
+		}
+
+	default:
+	}
+
+	return nil
+}
+
+// Is returns true if node has the specified class and tag
+func (node *Node) Is(class int, tag int) bool {
+	return node.Class == class && node.Tag == tag
+}
+
+// Child returns the first child of node with the specified class and tag
+func (node *Node) Child(class int, tag int) (*Node, bool) {
+	for _, child := range node.Children {
+		if child.Is(class, tag) {
+			return child, true
+		}
+	}
+
+	return nil, false
+}
+
+// Encode returns the DER encoding of node. For a node from Decode, this is
+// always the same as Raw; it is mostly useful after a Node is modified.
+func (node *Node) Encode() []byte {
+	val := node.Value
+	if node.Constructed {
+		val = []byte{}
+		for _, child := range node.Children {
+			val = append(val, child.Encode()...)
+		}
+	}
+
+	raw := asn1.RawValue{
+		Class:      node.Class,
+		Tag:        node.Tag,
+		IsCompound: node.Constructed,
+		Bytes:      val,
+	}
+
+	// should never error
+	asn1result, err := asn1.Marshal(raw)
+	if err != nil {
+		panic(err)
+	}
+
+	return asn1result
+}
+
+// unmarshalAs decodes the node's value as the universal type with the
+// specified tag. Primitive nodes in the universal class must have that tag;
+// context specific and application primitive nodes are treated as IMPLICIT
+// tags of the requested type.
+func (node *Node) unmarshalAs(tag int, val any, params string) error {
+	if node.Constructed || (node.Class == asn1.ClassUniversal && node.Tag != tag) {
+		return ErrWrongType
+	}
+
+	raw := asn1.RawValue{
+		Class: asn1.ClassUniversal,
+		Tag:   tag,
+		Bytes: node.Value,
+	}
+
+	der, err := asn1.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	rest, err := asn1.UnmarshalWithParams(der, val, params)
+	if err != nil {
+		return err
+	} else if len(rest) > 0 {
+		return ErrTrailingData
+	}
+
+	return nil
+}
+
+// AsOID returns the node's value as an OBJECT IDENTIFIER
+func (node *Node) AsOID() (asn1.ObjectIdentifier, error) {
+	oid := asn1.ObjectIdentifier{}
+	err := node.unmarshalAs(asn1.TagOID, &oid, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return oid, nil
+}
+
+// AsInteger returns the node's value as an INTEGER
+func (node *Node) AsInteger() (*big.Int, error) {
+	bigInt := new(big.Int)
+	err := node.unmarshalAs(asn1.TagInteger, &bigInt, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return bigInt, nil
+}
+
+// AsInt returns the node's value as an INTEGER that must fit in an int
+func (node *Node) AsInt() (int, error) {
+	i := 0
+	err := node.unmarshalAs(asn1.TagInteger, &i, "")
+	if err != nil {
+		return 0, err
+	}
+
+	return i, nil
+}
+
+// AsBitString returns the node's value as a BIT STRING
+func (node *Node) AsBitString() (asn1.BitString, error) {
+	bs := asn1.BitString{}
+	err := node.unmarshalAs(asn1.TagBitString, &bs, "")
+	if err != nil {
+		return asn1.BitString{}, err
+	}
+
+	return bs, nil
+}
+
+// AsOctetString returns the node's value as an OCTET STRING
+func (node *Node) AsOctetString() ([]byte, error) {
+	if node.Constructed || (node.Class == asn1.ClassUniversal && node.Tag != asn1.TagOctetString) {
+		return nil, ErrWrongType
+	}
+
+	return node.Value, nil
+}
+
+// AsGeneralizedTime returns the node's value as a GeneralizedTime
+func (node *Node) AsGeneralizedTime() (time.Time, error) {
+	t := time.Time{}
+	err := node.unmarshalAs(asn1.TagGeneralizedTime, &t, "generalized")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return t, nil
+}
+
+// AsUTF8String returns the node's value as a UTF8String
+func (node *Node) AsUTF8String() (string, error) {
+	s := ""
+	err := node.unmarshalAs(asn1.TagUTF8String, &s, "utf8")
+	if err != nil {
+		return "", err
+	}
+
+	return s, nil
+}
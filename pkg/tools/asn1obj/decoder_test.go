@@ -0,0 +1,265 @@
+package asn1obj
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// non-canonical (BER) encodings that must be rejected
+var decodeNonCanonicalTests = [][]byte{
+	// indefinite length
+	{0x30, 0x80, 0x00, 0x00},
+	// long form length for a short value
+	{0x04, 0x81, 0x01, 0x00},
+	// length with leading zero
+	{0x04, 0x82, 0x00, 0x81},
+	// high tag number form for a low tag number
+	{0x9f, 0x05, 0x00},
+	// high tag number with leading 0x80
+	{0x9f, 0x80, 0x20, 0x00},
+	// non-minimal INTEGER
+	{0x02, 0x02, 0x00, 0x01},
+	{0x02, 0x02, 0xff, 0x80},
+	// empty INTEGER
+	{0x02, 0x00},
+	// BOOLEAN that isn't 0x00 or 0xff
+	{0x01, 0x01, 0x01},
+	// BIT STRING with non-zero padding
+	{0x03, 0x02, 0x04, 0xb1},
+	// BIT STRING with padding but no data
+	{0x03, 0x01, 0x01},
+	// primitive SEQUENCE
+	{0x10, 0x00},
+	// constructed OCTET STRING
+	{0x24, 0x02, 0x04, 0x00},
+	// NULL with content
+	{0x05, 0x01, 0x00},
+}
+
+// malformed encodings that must be rejected
+var decodeMalformedTests = [][]byte{
+	{},
+	{0x30},
+	{0x30, 0x05, 0x02, 0x01},
+	{0x30, 0x03, 0x02, 0x05, 0x00},
+	// trailing data
+	{0x05, 0x00, 0x05, 0x00},
+}
+
+func TestDecodeRejects(t *testing.T) {
+	for _, der := range decodeNonCanonicalTests {
+		_, err := Decode(der)
+		if !errors.Is(err, ErrNonCanonical) {
+			t.Errorf("Decode '%X' expected non-canonical error but got: %v", der, err)
+		}
+	}
+
+	for _, der := range decodeMalformedTests {
+		_, err := Decode(der)
+		if err == nil {
+			t.Errorf("Decode '%X' expected error but got none", der)
+		}
+	}
+}
+
+func TestDecodeTooDeep(t *testing.T) {
+	der := []byte{0x05, 0x00}
+	for i := 0; i < maxDecodeDepth+2; i++ {
+		der = Sequence([][]byte{der})
+	}
+
+	_, err := Decode(der)
+	if !errors.Is(err, ErrTooDeep) {
+		t.Errorf("Decode of deep nesting expected too deep error but got: %v", err)
+	}
+}
+
+func TestDecodeTree(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	der := Sequence([][]byte{
+		ObjectIdentifier(OIDPkscs15Content),
+		ExplicitCompound(0, [][]byte{
+			Integer(big.NewInt(-129)),
+			UTF8String("label"),
+		}),
+		GeneralizedTimeExplicitValue(4, now),
+		ExplicitValue(40, []byte{0x01}),
+	})
+
+	node, err := Decode(der)
+	if err != nil {
+		t.Fatalf("Decode failed (%s)", err)
+	}
+
+	if !node.Is(asn1.ClassUniversal, asn1.TagSequence) || !node.Constructed || len(node.Children) != 4 {
+		t.Fatalf("Decode returned unexpected root node")
+	}
+
+	oid, err := node.Children[0].AsOID()
+	if err != nil || !oid.Equal(OIDPkscs15Content) {
+		t.Errorf("AsOID expected '%s' but got '%s' (%v)", OIDPkscs15Content, oid, err)
+	}
+
+	explicit, found := node.Child(asn1.ClassContextSpecific, 0)
+	if !found || len(explicit.Children) != 2 {
+		t.Fatalf("Child [0] not found")
+	}
+
+	i, err := explicit.Children[0].AsInteger()
+	if err != nil || i.Int64() != -129 {
+		t.Errorf("AsInteger expected -129 but got '%s' (%v)", i, err)
+	}
+
+	s, err := explicit.Children[1].AsUTF8String()
+	if err != nil || s != "label" {
+		t.Errorf("AsUTF8String expected 'label' but got '%s' (%v)", s, err)
+	}
+
+	// implicitly tagged time
+	tm, err := node.Children[2].AsGeneralizedTime()
+	if err != nil || !tm.Equal(now) {
+		t.Errorf("AsGeneralizedTime expected '%s' but got '%s' (%v)", now, tm, err)
+	}
+
+	// high tag number
+	if node.Children[3].Class != asn1.ClassContextSpecific || node.Children[3].Tag != 40 {
+		t.Errorf("expected [40] but got class %d tag %d", node.Children[3].Class, node.Children[3].Tag)
+	}
+
+	// wrong type
+	_, err = node.Children[0].AsInteger()
+	if !errors.Is(err, ErrWrongType) {
+		t.Errorf("AsInteger of OID expected wrong type error but got: %v", err)
+	}
+	_, err = node.AsOctetString()
+	if !errors.Is(err, ErrWrongType) {
+		t.Errorf("AsOctetString of SEQUENCE expected wrong type error but got: %v", err)
+	}
+
+	if !bytes.Equal(node.Encode(), der) {
+		t.Errorf("Encode expected '%X' but got '%X'", der, node.Encode())
+	}
+}
+
+// any input that decodes must be canonical and thus re-encode to exactly the
+// same bytes
+func FuzzDecode(f *testing.F) {
+	f.Add(Sequence([][]byte{Integer(big.NewInt(5)), OctetString([]byte{1, 2})}))
+	f.Add(ExplicitCompound(3, [][]byte{BitString("101")}))
+	for _, der := range decodeNonCanonicalTests {
+		f.Add(der)
+	}
+
+	f.Fuzz(func(t *testing.T, der []byte) {
+		node, err := Decode(der)
+		if err != nil {
+			return
+		}
+
+		if !bytes.Equal(node.Raw, der) {
+			t.Fatalf("Raw '%X' does not match input '%X'", node.Raw, der)
+		}
+		if !bytes.Equal(node.Encode(), der) {
+			t.Fatalf("Encode '%X' does not match input '%X'", node.Encode(), der)
+		}
+	})
+}
+
+// values encoded by this package must decode back to the same value
+func FuzzEncodeDecodeRoundTrip(f *testing.F) {
+	f.Add([]byte{}, "", int64(0), "", int64(0))
+	f.Add([]byte{0x00, 0xff}, "some label", int64(-129), "1011100010", int64(1700000000))
+	f.Add([]byte("x"), "日本語", int64(1<<40), "1", int64(-1000000))
+
+	f.Fuzz(func(t *testing.T, octets []byte, label string, integer int64, bits string, unixTime int64) {
+		// BitString panics on anything but 1s and 0s and UTF8String on
+		// invalid UTF-8 (as designed), so skip those
+		for _, c := range bits {
+			if c != '0' && c != '1' {
+				return
+			}
+		}
+		if !utf8.ValidString(label) {
+			return
+		}
+
+		// GeneralizedTime only supports years 0 - 9999
+		tm := time.Unix(unixTime%253402300799, 0).UTC()
+		if tm.Year() < 0 {
+			return
+		}
+
+		der := Sequence([][]byte{
+			OctetString(octets),
+			UTF8String(label),
+			Integer(big.NewInt(integer)),
+			IntegerExplicitValue(2, big.NewInt(integer)),
+			BitString(bits),
+			GeneralizedTime(tm),
+			GeneralizedTimeExplicitValue(0, tm),
+			ExplicitCompound(1, [][]byte{Set([][]byte{OctetString(octets)})}),
+		})
+
+		node, err := Decode(der)
+		if err != nil {
+			t.Fatalf("Decode failed (%s)", err)
+		}
+		if !bytes.Equal(node.Encode(), der) {
+			t.Fatalf("Encode does not match")
+		}
+		if len(node.Children) != 8 {
+			t.Fatalf("expected 8 children but got %d", len(node.Children))
+		}
+
+		gotOctets, err := node.Children[0].AsOctetString()
+		if err != nil || !bytes.Equal(gotOctets, octets) {
+			t.Errorf("AsOctetString mismatch (%v)", err)
+		}
+
+		gotLabel, err := node.Children[1].AsUTF8String()
+		if err != nil || gotLabel != label {
+			t.Errorf("AsUTF8String mismatch (%v)", err)
+		}
+
+		for _, child := range node.Children[2:4] {
+			gotInteger, err := child.AsInteger()
+			if err != nil || gotInteger.Int64() != integer {
+				t.Errorf("AsInteger mismatch (%v)", err)
+			}
+		}
+
+		gotBits, err := node.Children[4].AsBitString()
+		if err != nil || !bytes.Equal(gotBits.Bytes, asn1BitStringBytes(bits)) || gotBits.BitLength != len(bits) {
+			t.Errorf("AsBitString mismatch (%v)", err)
+		}
+
+		for _, child := range node.Children[5:7] {
+			gotTime, err := child.AsGeneralizedTime()
+			if err != nil || !gotTime.Equal(tm) {
+				t.Errorf("AsGeneralizedTime mismatch (%v)", err)
+			}
+		}
+
+		set := node.Children[7].Children[0]
+		if !set.Is(asn1.ClassUniversal, asn1.TagSet) || !bytes.Equal(set.Children[0].Value, octets) {
+			t.Errorf("explicit SET mismatch")
+		}
+	})
+}
+
+// asn1BitStringBytes returns the bytes of a string of 1s and 0s (padded with
+// 0s)
+func asn1BitStringBytes(bits string) []byte {
+	out := make([]byte, (len(bits)+7)/8)
+	for i, c := range bits {
+		if c == '1' {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
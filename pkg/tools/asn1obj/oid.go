@@ -6,11 +6,19 @@ var (
 	OIDPkscs15Content     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 15, 3, 1}     // pkcs15content (PKCS #15 content type)
 	OIDrsaEncryptionPKCS1 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}         // rsaEncryption (PKCS #1)
 	OIDpkcs5PBKDF2        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}        // pkcs5PBKDF2 (PKCS #5 v2.0)
+	OIDpkcs5PBES2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}        // pkcs5PBES2 (PKCS #5 v2.0)
+	OIDhmacWithSHA1       = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}            // hmacWithSHA1 (RSADSI digestAlgorithm)
 	OIDhmacWithSHA256     = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}            // hmacWithSHA256 (RSADSI digestAlgorithm)
+	OIDhmacWithSHA384     = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}           // hmacWithSHA384 (RSADSI digestAlgorithm)
+	OIDhmacWithSHA512     = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}           // hmacWithSHA512 (RSADSI digestAlgorithm)
 	OIDpwriKEK            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 3, 9}  // pwriKEK (S/MIME Algorithms)
 	OIDdesEDE3CBC         = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}            // des-EDE3-CBC (RSADSI encryptionAlgorithm)
+	OIDaes128CBC          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}     // aes128-CBC (NIST Algorithm)
+	OIDaes192CBC          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}    // aes192-CBC (NIST Algorithm)
+	OIDaes256CBC          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}    // aes256-CBC (NIST Algorithm)
 	OIDpkcs7Data          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}         // data (PKCS #7)
 	OIDauthEnc128         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 3, 15} // authEnc128 (S/MIME Algorithms)
+	OIDauthEnc256         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 3, 16} // authEnc256 (S/MIME Algorithms)
 	OIDecPublicKey        = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}             // ecPublicKey (ANSI X9.62 public key type)
 	OIDprime256v1         = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}          //  prime256v1 (ANSI X9.62 named elliptic curve)
 	OIDsecp384r1          = asn1.ObjectIdentifier{1, 3, 132, 0, 34}                   //  secp384r1 (SECG (Certicom) named elliptic curve)
@@ -27,3 +35,38 @@ func ObjectIdentifier(oid asn1.ObjectIdentifier) []byte {
 
 	return asn1result
 }
+
+// oidNames are the log friendly names of the OIDs above
+var oidNames = map[string]string{
+	OIDPkscs15Content.String():     "pkcs15content",
+	OIDrsaEncryptionPKCS1.String(): "rsaEncryption",
+	OIDpkcs5PBKDF2.String():        "pkcs5PBKDF2",
+	OIDpkcs5PBES2.String():         "pkcs5PBES2",
+	OIDhmacWithSHA1.String():       "hmacWithSHA1",
+	OIDhmacWithSHA256.String():     "hmacWithSHA256",
+	OIDhmacWithSHA384.String():     "hmacWithSHA384",
+	OIDhmacWithSHA512.String():     "hmacWithSHA512",
+	OIDpwriKEK.String():            "pwriKEK",
+	OIDdesEDE3CBC.String():         "des-EDE3-CBC",
+	OIDaes128CBC.String():          "aes128-CBC",
+	OIDaes192CBC.String():          "aes192-CBC",
+	OIDaes256CBC.String():          "aes256-CBC",
+	OIDpkcs7Data.String():          "data",
+	OIDauthEnc128.String():         "authEnc128",
+	OIDauthEnc256.String():         "authEnc256",
+	OIDecPublicKey.String():        "ecPublicKey",
+	OIDprime256v1.String():         "prime256v1",
+	OIDsecp384r1.String():          "secp384r1",
+	OIDsecp521r1.String():          "secp521r1",
+}
+
+// OIDName returns the name of oid followed by the dotted OID value, or just
+// the dotted value if the name of the OID is not known
+func OIDName(oid asn1.ObjectIdentifier) string {
+	name, ok := oidNames[oid.String()]
+	if !ok {
+		return oid.String()
+	}
+
+	return name + " (" + oid.String() + ")"
+}